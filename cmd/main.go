@@ -9,7 +9,9 @@ import (
 	"osohub/db"
 	_ "osohub/docs" // swaggo docs
 	"osohub/handlers"
+	"osohub/jobs"
 	"osohub/middleware"
+	"osohub/search"
 	"strings"
 	"time"
 
@@ -31,6 +33,22 @@ import (
 // @tag.description Endpoints for authentication and user management
 // @tag.name Images
 // @tag.description Endpoints for image management and feed
+// @tag.name Albums
+// @tag.description Albums and collections of images
+// @tag.name Comments
+// @tag.description Comments and replies on images
+// @tag.name Notifications
+// @tag.description Notification center and notification preferences
+// @tag.name Messages
+// @tag.description Direct messages between users
+// @tag.name Feeds
+// @tag.description Atom and JSON feeds for feed readers
+// @tag.name Sharing
+// @tag.description Share pages with link previews and oEmbed
+// @tag.name Webhooks
+// @tag.description Signed HTTP callbacks for platform events
+// @tag.name Moderation
+// @tag.description Endpoints for moderators and admins
 
 func main() {
 	// Load environment variables from .env
@@ -40,6 +58,9 @@ func main() {
 	}
 
 	log.Println("JWT_SECRET:", os.Getenv("JWT_SECRET")) // DEBUG: Check loaded value
+	if os.Getenv("PUBLIC_BASE_URL") == "" {
+		log.Printf("WARNING: PUBLIC_BASE_URL is not set. Shared links, share pages, Atom feeds and oEmbed will point to %s", handlers.DefaultPublicBaseURL)
+	}
 
 	// Set Gin mode from env (default: debug)
 	ginMode := os.Getenv("GIN_MODE")
@@ -77,6 +98,23 @@ func main() {
 		}
 	}()
 
+	// Eventos en tiempo real a través de Cassandra: llegan a los streams de todas las réplicas,
+	// las publique quien las publique. Antes de los jobs, que también publican
+	jobs.StartRelay()
+	// Tareas en segundo plano (publicación programada, ...); seguras con varias réplicas
+	jobs.Start()
+
+	// Índice de búsqueda embebido: se construye al arrancar y se reconstruye periódicamente
+	search.Start()
+
+	// Limpia cada hora las subidas reanudables abandonadas
+	go func() {
+		for {
+			handlers.CleanupExpiredUploads()
+			time.Sleep(time.Hour)
+		}
+	}()
+
 	r := gin.Default()
 
 	// Configurar CORS para permitir conexiones desde React y Vite
@@ -91,18 +129,24 @@ func main() {
 		config.AllowOrigins = []string{"http://localhost:3000", "http://localhost:5173"}
 	}
 
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept"}
+	config.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
 	config.AllowCredentials = true
-	config.ExposeHeaders = []string{"Content-Length"}
+	config.ExposeHeaders = []string{"Content-Length", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Expires", "X-Image-ID", "X-Upload-Error", "X-Duplicate-Of", "Warning"}
 	r.Use(cors.New(config))
 
 	// Middleware adicional para manejar preflight OPTIONS manualmente
 	r.OPTIONS("/*path", func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Accept")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Accept, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
 		c.Header("Access-Control-Max-Age", "86400")
+		// Descubrimiento del protocolo tus para subidas reanudables
+		if strings.HasPrefix(c.Request.URL.Path, "/uploads") {
+			handlers.TusOptionsHeaders(c)
+		}
 		c.Status(200)
 	})
 
@@ -118,11 +162,47 @@ func main() {
 	r.POST("/images/:image_id/like", middleware.AuthMiddleware(), handlers.LikeImage)
 	r.DELETE("/images/:image_id/like", middleware.AuthMiddleware(), handlers.UnlikeImage)
 	r.GET("/images/:image_id/like/status", middleware.AuthMiddleware(), handlers.GetImageLikeStatus)
-	r.GET("/images/:image_id/likes/count", handlers.GetImageLikesCount)
+	r.GET("/images/:image_id/likes/count", middleware.OptionalAuth(), handlers.GetImageLikesCount)
+	r.GET("/images/:image_id/likes", middleware.OptionalAuth(), handlers.GetImageLikes)
+	r.GET("/images/:image_id/stats", middleware.AuthMiddleware(), handlers.GetImageStats)
+	r.GET("/reactions", handlers.GetReactions)
+	r.GET("/images/:image_id/reactions", middleware.OptionalAuth(), handlers.GetImageReactions)
+	r.PUT("/images/:image_id/reaction", middleware.AuthMiddleware(), handlers.ReactToImage)
+	r.DELETE("/images/:image_id/reaction", middleware.AuthMiddleware(), handlers.RemoveImageReaction)
+	r.GET("/images/:image_id/comments", middleware.OptionalAuth(), handlers.GetImageComments)
+	r.POST("/images/:image_id/comments", middleware.AuthMiddleware(), handlers.CreateComment)
+	r.GET("/images/:image_id/comments/count", middleware.OptionalAuth(), handlers.GetImageCommentsCount)
+	r.GET("/comments/:comment_id/replies", middleware.OptionalAuth(), handlers.GetCommentReplies)
+	r.PATCH("/comments/:comment_id", middleware.AuthMiddleware(), handlers.UpdateComment)
+	r.DELETE("/comments/:comment_id", middleware.AuthMiddleware(), handlers.DeleteComment)
+	r.POST("/comments/:comment_id/report", middleware.AuthMiddleware(), handlers.ReportComment)
 	r.DELETE("/images/:image_id", middleware.AuthMiddleware(), handlers.DeleteImage)
+	r.PATCH("/images/:image_id", middleware.AuthMiddleware(), handlers.UpdateImage)
 	r.GET("/users/me", middleware.AuthMiddleware(), handlers.GetCurrentUser)
 	r.PATCH("/users/me", middleware.AuthMiddleware(), handlers.UpdateOwnUser)
 	r.GET("/users/me/share-link", middleware.AuthMiddleware(), handlers.GetMyShareLink)
+	r.GET("/users/me/trash", middleware.AuthMiddleware(), handlers.GetMyTrash)
+	r.GET("/users/me/likes", middleware.AuthMiddleware(), handlers.GetMyLikes)
+	r.GET("/users/me/bookmarks", middleware.AuthMiddleware(), handlers.GetMyBookmarks)
+	r.GET("/users/me/blocks", middleware.AuthMiddleware(), handlers.GetMyBlocks)
+	r.GET("/users/me/mutes", middleware.AuthMiddleware(), handlers.GetMyMutes)
+	r.GET("/users/me/notifications", middleware.AuthMiddleware(), handlers.GetMyNotifications)
+	r.GET("/users/me/notifications/unread-count", middleware.AuthMiddleware(), handlers.GetUnreadNotificationsCount)
+	r.POST("/users/me/notifications/read-all", middleware.AuthMiddleware(), handlers.MarkAllNotificationsRead)
+	r.POST("/users/me/notifications/:notification_id/read", middleware.AuthMiddleware(), handlers.MarkNotificationRead)
+	r.GET("/users/me/notifications/preferences", middleware.AuthMiddleware(), handlers.GetNotificationPreferences)
+	r.PATCH("/users/me/notifications/preferences", middleware.AuthMiddleware(), handlers.UpdateNotificationPreferences)
+	r.POST("/images/:image_id/bookmark", middleware.AuthMiddleware(), handlers.BookmarkImage)
+	r.DELETE("/images/:image_id/bookmark", middleware.AuthMiddleware(), handlers.RemoveBookmark)
+	r.GET("/users/me/albums", middleware.AuthMiddleware(), handlers.GetMyAlbums)
+	r.POST("/users/me/albums", middleware.AuthMiddleware(), handlers.CreateAlbum)
+	r.PATCH("/users/me/albums/:album_id", middleware.AuthMiddleware(), handlers.UpdateAlbum)
+	r.DELETE("/users/me/albums/:album_id", middleware.AuthMiddleware(), handlers.DeleteAlbum)
+	r.POST("/users/me/albums/:album_id/images", middleware.AuthMiddleware(), handlers.AddAlbumImage)
+	r.PUT("/users/me/albums/:album_id/images", middleware.AuthMiddleware(), handlers.ReorderAlbumImages)
+	r.DELETE("/users/me/albums/:album_id/images/:image_id", middleware.AuthMiddleware(), handlers.RemoveAlbumImage)
+	r.GET("/albums/:album_id", middleware.OptionalAuth(), handlers.GetAlbum)
+	r.POST("/images/:image_id/restore", middleware.AuthMiddleware(), handlers.RestoreImage)
 
 	// Ruta raíz con información de la API
 	r.GET("/", func(c *gin.Context) {
@@ -134,21 +214,67 @@ func main() {
 	})
 
 	// Ruta pública para perfiles (sin autenticación)
-	r.GET("/profile/:username", handlers.GetPublicProfile)
+	r.GET("/profile/:username", middleware.OptionalAuth(), handlers.GetPublicProfile)
+	r.GET("/profile/:username/feed.atom", handlers.GetProfileAtomFeed)
+	r.GET("/profile/:username/feed.json", handlers.GetProfileJSONFeed)
+	r.GET("/feed.atom", handlers.GetGlobalAtomFeed)
+
+	// Páginas para compartir (vista previa en apps de chat) y oEmbed
+	r.GET("/p/:image_id", handlers.SharePostPage)
+	r.GET("/u/:username", handlers.ShareProfilePage)
+	r.GET("/oembed", handlers.OEmbed)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	r.GET("/users/:user_id", handlers.GetUserByID)
 	r.POST("/users", handlers.CreateUser)
-	r.PATCH("/users/:user_id/ban", handlers.BanUser)
+	r.PATCH("/users/:user_id/ban", middleware.AuthMiddleware(), middleware.AdminOnly(), handlers.BanUser)
 	r.POST("/auth/login", handlers.Login)
-	r.GET("/images/byid/:image_id", handlers.GetImageByIDByOnlyID)
+	r.GET("/images/byid/:image_id", middleware.OptionalAuth(), handlers.GetImageByIDByOnlyID)
 	r.POST("/images", middleware.AuthMiddleware(), handlers.UploadImage)
-	r.GET("/users/:user_id/images", handlers.GetImagesByUser)
-	r.GET("/feed", handlers.GetFeed)
+	r.POST("/posts", middleware.AuthMiddleware(), handlers.CreatePost)
+	r.POST("/uploads", middleware.AuthMiddleware(), handlers.CreateUpload)
+	r.HEAD("/uploads/:upload_id", middleware.AuthMiddleware(), handlers.GetUploadOffset)
+	r.PATCH("/uploads/:upload_id", middleware.AuthMiddleware(), handlers.PatchUpload)
+	r.DELETE("/uploads/:upload_id", middleware.AuthMiddleware(), handlers.DeleteUpload)
+	r.GET("/users/:user_id/images", middleware.OptionalAuth(), handlers.GetImagesByUser)
+	r.GET("/feed", middleware.OptionalAuth(), handlers.GetFeed)
+	r.GET("/feed/home", middleware.AuthMiddleware(), handlers.GetHomeFeed)
+	r.GET("/feed/trending", middleware.OptionalAuth(), handlers.GetTrendingFeed)
+	r.POST("/stream/ticket", middleware.AuthMiddleware(), handlers.CreateStreamTicket)
+	r.GET("/stream", middleware.StreamTicket(), middleware.RequireUser(), handlers.Stream)
+	r.POST("/users/:user_id/follow", middleware.AuthMiddleware(), handlers.FollowUser)
+	r.DELETE("/users/:user_id/follow", middleware.AuthMiddleware(), handlers.UnfollowUser)
+	r.POST("/users/:user_id/block", middleware.AuthMiddleware(), handlers.BlockUser)
+	r.DELETE("/users/:user_id/block", middleware.AuthMiddleware(), handlers.UnblockUser)
+	r.POST("/users/:user_id/mute", middleware.AuthMiddleware(), handlers.MuteUser)
+	r.DELETE("/users/:user_id/mute", middleware.AuthMiddleware(), handlers.UnmuteUser)
+	r.GET("/tags/trending", handlers.GetTrendingTags)
+	r.GET("/search", middleware.OptionalAuth(), handlers.Search)
+	r.GET("/tags/:tag/images", middleware.OptionalAuth(), handlers.GetImagesByTag)
 	r.POST("/images/:image_id/report", middleware.AuthMiddleware(), handlers.ReportImage)
 	r.GET("/images/:image_id/reports/count", handlers.GetImageReportsCount)
 	r.GET("/reports/categories", handlers.GetReportCategories)
 	r.GET("/reports/by-category", middleware.AuthMiddleware(), handlers.GetReportsByCategory)
+	r.GET("/images/:image_id/similar", middleware.AdminOnly(), handlers.GetSimilarImages)
+	r.POST("/images/:image_id/ban-hash", middleware.AdminOnly(), handlers.BanImageHash)
+
+	// Webhooks
+	r.POST("/webhooks", middleware.AuthMiddleware(), handlers.CreateWebhook)
+	r.GET("/webhooks", middleware.AuthMiddleware(), handlers.GetWebhooks)
+	r.GET("/webhooks/:webhook_id", middleware.AuthMiddleware(), handlers.GetWebhook)
+	r.PATCH("/webhooks/:webhook_id", middleware.AuthMiddleware(), handlers.UpdateWebhook)
+	r.DELETE("/webhooks/:webhook_id", middleware.AuthMiddleware(), handlers.DeleteWebhook)
+	r.GET("/webhooks/:webhook_id/deliveries", middleware.AuthMiddleware(), handlers.GetWebhookDeliveries)
+	r.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", middleware.AuthMiddleware(), handlers.RedeliverWebhook)
+	r.POST("/webhooks/:webhook_id/ping", middleware.AuthMiddleware(), handlers.PingWebhook)
+
+	// Mensajes directos
+	r.POST("/conversations", middleware.AuthMiddleware(), handlers.StartConversation)
+	r.GET("/users/me/conversations", middleware.AuthMiddleware(), handlers.GetMyConversations)
+	r.GET("/users/me/conversations/unread-count", middleware.AuthMiddleware(), handlers.GetUnreadConversationsCount)
+	r.GET("/conversations/:conversation_id/messages", middleware.AuthMiddleware(), handlers.GetConversationMessages)
+	r.POST("/conversations/:conversation_id/messages", middleware.AuthMiddleware(), handlers.SendMessage)
+	r.POST("/conversations/:conversation_id/read", middleware.AuthMiddleware(), handlers.MarkConversationRead)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,76 @@
+// Command worker runs the background jobs without the HTTP API. Start the API
+// replicas with BACKGROUND_JOBS=false when running it.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"osohub/db"
+	"osohub/jobs"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	backfillLikes := flag.Bool("backfill-likes", false, "copy likes_by_image into likes_by_user and exit")
+	backfillAlbums := flag.Bool("backfill-albums", false, "fill albums_by_image from album_items and exit")
+	backfillHashes := flag.Bool("backfill-hashes", false, "index the hash of every image and gallery item in image_hashes_by_chunk and exit")
+	backfillConversations := flag.Bool("backfill-conversations", false, "fill the conversation activity and unread tables from conversations_by_user and exit")
+	flag.Parse()
+
+	if err := godotenv.Load(".env"); err != nil {
+		log.Println("Could not load .env file, using system environment variables")
+	}
+
+	db.InitCassandra()
+	defer func() {
+		if sess := db.GetSession(); sess != nil {
+			sess.Close()
+		}
+	}()
+
+	if *backfillLikes {
+		n, err := db.BackfillLikesByUser()
+		if err != nil {
+			log.Fatalf("[worker] Backfill of likes_by_user failed after %d likes: %v", n, err)
+		}
+		log.Printf("[worker] Backfilled %d likes into likes_by_user", n)
+		return
+	}
+	if *backfillAlbums {
+		n, err := db.BackfillAlbumsByImage()
+		if err != nil {
+			log.Fatalf("[worker] Backfill of albums_by_image failed after %d album images: %v", n, err)
+		}
+		log.Printf("[worker] Backfilled %d album images into albums_by_image", n)
+		return
+	}
+	if *backfillHashes {
+		n, err := db.BackfillImageHashes()
+		if err != nil {
+			log.Fatalf("[worker] Backfill of image_hashes_by_chunk failed after %d hashes: %v", n, err)
+		}
+		log.Printf("[worker] Indexed %d image hashes", n)
+		return
+	}
+	if *backfillConversations {
+		n, err := db.BackfillConversationActivity()
+		if err != nil {
+			log.Fatalf("[worker] Backfill of conversation activity failed after %d conversations: %v", n, err)
+		}
+		log.Printf("[worker] Backfilled activity of %d conversations", n)
+		return
+	}
+
+	jobs.AnnounceEvents() // las imágenes programadas llegan a los streams de la API
+	jobs.Start()
+	log.Println("[worker] Background jobs started")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("[worker] Shutting down")
+}
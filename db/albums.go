@@ -0,0 +1,207 @@
+package db
+
+import (
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// SaveAlbum inserts or overwrites an album in albums_by_id and
+// albums_by_user.
+func SaveAlbum(a models.Album) error {
+	if err := GetSession().Query(`
+		INSERT INTO albums_by_id (album_id, user_id, title, description, kind, cover_image_id, image_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.AlbumID, a.UserID, a.Title, a.Description, a.Kind, a.CoverImageID, a.ImageCount, a.CreatedAt, a.UpdatedAt,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		INSERT INTO albums_by_user (user_id, created_at, album_id, title, description, kind, cover_image_id, image_count, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.UserID, a.CreatedAt, a.AlbumID, a.Title, a.Description, a.Kind, a.CoverImageID, a.ImageCount, a.UpdatedAt,
+	).Exec()
+}
+
+// GetAlbum loads an album from albums_by_id.
+func GetAlbum(albumID gocql.UUID) (*models.Album, error) {
+	a := models.Album{AlbumID: albumID}
+	if err := GetSession().Query(`
+		SELECT user_id, title, description, kind, cover_image_id, image_count, created_at, updated_at
+		FROM albums_by_id WHERE album_id = ?`,
+		albumID,
+	).Scan(&a.UserID, &a.Title, &a.Description, &a.Kind, &a.CoverImageID, &a.ImageCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAlbumsByUser lists a user's albums, newest first.
+func GetAlbumsByUser(userID gocql.UUID) ([]models.Album, error) {
+	iter := GetSession().Query(`
+		SELECT album_id, created_at, title, description, kind, cover_image_id, image_count, updated_at
+		FROM albums_by_user WHERE user_id = ?`,
+		userID,
+	).Iter()
+	albums := []models.Album{}
+	a := models.Album{UserID: userID}
+	for iter.Scan(&a.AlbumID, &a.CreatedAt, &a.Title, &a.Description, &a.Kind, &a.CoverImageID, &a.ImageCount, &a.UpdatedAt) {
+		albums = append(albums, a)
+		a = models.Album{UserID: userID}
+	}
+	return albums, iter.Close()
+}
+
+// DeleteAlbum removes an album and its membership.
+func DeleteAlbum(a models.Album) error {
+	ids, err := GetAlbumImageIDs(a.AlbumID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := GetSession().Query(`DELETE FROM albums_by_image WHERE image_id = ? AND album_id = ?`, id, a.AlbumID).Exec(); err != nil {
+			return err
+		}
+	}
+	if err := GetSession().Query(`DELETE FROM album_items WHERE album_id = ?`, a.AlbumID).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`DELETE FROM albums_by_user WHERE user_id = ? AND created_at = ? AND album_id = ?`, a.UserID, a.CreatedAt, a.AlbumID).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM albums_by_id WHERE album_id = ?`, a.AlbumID).Exec()
+}
+
+// GetAlbumImageIDs returns the images of an album in order.
+func GetAlbumImageIDs(albumID gocql.UUID) ([]gocql.UUID, error) {
+	iter := GetSession().Query(`SELECT image_id FROM album_items WHERE album_id = ?`, albumID).Iter()
+	var ids []gocql.UUID
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	return ids, iter.Close()
+}
+
+// SetAlbumImageIDs rewrites the ordered membership of an album. Positions
+// are kept dense (0..n-1), so adding, removing and reordering images all
+// go through here. albums_by_image follows the same membership.
+func SetAlbumImageIDs(albumID gocql.UUID, ids []gocql.UUID) error {
+	previous, err := GetAlbumImageIDs(albumID)
+	if err != nil {
+		return err
+	}
+	kept := make(map[gocql.UUID]bool, len(ids))
+	for _, id := range ids {
+		kept[id] = true
+	}
+	for _, id := range previous {
+		if !kept[id] {
+			if err := GetSession().Query(`DELETE FROM albums_by_image WHERE image_id = ? AND album_id = ?`, id, albumID).Exec(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := GetSession().Query(`DELETE FROM album_items WHERE album_id = ?`, albumID).Exec(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	batch := GetSession().NewBatch(gocql.UnloggedBatch)
+	for position, id := range ids {
+		batch.Query(`INSERT INTO album_items (album_id, position, image_id) VALUES (?, ?, ?)`, albumID, position, id)
+	}
+	if err := GetSession().ExecuteBatch(batch); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := GetSession().Query(`INSERT INTO albums_by_image (image_id, album_id) VALUES (?, ?)`, id, albumID).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveAlbumImages stores the new membership of an album and keeps its
+// cover and image count in sync: the cover falls back to the first image
+// when it is removed.
+func SaveAlbumImages(album *models.Album, ids []gocql.UUID) error {
+	if err := SetAlbumImageIDs(album.AlbumID, ids); err != nil {
+		return err
+	}
+	coverKept := false
+	for _, id := range ids {
+		if album.CoverImageID != nil && *album.CoverImageID == id {
+			coverKept = true
+			break
+		}
+	}
+	if !coverKept {
+		album.CoverImageID = nil
+		if len(ids) > 0 {
+			first := ids[0]
+			album.CoverImageID = &first
+		}
+	}
+	album.ImageCount = len(ids)
+	album.UpdatedAt = time.Now().UTC()
+	return SaveAlbum(*album)
+}
+
+// RemoveImageFromAlbums takes an image out of every album holding it, for
+// when the image is purged.
+func RemoveImageFromAlbums(imageID gocql.UUID) error {
+	iter := GetSession().Query(`SELECT album_id FROM albums_by_image WHERE image_id = ?`, imageID).Iter()
+	var albumIDs []gocql.UUID
+	var albumID gocql.UUID
+	for iter.Scan(&albumID) {
+		albumIDs = append(albumIDs, albumID)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	for _, albumID := range albumIDs {
+		album, err := GetAlbum(albumID)
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ids, err := GetAlbumImageIDs(albumID)
+		if err != nil {
+			return err
+		}
+		kept := make([]gocql.UUID, 0, len(ids))
+		for _, id := range ids {
+			if id != imageID {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == len(ids) {
+			continue
+		}
+		if err := SaveAlbumImages(album, kept); err != nil {
+			return err
+		}
+	}
+	return GetSession().Query(`DELETE FROM albums_by_image WHERE image_id = ?`, imageID).Exec()
+}
+
+// BackfillAlbumsByImage fills albums_by_image from album_items (for albums
+// created before albums_by_image existed). It is idempotent.
+func BackfillAlbumsByImage() (int, error) {
+	iter := GetSession().Query(`SELECT album_id, image_id FROM album_items`).PageSize(1000).Iter()
+	var albumID, imageID gocql.UUID
+	n := 0
+	for iter.Scan(&albumID, &imageID) {
+		if err := GetSession().Query(`INSERT INTO albums_by_image (image_id, album_id) VALUES (?, ?)`, imageID, albumID).Exec(); err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Close()
+}
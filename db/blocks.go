@@ -0,0 +1,110 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Relation lists of a user: the users they blocked and the users they muted.
+const (
+	RelationBlock = "block"
+	RelationMute  = "mute"
+)
+
+// BlockUser blocks blockedID for userID and removes any follow between them.
+func BlockUser(userID, blockedID gocql.UUID, at time.Time) error {
+	if err := GetSession().Query(`INSERT INTO blocks_by_user (user_id, blocked_id, blocked_at) VALUES (?, ?, ?)`, userID, blockedID, at).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`INSERT INTO blockers_by_user (user_id, blocker_id, blocked_at) VALUES (?, ?, ?)`, blockedID, userID, at).Exec(); err != nil {
+		return err
+	}
+	if _, err := Unfollow(userID, blockedID); err != nil {
+		return err
+	}
+	_, err := Unfollow(blockedID, userID)
+	return err
+}
+
+// UnblockUser removes a block.
+func UnblockUser(userID, blockedID gocql.UUID) error {
+	if err := GetSession().Query(`DELETE FROM blocks_by_user WHERE user_id = ? AND blocked_id = ?`, userID, blockedID).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM blockers_by_user WHERE user_id = ? AND blocker_id = ?`, blockedID, userID).Exec()
+}
+
+// IsBlockedBetween reports whether either user blocked the other.
+func IsBlockedBetween(a, b gocql.UUID) (bool, error) {
+	iter := GetSession().Query(`SELECT blocked_id FROM blocks_by_user WHERE user_id IN (?, ?) AND blocked_id IN (?, ?)`, a, b, a, b).Iter()
+	var blockedID gocql.UUID
+	found := iter.Scan(&blockedID)
+	return found, iter.Close()
+}
+
+// GetBlockedIDs returns the users hidden from userID by a block in either
+// direction (the ones they blocked and the ones who blocked them).
+func GetBlockedIDs(userID gocql.UUID) (map[gocql.UUID]bool, error) {
+	blocked := map[gocql.UUID]bool{}
+	for _, q := range []string{
+		`SELECT blocked_id FROM blocks_by_user WHERE user_id = ?`,
+		`SELECT blocker_id FROM blockers_by_user WHERE user_id = ?`,
+	} {
+		iter := GetSession().Query(q, userID).Iter()
+		var id gocql.UUID
+		for iter.Scan(&id) {
+			blocked[id] = true
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return blocked, nil
+}
+
+// MuteUser hides mutedID's images from userID's feeds. The muted user is
+// not told and can still interact.
+func MuteUser(userID, mutedID gocql.UUID, at time.Time) error {
+	return GetSession().Query(`INSERT INTO mutes_by_user (user_id, muted_id, muted_at) VALUES (?, ?, ?)`, userID, mutedID, at).Exec()
+}
+
+// UnmuteUser removes a mute.
+func UnmuteUser(userID, mutedID gocql.UUID) error {
+	return GetSession().Query(`DELETE FROM mutes_by_user WHERE user_id = ? AND muted_id = ?`, userID, mutedID).Exec()
+}
+
+// GetMutedIDs returns the users muted by userID.
+func GetMutedIDs(userID gocql.UUID) (map[gocql.UUID]bool, error) {
+	iter := GetSession().Query(`SELECT muted_id FROM mutes_by_user WHERE user_id = ?`, userID).Iter()
+	muted := map[gocql.UUID]bool{}
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		muted[id] = true
+	}
+	return muted, iter.Close()
+}
+
+// RelatedUser is an entry of a block or mute list.
+type RelatedUser struct {
+	UserID            gocql.UUID `json:"user_id"`
+	Username          string     `json:"username"`
+	ProfilePictureURL string     `json:"profile_picture_url"`
+	Since             time.Time  `json:"since"`
+}
+
+// GetRelatedUsers lists the users a user blocked or muted (relation is
+// RelationBlock or RelationMute).
+func GetRelatedUsers(userID gocql.UUID, relation string) ([]RelatedUser, error) {
+	q := `SELECT blocked_id, blocked_at FROM blocks_by_user WHERE user_id = ?`
+	if relation == RelationMute {
+		q = `SELECT muted_id, muted_at FROM mutes_by_user WHERE user_id = ?`
+	}
+	iter := GetSession().Query(q, userID).Iter()
+	users := []RelatedUser{}
+	var u RelatedUser
+	for iter.Scan(&u.UserID, &u.Since) {
+		users = append(users, u)
+	}
+	return users, iter.Close()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Bookmark is an image saved by a user.
+type Bookmark struct {
+	ImageID      gocql.UUID
+	BookmarkedAt time.Time
+}
+
+// AddBookmark saves an image for a user. Saving it again keeps the original
+// bookmarked_at so the image does not jump to the top of the list.
+func AddBookmark(imageID, userID gocql.UUID, at time.Time) (time.Time, error) {
+	m := map[string]interface{}{}
+	applied, err := GetSession().Query(`INSERT INTO bookmarks_by_image (image_id, user_id, bookmarked_at) VALUES (?, ?, ?) IF NOT EXISTS`, imageID, userID, at).MapScanCAS(m)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !applied {
+		// ya estaba guardada: se devuelve la fila existente sin tocar bookmarks_by_user
+		if prev, ok := m["bookmarked_at"].(time.Time); ok {
+			return prev, nil
+		}
+		prev, err := GetBookmark(imageID, userID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if prev != nil {
+			return *prev, nil
+		}
+		return at, nil
+	}
+	return at, GetSession().Query(`INSERT INTO bookmarks_by_user (user_id, bookmarked_at, image_id) VALUES (?, ?, ?)`, userID, at, imageID).Exec()
+}
+
+// RemoveBookmark removes a saved image. It reports false if it was not saved.
+func RemoveBookmark(imageID, userID gocql.UUID) (bool, error) {
+	at, err := GetBookmark(imageID, userID)
+	if err != nil || at == nil {
+		return false, err
+	}
+	if err := GetSession().Query(`DELETE FROM bookmarks_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Exec(); err != nil {
+		return false, err
+	}
+	return true, GetSession().Query(`DELETE FROM bookmarks_by_user WHERE user_id = ? AND bookmarked_at = ? AND image_id = ?`, userID, *at, imageID).Exec()
+}
+
+// GetBookmark returns when the user saved the image, or nil if they did not.
+func GetBookmark(imageID, userID gocql.UUID) (*time.Time, error) {
+	var at time.Time
+	err := GetSession().Query(`SELECT bookmarked_at FROM bookmarks_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&at)
+	if err == gocql.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+// GetBookmarks returns up to limit images saved by a user before the given
+// time, most recent first.
+func GetBookmarks(userID gocql.UUID, before time.Time, limit int) ([]Bookmark, error) {
+	iter := GetSession().Query(`
+		SELECT image_id, bookmarked_at FROM bookmarks_by_user WHERE user_id = ? AND bookmarked_at < ? LIMIT ?`,
+		userID, before, limit,
+	).Iter()
+	bookmarks := []Bookmark{}
+	var b Bookmark
+	for iter.Scan(&b.ImageID, &b.BookmarkedAt) {
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, iter.Close()
+}
+
+// DeleteImageBookmarks removes every bookmark of an image.
+func DeleteImageBookmarks(imageID gocql.UUID) error {
+	iter := GetSession().Query(`SELECT user_id, bookmarked_at FROM bookmarks_by_image WHERE image_id = ?`, imageID).Iter()
+	var userID gocql.UUID
+	var at time.Time
+	for iter.Scan(&userID, &at) {
+		if err := GetSession().Query(`DELETE FROM bookmarks_by_user WHERE user_id = ? AND bookmarked_at = ? AND image_id = ?`, userID, at, imageID).Exec(); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM bookmarks_by_image WHERE image_id = ?`, imageID).Exec()
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// InsertComment stores a comment or reply and increments the counters.
+func InsertComment(cm models.Comment) error {
+	if err := GetSession().Query(`
+		INSERT INTO comments_by_id (comment_id, image_id, parent_id, user_id, body, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		cm.CommentID, cm.ImageID, cm.ParentID, cm.UserID, cm.Body, cm.CreatedAt,
+	).Exec(); err != nil {
+		return err
+	}
+	if cm.ParentID == nil {
+		if err := GetSession().Query(`
+			INSERT INTO comments_by_image (image_id, comment_id, user_id, body) VALUES (?, ?, ?, ?)`,
+			cm.ImageID, cm.CommentID, cm.UserID, cm.Body,
+		).Exec(); err != nil {
+			return err
+		}
+	} else {
+		if err := GetSession().Query(`
+			INSERT INTO replies_by_comment (parent_id, comment_id, image_id, user_id, body) VALUES (?, ?, ?, ?, ?)`,
+			*cm.ParentID, cm.CommentID, cm.ImageID, cm.UserID, cm.Body,
+		).Exec(); err != nil {
+			return err
+		}
+		if err := GetSession().Query(`UPDATE comment_counters SET replies = replies + 1 WHERE comment_id = ?`, *cm.ParentID).Exec(); err != nil {
+			return err
+		}
+	}
+	if err := GetSession().Query(`UPDATE image_counters SET comments = comments + 1 WHERE image_id = ?`, cm.ImageID).Exec(); err != nil {
+		return err
+	}
+	return countHourly(cm.ImageID, StatComments, 1, cm.CommentID.Time())
+}
+
+// GetComment loads a comment from comments_by_id.
+func GetComment(commentID gocql.UUID) (*models.Comment, error) {
+	cm := models.Comment{CommentID: commentID}
+	if err := GetSession().Query(`
+		SELECT image_id, parent_id, user_id, body, created_at, edited_at FROM comments_by_id WHERE comment_id = ?`,
+		commentID,
+	).Scan(&cm.ImageID, &cm.ParentID, &cm.UserID, &cm.Body, &cm.CreatedAt, &cm.EditedAt); err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
+
+// scanComments reads comment rows (comment_id, user_id, body, edited_at).
+func scanComments(iter *gocql.Iter, imageID gocql.UUID, parentID *gocql.UUID) ([]models.Comment, error) {
+	comments := []models.Comment{}
+	cm := models.Comment{ImageID: imageID, ParentID: parentID}
+	for iter.Scan(&cm.CommentID, &cm.UserID, &cm.Body, &cm.EditedAt) {
+		cm.CreatedAt = cm.CommentID.Time().UTC()
+		comments = append(comments, cm)
+		cm = models.Comment{ImageID: imageID, ParentID: parentID}
+	}
+	return comments, iter.Close()
+}
+
+// GetCommentsByImage returns up to limit top-level comments of an image,
+// newest first, older than the cursor comment (nil for the first page).
+func GetCommentsByImage(imageID gocql.UUID, cursor *gocql.UUID, limit int) ([]models.Comment, error) {
+	var iter *gocql.Iter
+	if cursor == nil {
+		iter = GetSession().Query(`
+			SELECT comment_id, user_id, body, edited_at FROM comments_by_image WHERE image_id = ? LIMIT ?`,
+			imageID, limit).Iter()
+	} else {
+		iter = GetSession().Query(`
+			SELECT comment_id, user_id, body, edited_at FROM comments_by_image WHERE image_id = ? AND comment_id < ? LIMIT ?`,
+			imageID, *cursor, limit).Iter()
+	}
+	return scanComments(iter, imageID, nil)
+}
+
+// GetReplies returns up to limit replies to a comment, oldest first, newer
+// than the cursor reply (nil for the first page).
+func GetReplies(parent models.Comment, cursor *gocql.UUID, limit int) ([]models.Comment, error) {
+	var iter *gocql.Iter
+	if cursor == nil {
+		iter = GetSession().Query(`
+			SELECT comment_id, user_id, body, edited_at FROM replies_by_comment WHERE parent_id = ? LIMIT ?`,
+			parent.CommentID, limit).Iter()
+	} else {
+		iter = GetSession().Query(`
+			SELECT comment_id, user_id, body, edited_at FROM replies_by_comment WHERE parent_id = ? AND comment_id > ? LIMIT ?`,
+			parent.CommentID, *cursor, limit).Iter()
+	}
+	parentID := parent.CommentID
+	return scanComments(iter, parent.ImageID, &parentID)
+}
+
+// GetReplyCounts returns the number of replies to each of the given
+// comments in one query. Comments without replies are missing.
+func GetReplyCounts(commentIDs []gocql.UUID) (map[gocql.UUID]int64, error) {
+	counts := make(map[gocql.UUID]int64, len(commentIDs))
+	if len(commentIDs) == 0 {
+		return counts, nil
+	}
+	iter := GetSession().Query(`SELECT comment_id, replies FROM comment_counters WHERE comment_id IN ?`, commentIDs).Iter()
+	var commentID gocql.UUID
+	var replies int64
+	for iter.Scan(&commentID, &replies) {
+		counts[commentID] = replies
+	}
+	return counts, iter.Close()
+}
+
+// GetImageCommentCount returns the number of comments (replies included)
+// of an image.
+func GetImageCommentCount(imageID gocql.UUID) (int64, error) {
+	var comments int64
+	err := GetSession().Query(`SELECT comments FROM image_counters WHERE image_id = ?`, imageID).Scan(&comments)
+	if err == gocql.ErrNotFound {
+		return 0, nil
+	}
+	return comments, err
+}
+
+// UpdateCommentBody edits a comment in every table that holds it.
+func UpdateCommentBody(cm models.Comment, body string, editedAt time.Time) error {
+	if err := GetSession().Query(`UPDATE comments_by_id SET body = ?, edited_at = ? WHERE comment_id = ?`, body, editedAt, cm.CommentID).Exec(); err != nil {
+		return err
+	}
+	m := map[string]interface{}{}
+	if cm.ParentID == nil {
+		_, err := GetSession().Query(`UPDATE comments_by_image SET body = ?, edited_at = ? WHERE image_id = ? AND comment_id = ? IF EXISTS`,
+			body, editedAt, cm.ImageID, cm.CommentID).MapScanCAS(m)
+		return err
+	}
+	_, err := GetSession().Query(`UPDATE replies_by_comment SET body = ?, edited_at = ? WHERE parent_id = ? AND comment_id = ? IF EXISTS`,
+		body, editedAt, *cm.ParentID, cm.CommentID).MapScanCAS(m)
+	return err
+}
+
+// DeleteComment deletes a comment, with its replies if it is a top-level
+// comment, and updates the counters. Reports on it, and its reports counter,
+// are kept for moderators.
+func DeleteComment(cm models.Comment) error {
+	removed := int64(1)
+	if cm.ParentID == nil {
+		iter := GetSession().Query(`SELECT comment_id FROM replies_by_comment WHERE parent_id = ?`, cm.CommentID).Iter()
+		var replyID gocql.UUID
+		for iter.Scan(&replyID) {
+			if err := GetSession().Query(`DELETE FROM comments_by_id WHERE comment_id = ?`, replyID).Exec(); err != nil {
+				iter.Close()
+				return err
+			}
+			if err := countHourly(cm.ImageID, StatComments, -1, replyID.Time()); err != nil {
+				iter.Close()
+				return err
+			}
+			removed++
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		if err := GetSession().Query(`DELETE FROM replies_by_comment WHERE parent_id = ?`, cm.CommentID).Exec(); err != nil {
+			return err
+		}
+		if err := GetSession().Query(`DELETE FROM comments_by_image WHERE image_id = ? AND comment_id = ?`, cm.ImageID, cm.CommentID).Exec(); err != nil {
+			return err
+		}
+		// solo se descuentan las respuestas: el contador de reportes se
+		// conserva para los moderadores
+		if replies := removed - 1; replies > 0 {
+			if err := GetSession().Query(`UPDATE comment_counters SET replies = replies - ? WHERE comment_id = ?`, replies, cm.CommentID).Exec(); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := GetSession().Query(`DELETE FROM replies_by_comment WHERE parent_id = ? AND comment_id = ?`, *cm.ParentID, cm.CommentID).Exec(); err != nil {
+			return err
+		}
+		if err := GetSession().Query(`UPDATE comment_counters SET replies = replies - 1 WHERE comment_id = ?`, *cm.ParentID).Exec(); err != nil {
+			return err
+		}
+	}
+	if err := GetSession().Query(`DELETE FROM comments_by_id WHERE comment_id = ?`, cm.CommentID).Exec(); err != nil {
+		return err
+	}
+	if err := countHourly(cm.ImageID, StatComments, -1, cm.CommentID.Time()); err != nil {
+		return err
+	}
+	return GetSession().Query(`UPDATE image_counters SET comments = comments - ? WHERE image_id = ?`, removed, cm.ImageID).Exec()
+}
+
+// DeleteImageComments deletes every comment of an image (used when the
+// image is purged; the counters go with image_counters).
+func DeleteImageComments(imageID gocql.UUID) error {
+	iter := GetSession().Query(`SELECT comment_id FROM comments_by_image WHERE image_id = ?`, imageID).Iter()
+	var commentID gocql.UUID
+	var ids []gocql.UUID
+	for iter.Scan(&commentID) {
+		ids = append(ids, commentID)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		replies := GetSession().Query(`SELECT comment_id FROM replies_by_comment WHERE parent_id = ?`, id).Iter()
+		var replyID gocql.UUID
+		for replies.Scan(&replyID) {
+			if err := GetSession().Query(`DELETE FROM comments_by_id WHERE comment_id = ?`, replyID).Exec(); err != nil {
+				replies.Close()
+				return err
+			}
+		}
+		if err := replies.Close(); err != nil {
+			return err
+		}
+		for _, q := range []string{
+			`DELETE FROM replies_by_comment WHERE parent_id = ?`,
+			`DELETE FROM comment_counters WHERE comment_id = ?`,
+			`DELETE FROM comments_by_id WHERE comment_id = ?`,
+		} {
+			if err := GetSession().Query(q, id).Exec(); err != nil {
+				return err
+			}
+		}
+	}
+	return GetSession().Query(`DELETE FROM comments_by_image WHERE image_id = ?`, imageID).Exec()
+}
+
+// InsertCommentReport stores a report on a comment with a copy of its body,
+// so the evidence survives the comment being edited or deleted.
+func InsertCommentReport(cm models.Comment, reporterID gocql.UUID, category, reason string) error {
+	reportID := gocql.TimeUUID()
+	now := time.Now().UTC()
+	if err := GetSession().Query(`
+		INSERT INTO reports_by_comment (comment_id, report_id, image_id, author_id, comment_body, reporter_id, category, reason, reported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cm.CommentID, reportID, cm.ImageID, cm.UserID, cm.Body, reporterID, category, reason, now,
+	).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`
+		INSERT INTO reports_by_category (category, reported_at, report_id, image_id, comment_id, reporter_id, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		category, now, reportID, cm.ImageID, cm.CommentID, reporterID, reason,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`UPDATE comment_counters SET reports = reports + 1 WHERE comment_id = ?`, cm.CommentID).Exec()
+}
+
+// GetCommentReporters returns the distinct users who reported a comment.
+func GetCommentReporters(commentID gocql.UUID) ([]gocql.UUID, error) {
+	iter := GetSession().Query(`SELECT reporter_id FROM reports_by_comment WHERE comment_id = ?`, commentID).Iter()
+	seen := map[gocql.UUID]bool{}
+	reporters := []gocql.UUID{}
+	var reporterID gocql.UUID
+	for iter.Scan(&reporterID) {
+		if !seen[reporterID] {
+			seen[reporterID] = true
+			reporters = append(reporters, reporterID)
+		}
+	}
+	return reporters, iter.Close()
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Follow adds followerID to the followers of followedID. It reports false
+// if they already followed them (the counters are then left alone).
+func Follow(followerID, followedID gocql.UUID, at time.Time) (bool, error) {
+	m := map[string]interface{}{}
+	applied, err := GetSession().Query(`INSERT INTO following_by_user (user_id, followed_id, followed_at) VALUES (?, ?, ?) IF NOT EXISTS`, followerID, followedID, at).MapScanCAS(m)
+	if err != nil || !applied {
+		return false, err
+	}
+	if err := GetSession().Query(`INSERT INTO followers_by_user (user_id, follower_id, followed_at) VALUES (?, ?, ?)`, followedID, followerID, at).Exec(); err != nil {
+		return true, err
+	}
+	if err := GetSession().Query(`UPDATE follow_counters SET following = following + 1 WHERE user_id = ?`, followerID).Exec(); err != nil {
+		return true, err
+	}
+	return true, GetSession().Query(`UPDATE follow_counters SET followers = followers + 1 WHERE user_id = ?`, followedID).Exec()
+}
+
+// Unfollow removes followerID from the followers of followedID. It reports
+// false if they did not follow them.
+func Unfollow(followerID, followedID gocql.UUID) (bool, error) {
+	m := map[string]interface{}{}
+	applied, err := GetSession().Query(`DELETE FROM following_by_user WHERE user_id = ? AND followed_id = ? IF EXISTS`, followerID, followedID).MapScanCAS(m)
+	if err != nil || !applied {
+		return false, err
+	}
+	if err := GetSession().Query(`DELETE FROM followers_by_user WHERE user_id = ? AND follower_id = ?`, followedID, followerID).Exec(); err != nil {
+		return true, err
+	}
+	if err := GetSession().Query(`UPDATE follow_counters SET following = following - 1 WHERE user_id = ?`, followerID).Exec(); err != nil {
+		return true, err
+	}
+	return true, GetSession().Query(`UPDATE follow_counters SET followers = followers - 1 WHERE user_id = ?`, followedID).Exec()
+}
+
+// IsFollowing reports whether followerID follows followedID.
+func IsFollowing(followerID, followedID gocql.UUID) (bool, error) {
+	var at time.Time
+	err := GetSession().Query(`SELECT followed_at FROM following_by_user WHERE user_id = ? AND followed_id = ?`, followerID, followedID).Scan(&at)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetFollowCounts returns how many followers a user has and how many users
+// they follow.
+func GetFollowCounts(userID gocql.UUID) (followers, following int64, err error) {
+	err = GetSession().Query(`SELECT followers, following FROM follow_counters WHERE user_id = ?`, userID).Scan(&followers, &following)
+	if err == gocql.ErrNotFound {
+		return 0, 0, nil
+	}
+	return followers, following, err
+}
+
+// GetFollowing returns up to limit users followed by userID, in the order
+// of following_by_user (by followed_id). The driver pages through the
+// partition, so large limits are fine.
+func GetFollowing(userID gocql.UUID, limit int) ([]gocql.UUID, error) {
+	iter := GetSession().Query(`SELECT followed_id FROM following_by_user WHERE user_id = ? LIMIT ?`, userID, limit).Iter()
+	ids := []gocql.UUID{}
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	return ids, iter.Close()
+}
+
+// TimelineEntry is an image of images_by_user considered for a home feed.
+type TimelineEntry struct {
+	ImageID    gocql.UUID
+	UserID     gocql.UUID
+	UploadedAt time.Time
+	Visibility string
+}
+
+// timelineWorkers is how many images_by_user partitions GetTimeline reads
+// at the same time.
+const timelineWorkers = 16
+
+// GetTimeline merges the latest images of the given users uploaded before
+// the given time (fan-out on read over images_by_user), newest first. Each
+// user contributes at most limit images, so the merge is exact for the page.
+// The users are read in parallel, timelineWorkers at a time.
+func GetTimeline(userIDs []gocql.UUID, before time.Time, limit int) ([]TimelineEntry, error) {
+	results := make([][]TimelineEntry, len(userIDs))
+	errs := make([]error, len(userIDs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(timelineWorkers, len(userIDs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i], errs[i] = getUserTimeline(userIDs[i], before, limit)
+			}
+		}()
+	}
+	for i := range userIDs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	entries := []TimelineEntry{}
+	for i := range userIDs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		entries = append(entries, results[i]...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].UploadedAt.After(entries[j].UploadedAt)
+	})
+	return entries, nil
+}
+
+// getUserTimeline returns the latest limit images of a user uploaded
+// before the given time.
+func getUserTimeline(userID gocql.UUID, before time.Time, limit int) ([]TimelineEntry, error) {
+	iter := GetSession().Query(`
+		SELECT image_id, uploaded_at, visibility FROM images_by_user
+		WHERE user_id = ? AND uploaded_at < ? LIMIT ?`,
+		userID, before, limit,
+	).Iter()
+	var entries []TimelineEntry
+	e := TimelineEntry{UserID: userID}
+	for iter.Scan(&e.ImageID, &e.UploadedAt, &e.Visibility) {
+		entries = append(entries, e)
+		e = TimelineEntry{UserID: userID}
+	}
+	return entries, iter.Close()
+}
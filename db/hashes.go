@@ -0,0 +1,159 @@
+package db
+
+import (
+	"osohub/imaging"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// bannedHashesBucket is the single partition holding banned hashes; the list
+// is small and always scanned entirely.
+const bannedHashesBucket = "all"
+
+// SimilarImage is an indexed image whose hash is close to a queried one.
+type SimilarImage struct {
+	ImageID  gocql.UUID `json:"image_id"`
+	UserID   gocql.UUID `json:"user_id"`
+	Distance int        `json:"distance"`
+}
+
+// BannedHash is a perceptual hash that moderators blocked from being uploaded.
+type BannedHash struct {
+	Hash     uint64     `json:"-"`
+	ImageID  gocql.UUID `json:"image_id"`
+	Reason   string     `json:"reason"`
+	BannedAt time.Time  `json:"banned_at"`
+	Distance int        `json:"distance"`
+}
+
+// InsertImageHash indexes an image hash under each of its chunks.
+func InsertImageHash(imageID, userID gocql.UUID, hash uint64) error {
+	for i, chunk := range imaging.Chunks(hash) {
+		if err := GetSession().Query(`
+			INSERT INTO image_hashes_by_chunk (chunk_index, chunk_value, image_id, user_id, phash)
+			VALUES (?, ?, ?, ?, ?)`,
+			i, int(chunk), imageID, userID, int64(hash),
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImageHash removes one hash of an image from the hash index; the
+// other hashes of the same post stay.
+func DeleteImageHash(imageID gocql.UUID, hash uint64) error {
+	for i, chunk := range imaging.Chunks(hash) {
+		if err := GetSession().Query(`
+			DELETE FROM image_hashes_by_chunk WHERE chunk_index = ? AND chunk_value = ? AND image_id = ? AND phash = ?`,
+			i, int(chunk), imageID, int64(hash),
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindSimilarImages returns indexed images within maxDistance bits of hash,
+// each with the distance of its closest hash (a gallery post has one per
+// image). maxDistance is capped at imaging.HashChunks-1, the largest
+// distance the chunk index can answer exhaustively.
+func FindSimilarImages(hash uint64, maxDistance int) ([]SimilarImage, error) {
+	if maxDistance > imaging.HashChunks-1 {
+		maxDistance = imaging.HashChunks - 1
+	}
+	found := make(map[gocql.UUID]int) // posición en matches
+	var matches []SimilarImage
+	for i, chunk := range imaging.Chunks(hash) {
+		iter := GetSession().Query(`
+			SELECT image_id, user_id, phash FROM image_hashes_by_chunk WHERE chunk_index = ? AND chunk_value = ?`,
+			i, int(chunk),
+		).Iter()
+		var imageID, userID gocql.UUID
+		var candidate int64
+		for iter.Scan(&imageID, &userID, &candidate) {
+			d := imaging.HammingDistance(hash, uint64(candidate))
+			if d > maxDistance {
+				continue
+			}
+			if j, ok := found[imageID]; ok {
+				matches[j].Distance = min(matches[j].Distance, d)
+				continue
+			}
+			found[imageID] = len(matches)
+			matches = append(matches, SimilarImage{ImageID: imageID, UserID: userID, Distance: d})
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// BackfillImageHashes indexes the hash of every image and gallery item (for
+// the index recreated with phash in its key). It is idempotent.
+func BackfillImageHashes() (int, error) {
+	owners := map[gocql.UUID]gocql.UUID{}
+	iter := GetSession().Query(`SELECT image_id, user_id, phash FROM images_by_id`).PageSize(1000).Iter()
+	var imageID, userID gocql.UUID
+	var phash *int64
+	n := 0
+	for iter.Scan(&imageID, &userID, &phash) {
+		owners[imageID] = userID
+		if phash != nil {
+			if err := InsertImageHash(imageID, userID, uint64(*phash)); err != nil {
+				iter.Close()
+				return n, err
+			}
+			n++
+		}
+		phash = nil
+	}
+	if err := iter.Close(); err != nil {
+		return n, err
+	}
+	iter = GetSession().Query(`SELECT post_id, phash FROM post_items`).PageSize(1000).Iter()
+	for iter.Scan(&imageID, &phash) {
+		if userID, ok := owners[imageID]; ok && phash != nil {
+			if err := InsertImageHash(imageID, userID, uint64(*phash)); err != nil {
+				iter.Close()
+				return n, err
+			}
+			n++
+		}
+		phash = nil
+	}
+	return n, iter.Close()
+}
+
+// BanImageHash adds a hash to the list of banned uploads.
+func BanImageHash(hash uint64, imageID gocql.UUID, reason string) error {
+	return GetSession().Query(`
+		INSERT INTO banned_image_hashes (bucket, phash, image_id, reason, banned_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		bannedHashesBucket, int64(hash), imageID, reason, time.Now().UTC(),
+	).Exec()
+}
+
+// FindBannedHash returns the closest banned hash within maxDistance bits of
+// hash, or nil if there is none.
+func FindBannedHash(hash uint64, maxDistance int) (*BannedHash, error) {
+	iter := GetSession().Query(`
+		SELECT phash, image_id, reason, banned_at FROM banned_image_hashes WHERE bucket = ?`,
+		bannedHashesBucket,
+	).Iter()
+	var best *BannedHash
+	var banned int64
+	var b BannedHash
+	for iter.Scan(&banned, &b.ImageID, &b.Reason, &b.BannedAt) {
+		d := imaging.HammingDistance(hash, uint64(banned))
+		if d <= maxDistance && (best == nil || d < best.Distance) {
+			match := b
+			match.Hash = uint64(banned)
+			match.Distance = d
+			best = &match
+		}
+	}
+	return best, iter.Close()
+}
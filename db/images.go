@@ -0,0 +1,167 @@
+package db
+
+import (
+	"osohub/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ImageRef holds the key columns needed to reach an image's rows in
+// images_by_id, images_by_date and images_by_user.
+type ImageRef struct {
+	ImageID    gocql.UUID
+	UserID     gocql.UUID
+	DayBucket  string
+	UploadedAt time.Time
+	Visibility string
+	DeletedAt  *time.Time // en la papelera desde esta fecha
+	Tags       []string
+}
+
+// InFeed reports whether the image belongs in images_by_date and
+// images_by_tag: public, already published and not in the trash.
+func (ref ImageRef) InFeed() bool {
+	public := ref.Visibility == "" || ref.Visibility == models.VisibilityPublic
+	return public && ref.DeletedAt == nil && !ref.UploadedAt.After(time.Now())
+}
+
+// GetImageRef loads the key columns of an image from images_by_id.
+func GetImageRef(imageID gocql.UUID) (*ImageRef, error) {
+	ref := ImageRef{ImageID: imageID}
+	err := GetSession().Query(`
+		SELECT user_id, day_bucket, uploaded_at, visibility, deleted_at, tags FROM images_by_id WHERE image_id = ?`,
+		imageID,
+	).Scan(&ref.UserID, &ref.DayBucket, &ref.UploadedAt, &ref.Visibility, &ref.DeletedAt, &ref.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// UpdateImageColumns sets the given columns on every copy of an image.
+// images_by_date and images_by_user are updated with IF EXISTS so an image
+// missing from a table (e.g. not shown in the feed) is not recreated there
+// as a partial row.
+func UpdateImageColumns(ref ImageRef, columns map[string]interface{}) error {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	setParts := make([]string, 0, len(names))
+	values := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		setParts = append(setParts, name+" = ?")
+		values = append(values, columns[name])
+	}
+	set := strings.Join(setParts, ", ")
+
+	if err := GetSession().Query(`UPDATE images_by_id SET `+set+` WHERE image_id = ?`,
+		append(values, ref.ImageID)...).Exec(); err != nil {
+		return err
+	}
+	m := map[string]interface{}{}
+	if _, err := GetSession().Query(`UPDATE images_by_date SET `+set+` WHERE day_bucket = ? AND uploaded_at = ? AND image_id = ? IF EXISTS`,
+		append(values, ref.DayBucket, ref.UploadedAt, ref.ImageID)...).MapScanCAS(m); err != nil {
+		return err
+	}
+	m = map[string]interface{}{}
+	if _, err := GetSession().Query(`UPDATE images_by_user SET `+set+` WHERE user_id = ? AND uploaded_at = ? AND image_id = ? IF EXISTS`,
+		append(values, ref.UserID, ref.UploadedAt, ref.ImageID)...).MapScanCAS(m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddImageToFeed copies an image from images_by_id into images_by_date and
+// images_by_tag so it shows up in the global feed and its tag feeds.
+func AddImageToFeed(imageID gocql.UUID) error {
+	var (
+		dayBucket, username, profilePictureURL, imageURL, title   string
+		description, altText, blurHash, dominantColor, visibility string
+		uploadedAt                                                time.Time
+		editedAt                                                  *time.Time
+		userID                                                    gocql.UUID
+		itemCount                                                 int
+		tags                                                      []string
+	)
+	if err := GetSession().Query(`
+		SELECT day_bucket, uploaded_at, user_id, username, user_profile_picture_url, image_url, title,
+		       description, alt_text, edited_at, blurhash, dominant_color, item_count, visibility, tags
+		FROM images_by_id WHERE image_id = ?`,
+		imageID,
+	).Scan(&dayBucket, &uploadedAt, &userID, &username, &profilePictureURL, &imageURL, &title,
+		&description, &altText, &editedAt, &blurHash, &dominantColor, &itemCount, &visibility, &tags); err != nil {
+		return err
+	}
+	if err := AddImageToTags(imageID, userID, uploadedAt, tags); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		INSERT INTO images_by_date (day_bucket, uploaded_at, image_id, user_id, username, user_profile_picture_url, image_url, title,
+		                            description, alt_text, edited_at, blurhash, dominant_color, item_count, visibility)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		dayBucket, uploadedAt, imageID, userID, username, profilePictureURL, imageURL, title,
+		description, altText, editedAt, blurHash, dominantColor, itemCount, visibility,
+	).Exec()
+}
+
+// RemoveImageFromFeed deletes an image from images_by_date and images_by_tag.
+func RemoveImageFromFeed(ref ImageRef) error {
+	if err := RemoveImageFromTags(ref); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		DELETE FROM images_by_date WHERE day_bucket = ? AND uploaded_at = ? AND image_id = ?`,
+		ref.DayBucket, ref.UploadedAt, ref.ImageID,
+	).Exec()
+}
+
+// GetImagesByIDs loads images from images_by_id in the given order,
+// skipping the ones that no longer exist.
+func GetImagesByIDs(ids []gocql.UUID) ([]models.Image, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	iter := GetSession().Query(`
+		SELECT image_id, day_bucket, uploaded_at, user_id, username, image_url, title, description, alt_text,
+		       edited_at, blurhash, dominant_color, item_count, visibility, deleted_at, tags
+		FROM images_by_id WHERE image_id IN ?`,
+		ids,
+	).Iter()
+	byID := make(map[gocql.UUID]models.Image, len(ids))
+	var img models.Image
+	for iter.Scan(&img.ImageID, &img.DayBucket, &img.UploadedAt, &img.UserID, &img.Username, &img.ImageURL, &img.Title, &img.Description, &img.AltText,
+		&img.EditedAt, &img.BlurHash, &img.DominantColor, &img.ItemCount, &img.Visibility, &img.DeletedAt, &img.Tags) {
+		byID[img.ImageID] = img
+		img = models.Image{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	images := make([]models.Image, 0, len(byID))
+	for _, id := range ids {
+		if img, ok := byID[id]; ok {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// GetImageSize returns the pixel dimensions of an image's cover, or zero
+// for images uploaded before they were recorded.
+func GetImageSize(imageID gocql.UUID) (width, height int, err error) {
+	err = GetSession().Query(`SELECT width, height FROM images_by_id WHERE image_id = ?`, imageID).Scan(&width, &height)
+	return width, height, err
+}
+
+// SetImageSize records the pixel dimensions of an image's cover.
+func SetImageSize(imageID gocql.UUID, width, height int) error {
+	// IF EXISTS: no recrear como fila parcial una imagen purgada
+	_, err := GetSession().Query(`UPDATE images_by_id SET width = ?, height = ? WHERE image_id = ? IF EXISTS`,
+		width, height, imageID).MapScanCAS(map[string]interface{}{})
+	return err
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"time"
+)
+
+// AcquireLease takes or renews the named lease for holder. It returns true
+// while holder owns the lease; other holders get false until it expires.
+// Background jobs use it so that only one API replica runs them at a time.
+func AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	seconds := int(ttl.Seconds())
+	previous := map[string]interface{}{}
+	applied, err := GetSession().Query(`
+		INSERT INTO job_leases (name, holder) VALUES (?, ?) IF NOT EXISTS USING TTL ?`,
+		name, holder, seconds,
+	).MapScanCAS(previous)
+	if err != nil {
+		return false, err
+	}
+	if applied {
+		return true, nil
+	}
+	if current, _ := previous["holder"].(string); current != holder {
+		return false, nil
+	}
+	// Ya somos los dueños: renovar el TTL
+	m := map[string]interface{}{}
+	return GetSession().Query(`
+		UPDATE job_leases USING TTL ? SET holder = ? WHERE name = ? IF holder = ?`,
+		seconds, holder, name, holder,
+	).MapScanCAS(m)
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Like is a row of likes_by_image or likes_by_user.
+type Like struct {
+	ImageID gocql.UUID
+	UserID  gocql.UUID
+	LikedAt time.Time
+}
+
+// InsertLike stores a like in likes_by_image and likes_by_user.
+func InsertLike(imageID, userID gocql.UUID, likedAt time.Time) error {
+	if err := GetSession().Query(`INSERT INTO likes_by_image (image_id, user_id, liked_at) VALUES (?, ?, ?)`, imageID, userID, likedAt).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`INSERT INTO likes_by_user (user_id, liked_at, image_id) VALUES (?, ?, ?)`, userID, likedAt, imageID).Exec()
+}
+
+// DeleteLike removes a like from both tables. It reports false if there
+// was no like to remove.
+func DeleteLike(imageID, userID gocql.UUID) (bool, error) {
+	var likedAt time.Time
+	err := GetSession().Query(`SELECT liked_at FROM likes_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&likedAt)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	m := map[string]interface{}{}
+	applied, err := GetSession().Query(`DELETE FROM likes_by_image WHERE image_id = ? AND user_id = ? IF EXISTS`, imageID, userID).MapScanCAS(m)
+	if err != nil || !applied {
+		return false, err
+	}
+	return true, GetSession().Query(`DELETE FROM likes_by_user WHERE user_id = ? AND liked_at = ? AND image_id = ?`, userID, likedAt, imageID).Exec()
+}
+
+// GetImageLikes returns a page of the users who liked an image. pageState
+// is the Cassandra paging state of the previous page (nil for the first);
+// the returned state is empty on the last page.
+func GetImageLikes(imageID gocql.UUID, pageState []byte, limit int) ([]Like, []byte, error) {
+	iter := GetSession().Query(`SELECT user_id, liked_at FROM likes_by_image WHERE image_id = ?`, imageID).
+		PageSize(limit).PageState(pageState).Iter()
+	likes := []Like{}
+	l := Like{ImageID: imageID}
+	for len(likes) < limit && iter.Scan(&l.UserID, &l.LikedAt) {
+		likes = append(likes, l)
+	}
+	next := iter.PageState()
+	if err := iter.Close(); err != nil {
+		return nil, nil, err
+	}
+	return likes, next, nil
+}
+
+// GetUserLikes returns up to limit images liked by a user before the given
+// time, most recent first.
+func GetUserLikes(userID gocql.UUID, before time.Time, limit int) ([]Like, error) {
+	iter := GetSession().Query(`
+		SELECT image_id, liked_at FROM likes_by_user WHERE user_id = ? AND liked_at < ? LIMIT ?`,
+		userID, before, limit,
+	).Iter()
+	likes := []Like{}
+	l := Like{UserID: userID}
+	for iter.Scan(&l.ImageID, &l.LikedAt) {
+		likes = append(likes, l)
+	}
+	return likes, iter.Close()
+}
+
+// DeleteImageLikes removes every like of an image from both tables.
+func DeleteImageLikes(imageID gocql.UUID) error {
+	iter := GetSession().Query(`SELECT user_id, liked_at FROM likes_by_image WHERE image_id = ?`, imageID).Iter()
+	var userID gocql.UUID
+	var likedAt time.Time
+	for iter.Scan(&userID, &likedAt) {
+		if err := GetSession().Query(`DELETE FROM likes_by_user WHERE user_id = ? AND liked_at = ? AND image_id = ?`, userID, likedAt, imageID).Exec(); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM likes_by_image WHERE image_id = ?`, imageID).Exec()
+}
+
+// BackfillLikesByUser copies every row of likes_by_image into likes_by_user
+// (for likes made before likes_by_user existed). It is idempotent.
+func BackfillLikesByUser() (int, error) {
+	iter := GetSession().Query(`SELECT image_id, user_id, liked_at FROM likes_by_image`).PageSize(1000).Iter()
+	var l Like
+	n := 0
+	for iter.Scan(&l.ImageID, &l.UserID, &l.LikedAt) {
+		if err := GetSession().Query(`INSERT INTO likes_by_user (user_id, liked_at, image_id) VALUES (?, ?, ?)`, l.UserID, l.LikedAt, l.ImageID).Exec(); err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Close()
+}
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// messageBucketFormat partitions messages_by_conversation by month.
+const messageBucketFormat = "2006-01"
+
+// ConversationRef holds the participants of a conversation.
+type ConversationRef struct {
+	ConversationID gocql.UUID
+	UserA          gocql.UUID // el menor de los dos user_id
+	UserB          gocql.UUID
+	CreatedAt      time.Time
+}
+
+// Other returns the participant that is not userID.
+func (ref ConversationRef) Other(userID gocql.UUID) gocql.UUID {
+	if ref.UserA == userID {
+		return ref.UserB
+	}
+	return ref.UserA
+}
+
+// Has reports whether userID takes part in the conversation.
+func (ref ConversationRef) Has(userID gocql.UUID) bool {
+	return ref.UserA == userID || ref.UserB == userID
+}
+
+// ConversationID derives the ID of the conversation between two users, so
+// each pair has exactly one (a name-based UUID, version 5).
+func ConversationID(a, b gocql.UUID) gocql.UUID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	sum := sha1.Sum(append(a.Bytes(), b.Bytes()...))
+	var id gocql.UUID
+	copy(id[:], sum[:16])
+	id[6] = (id[6] & 0x0f) | 0x50
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id
+}
+
+// StartConversation creates the conversation between userID and otherID
+// if it does not exist yet and adds it to userID's list; the other user
+// sees it once a message arrives. It reports whether it was created.
+func StartConversation(userID, otherID gocql.UUID, now time.Time) (*ConversationRef, bool, error) {
+	ref := ConversationRef{ConversationID: ConversationID(userID, otherID), UserA: userID, UserB: otherID, CreatedAt: now}
+	if bytes.Compare(ref.UserA[:], ref.UserB[:]) > 0 {
+		ref.UserA, ref.UserB = ref.UserB, ref.UserA
+	}
+	existing := map[string]interface{}{}
+	created, err := GetSession().Query(`
+		INSERT INTO conversations (conversation_id, user_a, user_b, created_at) VALUES (?, ?, ?, ?) IF NOT EXISTS`,
+		ref.ConversationID, ref.UserA, ref.UserB, ref.CreatedAt,
+	).MapScanCAS(existing)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		if t, ok := existing["created_at"].(time.Time); ok {
+			ref.CreatedAt = t
+		}
+	}
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user SET other_user_id = ?, created_at = ? WHERE user_id = ? AND conversation_id = ?`,
+		otherID, ref.CreatedAt, userID, ref.ConversationID,
+	).Exec(); err != nil {
+		return nil, false, err
+	}
+	// la actividad de una conversación vacía es su creación; con el timestamp
+	// de la creación, la de cualquier mensaje la pisa
+	activityID := gocql.MinTimeUUID(ref.CreatedAt)
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user USING TIMESTAMP ? SET activity_id = ? WHERE user_id = ? AND conversation_id = ?`,
+		ref.CreatedAt.UnixMicro(), activityID, userID, ref.ConversationID,
+	).Exec(); err != nil {
+		return nil, false, err
+	}
+	if err := GetSession().Query(`INSERT INTO conversations_by_user_activity (user_id, activity_id, conversation_id) VALUES (?, ?, ?)`,
+		userID, activityID, ref.ConversationID).Exec(); err != nil {
+		return nil, false, err
+	}
+	return &ref, created, nil
+}
+
+// GetConversation loads the participants of a conversation.
+func GetConversation(conversationID gocql.UUID) (*ConversationRef, error) {
+	ref := ConversationRef{ConversationID: conversationID}
+	err := GetSession().Query(`SELECT user_a, user_b, created_at FROM conversations WHERE conversation_id = ?`,
+		conversationID).Scan(&ref.UserA, &ref.UserB, &ref.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// InsertMessage stores a message and makes it the last message of the
+// conversation for both participants. The sender has read it.
+func InsertMessage(ref ConversationRef, m models.Message) error {
+	recipientID := ref.Other(m.SenderID)
+	previous := map[gocql.UUID]*gocql.UUID{}
+	for _, userID := range []gocql.UUID{m.SenderID, recipientID} {
+		var activityID *gocql.UUID
+		if err := GetSession().Query(`SELECT activity_id FROM conversations_by_user WHERE user_id = ? AND conversation_id = ?`,
+			userID, ref.ConversationID).Scan(&activityID); err != nil && err != gocql.ErrNotFound {
+			return err
+		}
+		previous[userID] = activityID
+	}
+	if err := GetSession().Query(`
+		INSERT INTO messages_by_conversation (conversation_id, bucket, message_id, sender_id, body, image_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		ref.ConversationID, m.CreatedAt.UTC().Format(messageBucketFormat), m.MessageID, m.SenderID, m.Body, m.ImageID,
+	).Exec(); err != nil {
+		return err
+	}
+	// con la fecha del mensaje como timestamp, un mensaje anterior que llegue
+	// tarde no pisa al último
+	ts := m.CreatedAt.UnixMicro()
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user USING TIMESTAMP ?
+		SET other_user_id = ?, created_at = ?, last_message_id = ?, last_sender_id = ?, last_body = ?, last_image_id = ?, last_read_id = ?, activity_id = ?
+		WHERE user_id = ? AND conversation_id = ?`,
+		ts, recipientID, ref.CreatedAt, m.MessageID, m.SenderID, m.Body, m.ImageID, m.MessageID, m.MessageID, m.SenderID, ref.ConversationID,
+	).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user USING TIMESTAMP ?
+		SET other_user_id = ?, created_at = ?, last_message_id = ?, last_sender_id = ?, last_body = ?, last_image_id = ?, other_read_id = ?, activity_id = ?
+		WHERE user_id = ? AND conversation_id = ?`,
+		ts, m.SenderID, ref.CreatedAt, m.MessageID, m.SenderID, m.Body, m.ImageID, m.MessageID, m.MessageID, recipientID, ref.ConversationID,
+	).Exec(); err != nil {
+		return err
+	}
+	for userID, activityID := range previous {
+		if err := moveActivity(userID, ref.ConversationID, activityID, m.MessageID); err != nil {
+			return err
+		}
+	}
+	// leer hasta un mensaje borra la marca con su timestamp, así que solo la
+	// pisa un mensaje posterior
+	if err := GetSession().Query(`
+		INSERT INTO unread_conversations (user_id, conversation_id, other_user_id) VALUES (?, ?, ?) USING TIMESTAMP ?`,
+		recipientID, ref.ConversationID, m.SenderID, ts,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM unread_conversations USING TIMESTAMP ? WHERE user_id = ? AND conversation_id = ?`,
+		ts, m.SenderID, ref.ConversationID).Exec()
+}
+
+// moveActivity files a conversation of userID under activityID in
+// conversations_by_user_activity and drops its previous entry, unless the
+// previous one is newer (a message that arrived late).
+func moveActivity(userID, conversationID gocql.UUID, previous *gocql.UUID, activityID gocql.UUID) error {
+	if previous != nil && *previous != activityID && previous.Time().After(activityID.Time()) {
+		return nil
+	}
+	if err := GetSession().Query(`INSERT INTO conversations_by_user_activity (user_id, activity_id, conversation_id) VALUES (?, ?, ?)`,
+		userID, activityID, conversationID).Exec(); err != nil {
+		return err
+	}
+	if previous == nil || *previous == activityID {
+		return nil
+	}
+	return GetSession().Query(`DELETE FROM conversations_by_user_activity WHERE user_id = ? AND activity_id = ? AND conversation_id = ?`,
+		userID, *previous, conversationID).Exec()
+}
+
+// GetMessages returns up to limit messages of a conversation, newest
+// first, starting after the cursor (a message_id) when given. It walks the
+// monthly buckets back to the creation of the conversation.
+func GetMessages(ref ConversationRef, cursor *gocql.UUID, limit int) ([]models.Message, error) {
+	start := time.Now().UTC()
+	if cursor != nil {
+		start = cursor.Time().UTC()
+	}
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	first := time.Date(ref.CreatedAt.Year(), ref.CreatedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+	messages := []models.Message{}
+	for ; !month.Before(first) && len(messages) < limit; month = month.AddDate(0, -1, 0) {
+		bucket := month.Format(messageBucketFormat)
+		var iter *gocql.Iter
+		if cursor != nil {
+			iter = GetSession().Query(`
+				SELECT message_id, sender_id, body, image_id FROM messages_by_conversation
+				WHERE conversation_id = ? AND bucket = ? AND message_id < ? LIMIT ?`,
+				ref.ConversationID, bucket, *cursor, limit-len(messages)).Iter()
+		} else {
+			iter = GetSession().Query(`
+				SELECT message_id, sender_id, body, image_id FROM messages_by_conversation
+				WHERE conversation_id = ? AND bucket = ? LIMIT ?`,
+				ref.ConversationID, bucket, limit-len(messages)).Iter()
+		}
+		var m models.Message
+		for iter.Scan(&m.MessageID, &m.SenderID, &m.Body, &m.ImageID) {
+			m.ConversationID = ref.ConversationID
+			m.CreatedAt = m.MessageID.Time().UTC()
+			messages = append(messages, m)
+			m = models.Message{}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// UserConversation is a row of a user's conversation list.
+type UserConversation struct {
+	ConversationID gocql.UUID
+	OtherUserID    gocql.UUID
+	CreatedAt      time.Time
+	LastMessage    *models.Message
+	LastReadID     *gocql.UUID // último mensaje leído por el usuario
+	OtherReadID    *gocql.UUID // último mensaje leído por el otro
+	ActivityID     *gocql.UUID // entrada en conversations_by_user_activity
+}
+
+// UpdatedAt is the time of the last message, or the creation of an empty
+// conversation.
+func (uc UserConversation) UpdatedAt() time.Time {
+	if uc.LastMessage != nil {
+		return uc.LastMessage.CreatedAt
+	}
+	return uc.CreatedAt
+}
+
+// Unread reports whether the other user sent a message userID has not read.
+func (uc UserConversation) Unread(userID gocql.UUID) bool {
+	if uc.LastMessage == nil || uc.LastMessage.SenderID == userID {
+		return false
+	}
+	return uc.LastReadID == nil || uc.LastReadID.Time().Before(uc.LastMessage.CreatedAt)
+}
+
+const userConversationColumns = `conversation_id, other_user_id, created_at, last_message_id, last_sender_id, last_body, last_image_id, last_read_id, other_read_id, activity_id`
+
+func scanUserConversation(scan func(...interface{}) bool) (UserConversation, bool) {
+	var uc UserConversation
+	var lastID, lastSender, lastImage *gocql.UUID
+	var lastBody string
+	if !scan(&uc.ConversationID, &uc.OtherUserID, &uc.CreatedAt, &lastID, &lastSender, &lastBody, &lastImage, &uc.LastReadID, &uc.OtherReadID, &uc.ActivityID) {
+		return uc, false
+	}
+	if lastID != nil && lastSender != nil {
+		uc.LastMessage = &models.Message{
+			MessageID:      *lastID,
+			ConversationID: uc.ConversationID,
+			SenderID:       *lastSender,
+			Body:           lastBody,
+			ImageID:        lastImage,
+			CreatedAt:      lastID.Time().UTC(),
+		}
+	}
+	return uc, true
+}
+
+// GetUserConversations returns up to limit conversations of a user with
+// activity before the given time, most recent first, walking
+// conversations_by_user_activity. Conversations keep rejects (e.g. with
+// blocked users) do not shorten the page.
+func GetUserConversations(userID gocql.UUID, before time.Time, limit int, keep func(UserConversation) bool) ([]UserConversation, error) {
+	type entry struct{ activityID, conversationID gocql.UUID }
+	cursor := gocql.MinTimeUUID(before)
+	page := []UserConversation{}
+	for len(page) < limit {
+		iter := GetSession().Query(`
+			SELECT activity_id, conversation_id FROM conversations_by_user_activity WHERE user_id = ? AND activity_id < ? LIMIT ?`,
+			userID, cursor, limit).Iter()
+		var entries []entry
+		var e entry
+		for iter.Scan(&e.activityID, &e.conversationID) {
+			entries = append(entries, e)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		ids := make([]gocql.UUID, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.conversationID)
+		}
+		rows := map[gocql.UUID]UserConversation{}
+		iter = GetSession().Query(`SELECT `+userConversationColumns+` FROM conversations_by_user WHERE user_id = ? AND conversation_id IN ?`,
+			userID, ids).Iter()
+		for {
+			uc, ok := scanUserConversation(iter.Scan)
+			if !ok {
+				break
+			}
+			rows[uc.ConversationID] = uc
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			uc, ok := rows[e.conversationID]
+			if !ok || uc.ActivityID == nil || *uc.ActivityID != e.activityID {
+				// entrada antigua que quedó tras una carrera: se descarta
+				if ok && uc.ActivityID != nil && uc.ActivityID.Time().After(e.activityID.Time()) {
+					if err := GetSession().Query(`DELETE FROM conversations_by_user_activity WHERE user_id = ? AND activity_id = ? AND conversation_id = ?`,
+						userID, e.activityID, e.conversationID).Exec(); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			if !keep(uc) {
+				continue
+			}
+			page = append(page, uc)
+			if len(page) == limit {
+				break
+			}
+		}
+		if len(entries) < limit {
+			break
+		}
+		cursor = entries[len(entries)-1].activityID
+	}
+	return page, nil
+}
+
+// GetUnreadConversations returns the conversations where userID has unread
+// messages, with the other user of each one.
+func GetUnreadConversations(userID gocql.UUID) (map[gocql.UUID]gocql.UUID, error) {
+	iter := GetSession().Query(`SELECT conversation_id, other_user_id FROM unread_conversations WHERE user_id = ?`, userID).Iter()
+	unread := map[gocql.UUID]gocql.UUID{}
+	var conversationID, otherID gocql.UUID
+	for iter.Scan(&conversationID, &otherID) {
+		unread[conversationID] = otherID
+	}
+	return unread, iter.Close()
+}
+
+// GetUserConversation returns a conversation of a user's list.
+func GetUserConversation(userID, conversationID gocql.UUID) (*UserConversation, error) {
+	iter := GetSession().Query(`SELECT `+userConversationColumns+` FROM conversations_by_user WHERE user_id = ? AND conversation_id = ?`,
+		userID, conversationID).Iter()
+	uc, found := scanUserConversation(iter.Scan)
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, gocql.ErrNotFound
+	}
+	return &uc, nil
+}
+
+// MarkConversationRead records that userID read the conversation up to
+// messageID, for themselves and for the other user's read receipts.
+func MarkConversationRead(ref ConversationRef, userID, messageID gocql.UUID) error {
+	// mismo reloj que InsertMessage (USING TIMESTAMP)
+	ts := time.Now().UnixMicro()
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user USING TIMESTAMP ? SET last_read_id = ? WHERE user_id = ? AND conversation_id = ?`,
+		ts, messageID, userID, ref.ConversationID,
+	).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`
+		UPDATE conversations_by_user USING TIMESTAMP ? SET other_read_id = ? WHERE user_id = ? AND conversation_id = ?`,
+		ts, messageID, ref.Other(userID), ref.ConversationID,
+	).Exec(); err != nil {
+		return err
+	}
+	// con el timestamp del mensaje leído: los mensajes posteriores siguen sin leer
+	return GetSession().Query(`DELETE FROM unread_conversations USING TIMESTAMP ? WHERE user_id = ? AND conversation_id = ?`,
+		messageID.Time().UnixMicro(), userID, ref.ConversationID).Exec()
+}
+
+// BackfillConversationActivity fills activity_id, conversations_by_user_activity
+// and unread_conversations from conversations_by_user (for conversations
+// started before they existed). It is idempotent.
+func BackfillConversationActivity() (int, error) {
+	iter := GetSession().Query(`SELECT user_id, ` + userConversationColumns + ` FROM conversations_by_user`).PageSize(1000).Iter()
+	n := 0
+	for {
+		var userID gocql.UUID
+		uc, ok := scanUserConversation(func(dest ...interface{}) bool {
+			return iter.Scan(append([]interface{}{&userID}, dest...)...)
+		})
+		if !ok {
+			break
+		}
+		activityID := gocql.MinTimeUUID(uc.CreatedAt)
+		if uc.LastMessage != nil {
+			activityID = uc.LastMessage.MessageID
+		}
+		ts := activityID.Time().UnixMicro()
+		err := GetSession().Query(`UPDATE conversations_by_user USING TIMESTAMP ? SET activity_id = ? WHERE user_id = ? AND conversation_id = ?`,
+			ts, activityID, userID, uc.ConversationID).Exec()
+		if err == nil {
+			err = GetSession().Query(`INSERT INTO conversations_by_user_activity (user_id, activity_id, conversation_id) VALUES (?, ?, ?)`,
+				userID, activityID, uc.ConversationID).Exec()
+		}
+		if err == nil && uc.Unread(userID) {
+			err = GetSession().Query(`INSERT INTO unread_conversations (user_id, conversation_id, other_user_id) VALUES (?, ?, ?) USING TIMESTAMP ?`,
+				userID, uc.ConversationID, uc.OtherUserID, ts).Exec()
+		}
+		if err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Close()
+}
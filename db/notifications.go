@@ -0,0 +1,172 @@
+package db
+
+import (
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// notificationTTL is how long notifications are kept (seconds).
+const notificationTTL = 90 * 24 * 60 * 60
+
+// maxUnreadCount caps the unread count (clients show "99+").
+const maxUnreadCount = 100
+
+// InsertNotification stores a notification for userID unless they turned
+// that type off. It reports whether it was stored.
+func InsertNotification(userID gocql.UUID, n *models.Notification) (bool, error) {
+	enabled, err := notificationEnabled(userID, n.Type)
+	if err != nil || !enabled {
+		return false, err
+	}
+	n.NotificationID = gocql.TimeUUID()
+	n.CreatedAt = n.NotificationID.Time().UTC()
+	return true, GetSession().Query(`
+		INSERT INTO notifications_by_user (user_id, notification_id, type, actor_id, image_id, comment_id, message, read)
+		VALUES (?, ?, ?, ?, ?, ?, ?, false) USING TTL ?`,
+		userID, n.NotificationID, n.Type, n.ActorID, n.ImageID, n.CommentID, n.Message, notificationTTL,
+	).Exec()
+}
+
+// FirstLikeNotification reports whether actorID's like of imageID has not
+// been notified yet, and records it. Liking, unliking and liking again
+// only notifies the owner once.
+func FirstLikeNotification(imageID, actorID gocql.UUID) (bool, error) {
+	var seen gocql.UUID
+	err := GetSession().Query(`SELECT actor_id FROM like_notifications WHERE image_id = ? AND actor_id = ?`, imageID, actorID).Scan(&seen)
+	if err == nil {
+		return false, nil
+	}
+	if err != gocql.ErrNotFound {
+		return false, err
+	}
+	return true, GetSession().Query(`INSERT INTO like_notifications (image_id, actor_id) VALUES (?, ?) USING TTL ?`,
+		imageID, actorID, notificationTTL).Exec()
+}
+
+// GetNotifications returns up to limit notifications of a user, newest
+// first, starting after the cursor (a notification_id) when given.
+// Notifications older than the read-all mark are returned as read.
+func GetNotifications(userID gocql.UUID, cursor *gocql.UUID, limit int) ([]models.Notification, error) {
+	readAllAt, err := getReadAllMark(userID)
+	if err != nil {
+		return nil, err
+	}
+	var iter *gocql.Iter
+	if cursor != nil {
+		iter = GetSession().Query(`
+			SELECT notification_id, type, actor_id, image_id, comment_id, message, read FROM notifications_by_user
+			WHERE user_id = ? AND notification_id < ? LIMIT ?`, userID, *cursor, limit).Iter()
+	} else {
+		iter = GetSession().Query(`
+			SELECT notification_id, type, actor_id, image_id, comment_id, message, read FROM notifications_by_user
+			WHERE user_id = ? LIMIT ?`, userID, limit).Iter()
+	}
+	notifications := []models.Notification{}
+	var n models.Notification
+	for iter.Scan(&n.NotificationID, &n.Type, &n.ActorID, &n.ImageID, &n.CommentID, &n.Message, &n.Read) {
+		n.CreatedAt = n.NotificationID.Time().UTC()
+		n.Read = n.Read || !n.CreatedAt.After(readAllAt)
+		notifications = append(notifications, n)
+		n = models.Notification{}
+	}
+	return notifications, iter.Close()
+}
+
+// CountUnreadNotifications counts the unread notifications of a user newer
+// than their read-all mark, up to maxUnreadCount.
+func CountUnreadNotifications(userID gocql.UUID) (int, error) {
+	readAllAt, err := getReadAllMark(userID)
+	if err != nil {
+		return 0, err
+	}
+	// se miran como mucho 2*maxUnreadCount filas
+	var iter *gocql.Iter
+	if readAllAt.IsZero() {
+		iter = GetSession().Query(`
+			SELECT read FROM notifications_by_user WHERE user_id = ? LIMIT ?`,
+			userID, maxUnreadCount*2).Iter()
+	} else {
+		iter = GetSession().Query(`
+			SELECT read FROM notifications_by_user WHERE user_id = ? AND notification_id > maxTimeuuid(?) LIMIT ?`,
+			userID, readAllAt, maxUnreadCount*2).Iter()
+	}
+	unread := 0
+	var read bool
+	for unread < maxUnreadCount && iter.Scan(&read) {
+		if !read {
+			unread++
+		}
+	}
+	return unread, iter.Close()
+}
+
+// MarkNotificationRead marks one notification as read. It reports false if
+// the notification does not exist (or expired).
+func MarkNotificationRead(userID, notificationID gocql.UUID) (bool, error) {
+	var ttl int
+	err := GetSession().Query(`SELECT TTL(type) FROM notifications_by_user WHERE user_id = ? AND notification_id = ?`, userID, notificationID).Scan(&ttl)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if ttl < 1 {
+		ttl = 1
+	}
+	// mismo TTL que el resto de la fila para no dejar filas parciales al expirar
+	m := map[string]interface{}{}
+	return GetSession().Query(`
+		UPDATE notifications_by_user USING TTL ? SET read = true WHERE user_id = ? AND notification_id = ? IF EXISTS`,
+		ttl, userID, notificationID).MapScanCAS(m)
+}
+
+// MarkAllNotificationsRead marks every current notification of a user as
+// read. Older rows keep read = false but no longer count as unread.
+func MarkAllNotificationsRead(userID gocql.UUID, at time.Time) error {
+	return GetSession().Query(`INSERT INTO notification_state (user_id, read_all_at) VALUES (?, ?)`, userID, at).Exec()
+}
+
+// getReadAllMark returns when the user last marked everything as read.
+func getReadAllMark(userID gocql.UUID) (time.Time, error) {
+	var readAllAt time.Time
+	err := GetSession().Query(`SELECT read_all_at FROM notification_state WHERE user_id = ?`, userID).Scan(&readAllAt)
+	if err == gocql.ErrNotFound {
+		return time.Time{}, nil
+	}
+	return readAllAt, err
+}
+
+// GetNotificationPrefs returns whether each notification type is enabled
+// for a user (all of them by default).
+func GetNotificationPrefs(userID gocql.UUID) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(models.NotificationTypes))
+	for _, t := range models.NotificationTypes {
+		prefs[t] = true
+	}
+	iter := GetSession().Query(`SELECT type, enabled FROM notification_prefs WHERE user_id = ?`, userID).Iter()
+	var t string
+	var enabled bool
+	for iter.Scan(&t, &enabled) {
+		if _, ok := prefs[t]; ok {
+			prefs[t] = enabled
+		}
+	}
+	return prefs, iter.Close()
+}
+
+// SetNotificationPref turns a notification type on or off for a user.
+func SetNotificationPref(userID gocql.UUID, notificationType string, enabled bool) error {
+	return GetSession().Query(`INSERT INTO notification_prefs (user_id, type, enabled) VALUES (?, ?, ?)`, userID, notificationType, enabled).Exec()
+}
+
+func notificationEnabled(userID gocql.UUID, notificationType string) (bool, error) {
+	var enabled bool
+	err := GetSession().Query(`SELECT enabled FROM notification_prefs WHERE user_id = ? AND type = ?`, userID, notificationType).Scan(&enabled)
+	if err == gocql.ErrNotFound {
+		return true, nil
+	}
+	return enabled, err
+}
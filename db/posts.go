@@ -0,0 +1,60 @@
+package db
+
+import (
+	"osohub/models"
+
+	"github.com/gocql/gocql"
+)
+
+// InsertPostItems stores the ordered images of a gallery post.
+func InsertPostItems(postID gocql.UUID, items []models.PostItem) error {
+	for _, item := range items {
+		var phash *int64
+		if item.Hashed {
+			h := int64(item.PHash)
+			phash = &h
+		}
+		if err := GetSession().Query(`
+			INSERT INTO post_items (post_id, position, image_url, caption, alt_text, blurhash, dominant_color, phash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			postID, item.Position, item.ImageURL, item.Caption, item.AltText, item.BlurHash, item.DominantColor, phash,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPostItems returns the images of a gallery post in order.
+func GetPostItems(postID gocql.UUID) ([]models.PostItem, error) {
+	iter := GetSession().Query(`
+		SELECT position, image_url, caption, alt_text, blurhash, dominant_color FROM post_items WHERE post_id = ?`,
+		postID,
+	).Iter()
+	var items []models.PostItem
+	var item models.PostItem
+	for iter.Scan(&item.Position, &item.ImageURL, &item.Caption, &item.AltText, &item.BlurHash, &item.DominantColor) {
+		items = append(items, item)
+	}
+	return items, iter.Close()
+}
+
+// GetPostItemHashes returns the perceptual hashes of the images of a
+// gallery post (rows stored before hashes were kept have none).
+func GetPostItemHashes(postID gocql.UUID) ([]uint64, error) {
+	iter := GetSession().Query(`SELECT phash FROM post_items WHERE post_id = ?`, postID).Iter()
+	var hashes []uint64
+	var phash *int64
+	for iter.Scan(&phash) {
+		if phash != nil {
+			hashes = append(hashes, uint64(*phash))
+		}
+		phash = nil
+	}
+	return hashes, iter.Close()
+}
+
+// DeletePostItems removes every image of a gallery post.
+func DeletePostItems(postID gocql.UUID) error {
+	return GetSession().Query(`DELETE FROM post_items WHERE post_id = ?`, postID).Exec()
+}
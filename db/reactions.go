@@ -0,0 +1,173 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ReactionHeart is the reaction behind the like endpoints. Hearts are also
+// stored in likes_by_image and counted in image_counters.likes, so likes
+// and hearts are always the same thing.
+const ReactionHeart = "heart"
+
+// ErrReactionConflict is returned when the user's reaction changed
+// concurrently to a different one; the request can simply be retried. A
+// concurrent request that made the same change (e.g. a double-tap like) is
+// not a conflict.
+var ErrReactionConflict = errors.New("reaction changed concurrently")
+
+// GetUserReaction returns the user's reaction to an image, or "" if none.
+// Likes from before reactions existed only live in likes_by_image.
+func GetUserReaction(imageID, userID gocql.UUID) (string, error) {
+	var reaction string
+	err := GetSession().Query(`SELECT reaction FROM reactions_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&reaction)
+	if err == nil {
+		return reaction, nil
+	}
+	if err != gocql.ErrNotFound {
+		return "", err
+	}
+	var likedAt time.Time
+	err = GetSession().Query(`SELECT liked_at FROM likes_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&likedAt)
+	if err == nil {
+		return ReactionHeart, nil
+	}
+	if err == gocql.ErrNotFound {
+		return "", nil
+	}
+	return "", err
+}
+
+// SetReaction sets (or switches) the user's reaction to an image and
+// reports whether it changed. The swap is a lightweight transaction on the
+// previous value, so concurrent requests never count a reaction twice.
+func SetReaction(imageID, userID gocql.UUID, reaction string) (bool, error) {
+	previous, err := GetUserReaction(imageID, userID)
+	if err != nil {
+		return false, err
+	}
+	if previous == reaction {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	m := map[string]interface{}{}
+	var applied bool
+	if previous == "" || !reactionRowExists(imageID, userID) {
+		applied, err = GetSession().Query(`
+			INSERT INTO reactions_by_image (image_id, user_id, reaction, reacted_at) VALUES (?, ?, ?, ?) IF NOT EXISTS`,
+			imageID, userID, reaction, now).MapScanCAS(m)
+	} else {
+		applied, err = GetSession().Query(`
+			UPDATE reactions_by_image SET reaction = ?, reacted_at = ? WHERE image_id = ? AND user_id = ? IF reaction = ?`,
+			reaction, now, imageID, userID, previous).MapScanCAS(m)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !applied {
+		// otra petición ya dejó esta misma reacción: no hay nada que cambiar
+		if current, _ := m["reaction"].(string); current == reaction {
+			return false, nil
+		}
+		return false, ErrReactionConflict
+	}
+	if err := countReaction(imageID, userID, previous, -1, now); err != nil {
+		return true, err
+	}
+	return true, countReaction(imageID, userID, reaction, 1, now)
+}
+
+// RemoveReaction removes the user's reaction. With only set, the reaction
+// is removed only if it is that one (e.g. unliking keeps a "wow").
+func RemoveReaction(imageID, userID gocql.UUID, only string) error {
+	previous, err := GetUserReaction(imageID, userID)
+	if err != nil {
+		return err
+	}
+	if previous == "" || (only != "" && previous != only) {
+		return nil
+	}
+	m := map[string]interface{}{}
+	if reactionRowExists(imageID, userID) {
+		applied, err := GetSession().Query(`
+			DELETE FROM reactions_by_image WHERE image_id = ? AND user_id = ? IF reaction = ?`,
+			imageID, userID, previous).MapScanCAS(m)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			// ya la quitó otra petición, o ahora es otra que no se debe quitar
+			current, _ := m["reaction"].(string)
+			if current == "" || (only != "" && current != only) {
+				return nil
+			}
+			return ErrReactionConflict
+		}
+	}
+	return countReaction(imageID, userID, previous, -1, time.Now().UTC())
+}
+
+func reactionRowExists(imageID, userID gocql.UUID) bool {
+	var reaction string
+	return GetSession().Query(`SELECT reaction FROM reactions_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&reaction) == nil
+}
+
+// countReaction adds delta to a reaction's counter. Hearts also add or
+// remove the like.
+func countReaction(imageID, userID gocql.UUID, reaction string, delta int64, at time.Time) error {
+	switch reaction {
+	case "":
+		return nil
+	case ReactionHeart:
+		if delta > 0 {
+			if err := InsertLike(imageID, userID, at); err != nil {
+				return err
+			}
+		} else {
+			removed, err := DeleteLike(imageID, userID)
+			if err != nil || !removed {
+				return err // ya no había like: no descontar
+			}
+		}
+		if err := GetSession().Query(`UPDATE image_counters SET likes = likes + ? WHERE image_id = ?`, delta, imageID).Exec(); err != nil {
+			return err
+		}
+		return countHourly(imageID, StatLikes, delta, at)
+	default:
+		return GetSession().Query(`UPDATE reaction_counters SET total = total + ? WHERE image_id = ? AND reaction = ?`, delta, imageID, reaction).Exec()
+	}
+}
+
+// GetReactionCounts returns the number of each reaction on an image.
+func GetReactionCounts(imageID gocql.UUID) (map[string]int64, error) {
+	counts := map[string]int64{}
+	iter := GetSession().Query(`SELECT reaction, total FROM reaction_counters WHERE image_id = ?`, imageID).Iter()
+	var reaction string
+	var count int64
+	for iter.Scan(&reaction, &count) {
+		if count > 0 {
+			counts[reaction] = count
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	var likes int64
+	if err := GetSession().Query(`SELECT likes FROM image_counters WHERE image_id = ?`, imageID).Scan(&likes); err != nil && err != gocql.ErrNotFound {
+		return nil, err
+	}
+	if likes > 0 {
+		counts[ReactionHeart] = likes
+	}
+	return counts, nil
+}
+
+// DeleteImageReactions deletes every reaction of an image.
+func DeleteImageReactions(imageID gocql.UUID) error {
+	if err := GetSession().Query(`DELETE FROM reactions_by_image WHERE image_id = ?`, imageID).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM reaction_counters WHERE image_id = ?`, imageID).Exec()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"hash/crc32"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// realtimeEventTTL is how long a relayed event is kept (seconds).
+const realtimeEventTTL = 60 * 60
+
+// realtimeEventBucketFormat partitions realtime_events by minute.
+const realtimeEventBucketFormat = "2006-01-02T15:04"
+
+// realtimeEventShards splits each minute of realtime_events by topic, so a
+// single partition does not take every write.
+const realtimeEventShards = 8
+
+// RealtimeEvent is an event published on one process, for the open streams
+// of every API process. Payload is the JSON of the event data.
+type RealtimeEvent struct {
+	EventID gocql.UUID
+	Topic   string
+	Type    string
+	Payload []byte
+}
+
+func realtimeEventShard(topic string) int {
+	return int(crc32.ChecksumIEEE([]byte(topic)) % realtimeEventShards)
+}
+
+// AnnounceRealtimeEvent records an event of a topic for every process.
+func AnnounceRealtimeEvent(topic, eventType string, payload []byte) error {
+	id := gocql.TimeUUID()
+	return GetSession().Query(`
+		INSERT INTO realtime_events (bucket, shard, event_id, topic, type, payload) VALUES (?, ?, ?, ?, ?, ?) USING TTL ?`,
+		id.Time().UTC().Format(realtimeEventBucketFormat), realtimeEventShard(topic), id, topic, eventType, string(payload), realtimeEventTTL,
+	).Exec()
+}
+
+// GetRealtimeEvents returns the events announced after since, the oldest
+// first.
+func GetRealtimeEvents(since, now time.Time) ([]RealtimeEvent, error) {
+	events := []RealtimeEvent{}
+	from := gocql.MinTimeUUID(since)
+	for bucket := since.UTC().Truncate(time.Minute); !bucket.After(now); bucket = bucket.Add(time.Minute) {
+		for shard := 0; shard < realtimeEventShards; shard++ {
+			iter := GetSession().Query(`
+				SELECT event_id, topic, type, payload FROM realtime_events WHERE bucket = ? AND shard = ? AND event_id > ?`,
+				bucket.Format(realtimeEventBucketFormat), shard, from,
+			).Iter()
+			var e RealtimeEvent
+			var payload string
+			for iter.Scan(&e.EventID, &e.Topic, &e.Type, &payload) {
+				e.Payload = []byte(payload)
+				events = append(events, e)
+			}
+			if err := iter.Close(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EventID.Time().Before(events[j].EventID.Time()) })
+	return events, nil
+}
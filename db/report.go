@@ -27,10 +27,17 @@ func InsertReport(reportID, imageID, userID, reason string, createdAt time.Time)
 }
 
 func IncrementImageReportCounter(imageID string) error {
-	return GetSession().Query(`
+	imgUUID, err := gocql.ParseUUID(imageID)
+	if err != nil {
+		return err
+	}
+	if err := GetSession().Query(`
 		UPDATE image_counters SET reports = reports + 1 WHERE image_id = ?`,
-		imageID,
-	).Exec()
+		imgUUID,
+	).Exec(); err != nil {
+		return err
+	}
+	return countHourly(imgUUID, StatReports, 1, time.Now())
 }
 
 func GetReportsByImage(imageID string) ([]map[string]interface{}, error) {
@@ -55,3 +62,18 @@ func GetImageReportCount(imageID string) (int, error) {
 	).Scan(&count)
 	return count, err
 }
+
+// GetImageReporters returns the users who reported an image, once each.
+func GetImageReporters(imageID gocql.UUID) ([]gocql.UUID, error) {
+	iter := GetSession().Query(`SELECT reporter_id FROM reports_by_image WHERE image_id = ?`, imageID).Iter()
+	seen := map[gocql.UUID]bool{}
+	reporters := []gocql.UUID{}
+	var reporterID gocql.UUID
+	for iter.Scan(&reporterID) {
+		if !seen[reporterID] {
+			seen[reporterID] = true
+			reporters = append(reporters, reporterID)
+		}
+	}
+	return reporters, iter.Close()
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// scheduledBucket is the single partition of scheduled_images; rows are
+// removed once published so it stays small.
+const scheduledBucket = "pending"
+
+// ScheduledImage is an image waiting to be added to the global feed.
+type ScheduledImage struct {
+	PublishAt time.Time
+	ImageID   gocql.UUID
+}
+
+// ScheduleImage queues an image to be published at publishAt.
+func ScheduleImage(imageID gocql.UUID, publishAt time.Time) error {
+	return GetSession().Query(`
+		INSERT INTO scheduled_images (bucket, publish_at, image_id) VALUES (?, ?, ?)`,
+		scheduledBucket, publishAt, imageID,
+	).Exec()
+}
+
+// UnscheduleImage removes an image from the publishing queue.
+func UnscheduleImage(imageID gocql.UUID, publishAt time.Time) error {
+	return GetSession().Query(`
+		DELETE FROM scheduled_images WHERE bucket = ? AND publish_at = ? AND image_id = ?`,
+		scheduledBucket, publishAt, imageID,
+	).Exec()
+}
+
+// GetDueScheduledImages returns the queued images whose time has come.
+func GetDueScheduledImages(now time.Time) ([]ScheduledImage, error) {
+	iter := GetSession().Query(`
+		SELECT publish_at, image_id FROM scheduled_images WHERE bucket = ? AND publish_at <= ?`,
+		scheduledBucket, now,
+	).Iter()
+	var due []ScheduledImage
+	var s ScheduledImage
+	for iter.Scan(&s.PublishAt, &s.ImageID) {
+		due = append(due, s)
+	}
+	return due, iter.Close()
+}
+
+// PublishScheduledImage adds a due image to the global feed if it is still
+// public, then removes it from the queue. Images deleted or moved to the
+// trash in the meantime are just dropped from the queue. It returns the
+// image if it went into the feed.
+func PublishScheduledImage(s ScheduledImage) (*ImageRef, error) {
+	ref, err := GetImageRef(s.ImageID)
+	if err != nil && err != gocql.ErrNotFound {
+		return nil, err
+	}
+	if ref == nil || !ref.InFeed() {
+		return nil, UnscheduleImage(s.ImageID, s.PublishAt)
+	}
+	if err := AddImageToFeed(s.ImageID); err != nil {
+		return nil, err
+	}
+	return ref, UnscheduleImage(s.ImageID, s.PublishAt)
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Columnas de image_stats_hourly
+const (
+	StatViews    = "views"
+	StatLikes    = "likes"
+	StatReports  = "reports"
+	StatComments = "comments"
+)
+
+// statsHour is the hourly bucket of a time.
+func statsHour(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// HourlyStats are the activity of an image during one hour.
+type HourlyStats struct {
+	Hour     time.Time `json:"hour"`
+	Views    int64     `json:"views"`
+	Likes    int64     `json:"likes"` // neto: likes menos likes retirados
+	Reports  int64     `json:"reports"`
+	Comments int64     `json:"comments"` // por la hora de cada comentario; los borrados se descuentan
+}
+
+// countHourly adds delta to a stat of the hour of at. stat is one of the
+// Stat constants.
+func countHourly(imageID gocql.UUID, stat string, delta int64, at time.Time) error {
+	return GetSession().Query(`UPDATE image_stats_hourly SET `+stat+` = `+stat+` + ? WHERE image_id = ? AND hour = ?`,
+		delta, imageID, statsHour(at)).Exec()
+}
+
+// RecordView counts a view of an image unless the same viewer already
+// viewed it within window. viewerKey identifies the viewer (user or
+// anonymous client). It reports whether the view was counted. The check is
+// a plain read, not a lightweight transaction: two views racing each other
+// may both count, which is fine for a view counter.
+func RecordView(imageID gocql.UUID, viewerKey string, window time.Duration, at time.Time) (bool, error) {
+	var seen string
+	err := GetSession().Query(`SELECT viewer_key FROM image_view_dedup WHERE image_id = ? AND viewer_key = ?`, imageID, viewerKey).Scan(&seen)
+	if err == nil {
+		return false, nil
+	}
+	if err != gocql.ErrNotFound {
+		return false, err
+	}
+	if err := GetSession().Query(`INSERT INTO image_view_dedup (image_id, viewer_key) VALUES (?, ?) USING TTL ?`,
+		imageID, viewerKey, int(window.Seconds())).Exec(); err != nil {
+		return false, err
+	}
+	if err := GetSession().Query(`UPDATE image_counters SET views = views + 1 WHERE image_id = ?`, imageID).Exec(); err != nil {
+		return true, err
+	}
+	return true, countHourly(imageID, StatViews, 1, at)
+}
+
+// GetImageTotals returns the lifetime counters of an image.
+func GetImageTotals(imageID gocql.UUID) (views, likes, reports, comments int64, err error) {
+	err = GetSession().Query(`SELECT views, likes, reports, comments FROM image_counters WHERE image_id = ?`, imageID).
+		Scan(&views, &likes, &reports, &comments)
+	if err == gocql.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// GetHourlyStats returns the hours with activity of an image since the
+// given time, oldest first.
+func GetHourlyStats(imageID gocql.UUID, since time.Time) ([]HourlyStats, error) {
+	iter := GetSession().Query(`
+		SELECT hour, views, likes, reports, comments FROM image_stats_hourly WHERE image_id = ? AND hour >= ?`,
+		imageID, statsHour(since)).Iter()
+	stats := []HourlyStats{}
+	var s HourlyStats
+	for iter.Scan(&s.Hour, &s.Views, &s.Likes, &s.Reports, &s.Comments) {
+		stats = append(stats, s)
+	}
+	return stats, iter.Close()
+}
+
+// DeleteImageStats removes the hourly stats of an image (its totals go with
+// image_counters).
+func DeleteImageStats(imageID gocql.UUID) error {
+	return GetSession().Query(`DELETE FROM image_stats_hourly WHERE image_id = ?`, imageID).Exec()
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// StreamTicketTTL is how long a stream ticket can be used.
+const StreamTicketTTL = 60 * time.Second
+
+// CreateStreamTicket issues a single-use ticket that opens /stream as
+// userID with the given role.
+func CreateStreamTicket(userID, role string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(b)
+	err := GetSession().Query(`INSERT INTO stream_tickets (ticket, user_id, role) VALUES (?, ?, ?) USING TTL ?`,
+		ticket, userID, role, int(StreamTicketTTL.Seconds())).Exec()
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// ConsumeStreamTicket redeems a ticket and returns its user and role. A
+// ticket works once: ok is false if it is unknown, expired or already used.
+func ConsumeStreamTicket(ticket string) (userID, role string, ok bool, err error) {
+	err = GetSession().Query(`SELECT user_id, role FROM stream_tickets WHERE ticket = ?`, ticket).Scan(&userID, &role)
+	if err == gocql.ErrNotFound {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	// el LWT garantiza que solo una conexión canjea el ticket
+	applied, err := GetSession().Query(`DELETE FROM stream_tickets WHERE ticket = ? IF EXISTS`, ticket).MapScanCAS(map[string]interface{}{})
+	if err != nil || !applied {
+		return "", "", false, err
+	}
+	return userID, role, true, nil
+}
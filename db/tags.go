@@ -0,0 +1,171 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// maxTagMonths is how far back a tag feed walks its month buckets.
+const maxTagMonths = 24
+
+// tagMonthBucket returns the images_by_tag time bucket ('YYYY-MM') of t.
+func tagMonthBucket(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// tagHourBucket returns the tag_activity bucket ('YYYY-MM-DDTHH') of t.
+func tagHourBucket(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15")
+}
+
+// TaggedImage is a row of images_by_tag.
+type TaggedImage struct {
+	ImageID    gocql.UUID
+	UserID     gocql.UUID
+	UploadedAt time.Time
+}
+
+// TagCount is a tag with its number of uses in the trending window.
+type TagCount struct {
+	Tag  string `json:"tag"`
+	Uses int64  `json:"uses"`
+}
+
+// AddImageToTags indexes an image under each of its tags and counts the
+// uses for trending tags. Like images_by_date, images_by_tag only holds
+// published public images.
+func AddImageToTags(imageID, userID gocql.UUID, uploadedAt time.Time, tags []string) error {
+	for _, tag := range tags {
+		if err := GetSession().Query(`
+			INSERT INTO images_by_tag (tag, month_bucket, uploaded_at, image_id, user_id) VALUES (?, ?, ?, ?, ?)`,
+			tag, tagMonthBucket(uploadedAt), uploadedAt, imageID, userID,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return countTagUses(imageID, tags)
+}
+
+// countTagUses adds a use to tag_activity for the tags of an image that
+// were never counted for it, so restoring it from the trash, making it
+// public again or editing its tags does not inflate trending tags.
+func countTagUses(imageID gocql.UUID, tags []string) error {
+	iter := GetSession().Query(`SELECT tag FROM image_counted_tags WHERE image_id = ?`, imageID).Iter()
+	counted := map[string]bool{}
+	var tag string
+	for iter.Scan(&tag) {
+		counted[tag] = true
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	hour := tagHourBucket(time.Now())
+	for _, tag := range tags {
+		if counted[tag] {
+			continue
+		}
+		if err := GetSession().Query(`INSERT INTO image_counted_tags (image_id, tag) VALUES (?, ?)`, imageID, tag).Exec(); err != nil {
+			return err
+		}
+		if err := GetSession().Query(`
+			UPDATE tag_activity SET uses = uses + 1 WHERE hour_bucket = ? AND tag = ?`,
+			hour, tag,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImageCountedTags forgets which tags of an image were counted.
+func DeleteImageCountedTags(imageID gocql.UUID) error {
+	return GetSession().Query(`DELETE FROM image_counted_tags WHERE image_id = ?`, imageID).Exec()
+}
+
+// RemoveImageFromTags deletes an image from the feeds of its tags.
+func RemoveImageFromTags(ref ImageRef) error {
+	for _, tag := range ref.Tags {
+		if err := GetSession().Query(`
+			DELETE FROM images_by_tag WHERE tag = ? AND month_bucket = ? AND uploaded_at = ? AND image_id = ?`,
+			tag, tagMonthBucket(ref.UploadedAt), ref.UploadedAt, ref.ImageID,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetImageTags replaces the tags of an image, keeping images_by_tag in sync
+// when the image is in the feed.
+func SetImageTags(ref ImageRef, tags []string) error {
+	if err := GetSession().Query(`UPDATE images_by_id SET tags = ? WHERE image_id = ?`, tags, ref.ImageID).Exec(); err != nil {
+		return err
+	}
+	if !ref.InFeed() {
+		return nil
+	}
+	if err := RemoveImageFromTags(ref); err != nil {
+		return err
+	}
+	return AddImageToTags(ref.ImageID, ref.UserID, ref.UploadedAt, tags)
+}
+
+// GetImagesByTag returns up to limit images tagged with tag uploaded before
+// the given time, newest first, walking back through the month buckets.
+func GetImagesByTag(tag string, before time.Time, limit int) ([]TaggedImage, error) {
+	var images []TaggedImage
+	month := time.Date(before.Year(), before.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxTagMonths && len(images) < limit; i++ {
+		iter := GetSession().Query(`
+			SELECT image_id, user_id, uploaded_at FROM images_by_tag
+			WHERE tag = ? AND month_bucket = ? AND uploaded_at < ? LIMIT ?`,
+			tag, tagMonthBucket(month), before, limit-len(images),
+		).Iter()
+		var t TaggedImage
+		for iter.Scan(&t.ImageID, &t.UserID, &t.UploadedAt) {
+			images = append(images, t)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		month = month.AddDate(0, -1, 0)
+	}
+	return images, nil
+}
+
+// GetTrendingTags returns the most used tags over the last hours, most
+// used first.
+func GetTrendingTags(hours, limit int) ([]TagCount, error) {
+	totals := map[string]int64{}
+	now := time.Now()
+	for i := 0; i < hours; i++ {
+		iter := GetSession().Query(`
+			SELECT tag, uses FROM tag_activity WHERE hour_bucket = ?`,
+			tagHourBucket(now.Add(-time.Duration(i)*time.Hour)),
+		).Iter()
+		var tag string
+		var uses int64
+		for iter.Scan(&tag, &uses) {
+			totals[tag] += uses
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	trending := make([]TagCount, 0, len(totals))
+	for tag, uses := range totals {
+		trending = append(trending, TagCount{Tag: tag, Uses: uses})
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Uses != trending[j].Uses {
+			return trending[i].Uses > trending[j].Uses
+		}
+		return trending[i].Tag < trending[j].Tag
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+	return trending, nil
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// trashBucket is the single partition of trashed_images, the queue read by
+// the purge job.
+const trashBucket = "all"
+
+// TrashedImage is an image in a user's trash.
+type TrashedImage struct {
+	ImageID       gocql.UUID `json:"image_id"`
+	DeletedAt     time.Time  `json:"deleted_at"`
+	Title         string     `json:"title"`
+	ImageURL      string     `json:"image_url"`
+	BlurHash      string     `json:"blurhash,omitempty"`
+	DominantColor string     `json:"dominant_color,omitempty"`
+}
+
+// TrashImage moves an image to its owner's trash: it gets a deleted_at,
+// leaves the global feed and the publishing queue, and is queued for the
+// purge job. Likes and reports are kept until the image is purged.
+func TrashImage(ref ImageRef, deletedAt time.Time) error {
+	var t TrashedImage
+	if err := GetSession().Query(`
+		SELECT title, image_url, blurhash, dominant_color FROM images_by_id WHERE image_id = ?`,
+		ref.ImageID,
+	).Scan(&t.Title, &t.ImageURL, &t.BlurHash, &t.DominantColor); err != nil {
+		return err
+	}
+	if err := RemoveImageFromFeed(ref); err != nil {
+		return err
+	}
+	if err := UnscheduleImage(ref.ImageID, ref.UploadedAt); err != nil {
+		return err
+	}
+	if err := UpdateImageColumns(ref, map[string]interface{}{"deleted_at": deletedAt}); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`
+		INSERT INTO trash_by_user (user_id, deleted_at, image_id, title, image_url, blurhash, dominant_color)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ref.UserID, deletedAt, ref.ImageID, t.Title, t.ImageURL, t.BlurHash, t.DominantColor,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		INSERT INTO trashed_images (bucket, deleted_at, image_id) VALUES (?, ?, ?)`,
+		trashBucket, deletedAt, ref.ImageID,
+	).Exec()
+}
+
+// RestoreImage takes an image out of the trash and puts it back in the
+// feed (or the publishing queue) according to its visibility.
+func RestoreImage(ref ImageRef) error {
+	if ref.DeletedAt == nil {
+		return nil
+	}
+	if err := UpdateImageColumns(ref, map[string]interface{}{"deleted_at": nil}); err != nil {
+		return err
+	}
+	if ref.Visibility == "" || ref.Visibility == models.VisibilityPublic {
+		var err error
+		if ref.UploadedAt.After(time.Now()) {
+			err = ScheduleImage(ref.ImageID, ref.UploadedAt)
+		} else {
+			err = AddImageToFeed(ref.ImageID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return removeFromTrash(ref)
+}
+
+// SetRemovedByModerator marks an image as removed (or no longer removed) by
+// a moderator; its owner cannot restore it from the trash while marked.
+func SetRemovedByModerator(imageID gocql.UUID, removed bool) error {
+	return GetSession().Query(`UPDATE images_by_id SET removed_by_moderator = ? WHERE image_id = ?`, removed, imageID).Exec()
+}
+
+// IsRemovedByModerator reports whether a moderator removed an image.
+func IsRemovedByModerator(imageID gocql.UUID) (bool, error) {
+	var removed *bool
+	err := GetSession().Query(`SELECT removed_by_moderator FROM images_by_id WHERE image_id = ?`, imageID).Scan(&removed)
+	if err != nil && err != gocql.ErrNotFound {
+		return false, err
+	}
+	return removed != nil && *removed, nil
+}
+
+func removeFromTrash(ref ImageRef) error {
+	if ref.DeletedAt == nil {
+		return nil
+	}
+	if err := GetSession().Query(`
+		DELETE FROM trash_by_user WHERE user_id = ? AND deleted_at = ? AND image_id = ?`,
+		ref.UserID, *ref.DeletedAt, ref.ImageID,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		DELETE FROM trashed_images WHERE bucket = ? AND deleted_at = ? AND image_id = ?`,
+		trashBucket, *ref.DeletedAt, ref.ImageID,
+	).Exec()
+}
+
+// GetTrash lists a user's trash, most recently deleted first.
+func GetTrash(userID gocql.UUID) ([]TrashedImage, error) {
+	iter := GetSession().Query(`
+		SELECT image_id, deleted_at, title, image_url, blurhash, dominant_color FROM trash_by_user WHERE user_id = ?`,
+		userID,
+	).Iter()
+	trash := []TrashedImage{}
+	var t TrashedImage
+	for iter.Scan(&t.ImageID, &t.DeletedAt, &t.Title, &t.ImageURL, &t.BlurHash, &t.DominantColor) {
+		trash = append(trash, t)
+	}
+	return trash, iter.Close()
+}
+
+// GetTrashedBefore returns the ids of the images moved to the trash before
+// the given time, oldest first.
+func GetTrashedBefore(before time.Time) ([]gocql.UUID, error) {
+	iter := GetSession().Query(`
+		SELECT image_id FROM trashed_images WHERE bucket = ? AND deleted_at < ?`,
+		trashBucket, before,
+	).Iter()
+	var ids []gocql.UUID
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	return ids, iter.Close()
+}
+
+// PurgeImage permanently deletes an image with its gallery items, counters,
+// likes and reactions, comments, reports and hashes.
+func PurgeImage(ref ImageRef) error {
+	var phash *int64
+	if err := GetSession().Query(`SELECT phash FROM images_by_id WHERE image_id = ?`, ref.ImageID).Scan(&phash); err != nil && err != gocql.ErrNotFound {
+		return err
+	}
+	if err := RemoveImageFromFeed(ref); err != nil {
+		return err
+	}
+	if err := UnscheduleImage(ref.ImageID, ref.UploadedAt); err != nil {
+		return err
+	}
+	if err := removeFromTrash(ref); err != nil {
+		return err
+	}
+	if err := RemoveImageFromAlbums(ref.ImageID); err != nil {
+		return err
+	}
+	// los hashes de la galería se borran antes que sus elementos, que los guardan
+	itemHashes, err := GetPostItemHashes(ref.ImageID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range itemHashes {
+		if err := DeleteImageHash(ref.ImageID, hash); err != nil {
+			return err
+		}
+	}
+	if err := DeletePostItems(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageComments(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageReactions(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageLikes(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageBookmarks(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageStats(ref.ImageID); err != nil {
+		return err
+	}
+	if err := DeleteImageCountedTags(ref.ImageID); err != nil {
+		return err
+	}
+	if phash != nil {
+		if err := DeleteImageHash(ref.ImageID, uint64(*phash)); err != nil {
+			return err
+		}
+	}
+	queries := []struct {
+		cql  string
+		args []interface{}
+	}{
+		{`DELETE FROM images_by_user WHERE user_id = ? AND uploaded_at = ? AND image_id = ?`, []interface{}{ref.UserID, ref.UploadedAt, ref.ImageID}},
+		{`DELETE FROM image_counters WHERE image_id = ?`, []interface{}{ref.ImageID}},
+		{`DELETE FROM reports_by_image WHERE image_id = ?`, []interface{}{ref.ImageID}},
+		// images_by_id al final: si algo falla, el purge se reintenta
+		{`DELETE FROM images_by_id WHERE image_id = ?`, []interface{}{ref.ImageID}},
+	}
+	for _, q := range queries {
+		if err := GetSession().Query(q.cql, q.args...).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// TrendingPeriods are the ranking windows of the trending feed.
+var TrendingPeriods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// FeedImage is an image of the global feed considered for trending.
+type FeedImage struct {
+	ImageID    gocql.UUID
+	UserID     gocql.UUID
+	UploadedAt time.Time
+}
+
+// TrendingEntry is an image of a trending snapshot.
+type TrendingEntry struct {
+	ImageID gocql.UUID
+	Score   float64
+}
+
+// GetFeedImagesSince returns the images of the global feed uploaded after
+// since, walking images_by_date day by day.
+func GetFeedImagesSince(since, now time.Time) ([]FeedImage, error) {
+	images := []FeedImage{}
+	for day := now.UTC(); !day.Before(since.UTC().Truncate(24 * time.Hour)); day = day.AddDate(0, 0, -1) {
+		iter := GetSession().Query(`
+			SELECT image_id, user_id, uploaded_at FROM images_by_date WHERE day_bucket = ? AND uploaded_at > ?`,
+			day.Format("2006-01-02"), since,
+		).Iter()
+		var img FeedImage
+		for iter.Scan(&img.ImageID, &img.UserID, &img.UploadedAt) {
+			images = append(images, img)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// GetLikeTimes returns when each like of an image was made.
+func GetLikeTimes(imageID gocql.UUID) ([]time.Time, error) {
+	iter := GetSession().Query(`SELECT liked_at FROM likes_by_image WHERE image_id = ?`, imageID).Iter()
+	times := []time.Time{}
+	var likedAt time.Time
+	for iter.Scan(&likedAt) {
+		times = append(times, likedAt)
+	}
+	return times, iter.Close()
+}
+
+// SaveTrending writes a ranking snapshot and then points the period at it,
+// so readers never see a half-written ranking. Snapshots expire after ttl.
+func SaveTrending(period string, computedAt time.Time, entries []TrendingEntry, ttl time.Duration) error {
+	seconds := int(ttl.Seconds())
+	for rank, e := range entries {
+		if err := GetSession().Query(`
+			INSERT INTO trending_images (period, computed_at, rank, image_id, score) VALUES (?, ?, ?, ?, ?) USING TTL ?`,
+			period, computedAt, rank, e.ImageID, e.Score, seconds,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return GetSession().Query(`INSERT INTO trending_state (period, computed_at) VALUES (?, ?) USING TTL ?`, period, computedAt, seconds).Exec()
+}
+
+// GetTrending returns a page of the latest ranking of a period and when it
+// was computed (nil if there is none yet).
+func GetTrending(period string, offset, limit int) ([]TrendingEntry, *time.Time, error) {
+	var computedAt time.Time
+	err := GetSession().Query(`SELECT computed_at FROM trending_state WHERE period = ?`, period).Scan(&computedAt)
+	if err == gocql.ErrNotFound {
+		return []TrendingEntry{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	iter := GetSession().Query(`
+		SELECT image_id, score FROM trending_images WHERE period = ? AND computed_at = ? AND rank >= ? LIMIT ?`,
+		period, computedAt, offset, limit,
+	).Iter()
+	entries := []TrendingEntry{}
+	var e TrendingEntry
+	for iter.Scan(&e.ImageID, &e.Score) {
+		entries = append(entries, e)
+	}
+	return entries, &computedAt, iter.Close()
+}
@@ -0,0 +1,316 @@
+package db
+
+import (
+	"osohub/models"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// webhookDeliveryTTL is how long delivery logs are kept (seconds).
+const webhookDeliveryTTL = 30 * 24 * 60 * 60
+
+// webhookQueueBucketFormat partitions webhook_delivery_queue by the minute
+// an entry is due, so polls only read the current and overdue partitions
+// instead of the tombstones of everything delivered before.
+const webhookQueueBucketFormat = "2006-01-02T15:04"
+
+// webhookQueueLag is how long a past bucket stays in the scan after its
+// minute ends, for entries written by replicas with a late clock.
+const webhookQueueLag = 2 * time.Minute
+
+// webhookQueueMaxBuckets caps how many buckets one poll reads, so catching
+// up after a long outage is spread over several polls.
+const webhookQueueMaxBuckets = 120
+
+// webhookQueueBucket is the webhook_delivery_queue partition of an entry.
+func webhookQueueBucket(dueAt time.Time) string {
+	return dueAt.UTC().Format(webhookQueueBucketFormat)
+}
+
+// webhookSubject is the webhooks_by_subject partition of a webhook.
+func webhookSubject(scope string, ownerID gocql.UUID) string {
+	if scope == models.WebhookScopeAdmin {
+		return models.WebhookScopeAdmin
+	}
+	return ownerID.String()
+}
+
+// CreateWebhook stores a new webhook.
+func CreateWebhook(w models.Webhook) error {
+	if err := GetSession().Query(`
+		INSERT INTO webhooks_by_id (webhook_id, scope, owner_id, url, secret, events, description, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.WebhookID, w.Scope, w.OwnerID, w.URL, w.Secret, w.Events, w.Description, w.Active, w.CreatedAt,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`INSERT INTO webhooks_by_subject (subject, webhook_id) VALUES (?, ?)`,
+		webhookSubject(w.Scope, w.OwnerID), w.WebhookID).Exec()
+}
+
+// UpdateWebhook saves the editable fields of a webhook (url, events,
+// description, active and secret).
+func UpdateWebhook(w models.Webhook) error {
+	return GetSession().Query(`
+		UPDATE webhooks_by_id SET url = ?, events = ?, description = ?, active = ?, secret = ? WHERE webhook_id = ?`,
+		w.URL, w.Events, w.Description, w.Active, w.Secret, w.WebhookID,
+	).Exec()
+}
+
+// DeleteWebhook deletes a webhook and its delivery logs. Its queued
+// deliveries are dropped by the delivery worker.
+func DeleteWebhook(w models.Webhook) error {
+	if err := GetSession().Query(`DELETE FROM webhooks_by_subject WHERE subject = ? AND webhook_id = ?`,
+		webhookSubject(w.Scope, w.OwnerID), w.WebhookID).Exec(); err != nil {
+		return err
+	}
+	if err := GetSession().Query(`DELETE FROM webhooks_by_id WHERE webhook_id = ?`, w.WebhookID).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, w.WebhookID).Exec()
+}
+
+const webhookColumns = `webhook_id, scope, owner_id, url, secret, events, description, active, created_at`
+
+func scanWebhooks(iter *gocql.Iter) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	var w models.Webhook
+	for iter.Scan(&w.WebhookID, &w.Scope, &w.OwnerID, &w.URL, &w.Secret, &w.Events, &w.Description, &w.Active, &w.CreatedAt) {
+		sort.Strings(w.Events)
+		webhooks = append(webhooks, w)
+		w = models.Webhook{}
+	}
+	return webhooks, iter.Close()
+}
+
+// GetWebhook loads a webhook, secret included.
+func GetWebhook(webhookID gocql.UUID) (*models.Webhook, error) {
+	webhooks, err := scanWebhooks(GetSession().Query(`SELECT `+webhookColumns+` FROM webhooks_by_id WHERE webhook_id = ?`, webhookID).Iter())
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &webhooks[0], nil
+}
+
+// GetWebhooks returns the admin webhooks (scope "admin") or the user
+// webhooks of ownerID, oldest first, secrets included.
+func GetWebhooks(scope string, ownerID gocql.UUID) ([]models.Webhook, error) {
+	return getSubjectWebhooks([]string{webhookSubject(scope, ownerID)})
+}
+
+// GetEventWebhooks returns the active webhooks that receive an event: the
+// admin ones and, when the event concerns a user, that user's ones.
+func GetEventWebhooks(event string, ownerID *gocql.UUID) ([]models.Webhook, error) {
+	subjects := []string{models.WebhookScopeAdmin}
+	if ownerID != nil && models.WebhookUserEvents[event] {
+		subjects = append(subjects, ownerID.String())
+	}
+	webhooks, err := getSubjectWebhooks(subjects)
+	if err != nil {
+		return nil, err
+	}
+	matching := webhooks[:0]
+	for _, w := range webhooks {
+		if w.Active && w.Subscribed(event) {
+			matching = append(matching, w)
+		}
+	}
+	return matching, nil
+}
+
+func getSubjectWebhooks(subjects []string) ([]models.Webhook, error) {
+	iter := GetSession().Query(`SELECT webhook_id FROM webhooks_by_subject WHERE subject IN ?`, subjects).Iter()
+	var ids []gocql.UUID
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.Webhook{}, nil
+	}
+	webhooks, err := scanWebhooks(GetSession().Query(`SELECT `+webhookColumns+` FROM webhooks_by_id WHERE webhook_id IN ?`, ids).Iter())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt) })
+	return webhooks, nil
+}
+
+// QueuedWebhookDelivery is an entry of the delivery queue.
+type QueuedWebhookDelivery struct {
+	DueAt      time.Time
+	DeliveryID gocql.UUID
+	WebhookID  gocql.UUID
+}
+
+// EnqueueWebhookDelivery stores a new delivery and queues it to be sent
+// right away.
+func EnqueueWebhookDelivery(d models.WebhookDelivery) error {
+	if err := GetSession().Query(`
+		INSERT INTO webhook_deliveries (webhook_id, delivery_id, event_id, event, payload, status, attempts, next_attempt_at, redelivery_of)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?) USING TTL ?`,
+		d.WebhookID, d.DeliveryID, d.EventID, d.Event, string(d.Payload), models.DeliveryPending, d.CreatedAt, d.RedeliveryOf, webhookDeliveryTTL,
+	).Exec(); err != nil {
+		return err
+	}
+	return GetSession().Query(`
+		INSERT INTO webhook_delivery_queue (bucket, due_at, delivery_id, webhook_id) VALUES (?, ?, ?, ?)`,
+		webhookQueueBucket(d.CreatedAt), d.CreatedAt, d.DeliveryID, d.WebhookID,
+	).Exec()
+}
+
+// GetDueWebhookDeliveries returns up to limit queued deliveries whose time
+// has come, the oldest first. It reads the minute buckets from the oldest
+// one that may still hold entries (webhook_queue_cursor) up to now, and
+// moves that cursor past the buckets it finds empty.
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]QueuedWebhookDelivery, error) {
+	now = now.UTC()
+	current := now.Truncate(time.Minute)
+	var from time.Time
+	err := GetSession().Query(`SELECT bucket FROM webhook_queue_cursor WHERE name = 'pending'`).Scan(&from)
+	if err != nil && err != gocql.ErrNotFound {
+		return nil, err
+	}
+	if from.IsZero() || from.After(current) {
+		from = current.Add(-webhookQueueLag)
+	}
+	from = from.UTC()
+
+	due := []QueuedWebhookDelivery{}
+	cursor := time.Time{} // primer cubo que aún tiene entradas
+	bucket := from
+	for n := 0; !bucket.After(current) && n < webhookQueueMaxBuckets && len(due) < limit; n++ {
+		iter := GetSession().Query(`
+			SELECT due_at, delivery_id, webhook_id FROM webhook_delivery_queue WHERE bucket = ? AND due_at <= ? LIMIT ?`,
+			webhookQueueBucket(bucket), now, limit-len(due),
+		).Iter()
+		found := 0
+		var q QueuedWebhookDelivery
+		for iter.Scan(&q.DueAt, &q.DeliveryID, &q.WebhookID) {
+			due = append(due, q)
+			found++
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		if found > 0 && cursor.IsZero() {
+			cursor = bucket
+		}
+		bucket = bucket.Add(time.Minute)
+	}
+	if cursor.IsZero() {
+		cursor = bucket // todo lo leído estaba vacío
+	}
+	// los cubos recientes pueden recibir aún entradas de relojes atrasados
+	cursor = minTime(cursor, current.Add(-webhookQueueLag))
+	if !cursor.Equal(from) {
+		if err := GetSession().Query(`UPDATE webhook_queue_cursor SET bucket = ? WHERE name = 'pending'`, cursor).Exec(); err != nil {
+			return nil, err
+		}
+	}
+	return due, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// webhookClaimTTL is how long a queue entry stays claimed. It outlives any
+// attempt, so a stale read of an entry that was already sent cannot claim
+// it again; if the holder dies, the entry is retried after it expires.
+const webhookClaimTTL = 10 * 60
+
+// ClaimWebhookDelivery reserves a queue entry for holder. Only the process
+// that gets true may send it.
+func ClaimWebhookDelivery(q QueuedWebhookDelivery, holder string) (bool, error) {
+	return GetSession().Query(`
+		INSERT INTO webhook_queue_claims (delivery_id, due_at, holder) VALUES (?, ?, ?) IF NOT EXISTS USING TTL ?`,
+		q.DeliveryID, q.DueAt, holder, webhookClaimTTL,
+	).MapScanCAS(map[string]interface{}{})
+}
+
+// DequeueWebhookDelivery removes an entry from the delivery queue.
+func DequeueWebhookDelivery(q QueuedWebhookDelivery) error {
+	return GetSession().Query(`
+		DELETE FROM webhook_delivery_queue WHERE bucket = ? AND due_at = ? AND delivery_id = ?`,
+		webhookQueueBucket(q.DueAt), q.DueAt, q.DeliveryID,
+	).Exec()
+}
+
+// RecordWebhookAttempt saves the result of a delivery attempt and moves
+// the queue entry to the next attempt, or removes it once the delivery
+// succeeded or failed for good.
+func RecordWebhookAttempt(q QueuedWebhookDelivery, d models.WebhookDelivery) error {
+	if err := GetSession().Query(`
+		UPDATE webhook_deliveries USING TTL ?
+		SET status = ?, attempts = ?, response_status = ?, response_body = ?, error = ?, duration_ms = ?, last_attempt_at = ?, next_attempt_at = ?
+		WHERE webhook_id = ? AND delivery_id = ?`,
+		webhookDeliveryTTL, d.Status, d.Attempts, d.ResponseStatus, d.ResponseBody, d.Error, d.DurationMS, d.LastAttemptAt, d.NextAttemptAt,
+		d.WebhookID, d.DeliveryID,
+	).Exec(); err != nil {
+		return err
+	}
+	if d.Status == models.DeliveryPending && d.NextAttemptAt != nil {
+		if err := GetSession().Query(`
+			INSERT INTO webhook_delivery_queue (bucket, due_at, delivery_id, webhook_id) VALUES (?, ?, ?, ?)`,
+			webhookQueueBucket(*d.NextAttemptAt), *d.NextAttemptAt, d.DeliveryID, d.WebhookID,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+	return DequeueWebhookDelivery(q)
+}
+
+const webhookDeliveryColumns = `delivery_id, webhook_id, event_id, event, payload, status, attempts, response_status, response_body, error, duration_ms, last_attempt_at, next_attempt_at, redelivery_of`
+
+func scanWebhookDeliveries(iter *gocql.Iter) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	var d models.WebhookDelivery
+	var payload string
+	for iter.Scan(&d.DeliveryID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts, &d.ResponseStatus, &d.ResponseBody,
+		&d.Error, &d.DurationMS, &d.LastAttemptAt, &d.NextAttemptAt, &d.RedeliveryOf) {
+		d.Payload = []byte(payload)
+		d.CreatedAt = d.DeliveryID.Time().UTC()
+		deliveries = append(deliveries, d)
+		d = models.WebhookDelivery{}
+	}
+	return deliveries, iter.Close()
+}
+
+// GetWebhookDelivery loads a delivery of a webhook.
+func GetWebhookDelivery(webhookID, deliveryID gocql.UUID) (*models.WebhookDelivery, error) {
+	deliveries, err := scanWebhookDeliveries(GetSession().Query(`
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? AND delivery_id = ?`,
+		webhookID, deliveryID).Iter())
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &deliveries[0], nil
+}
+
+// GetWebhookDeliveries returns up to limit deliveries of a webhook, newest
+// first, starting after the cursor (a delivery_id) when given.
+func GetWebhookDeliveries(webhookID gocql.UUID, cursor *gocql.UUID, limit int) ([]models.WebhookDelivery, error) {
+	if cursor != nil {
+		return scanWebhookDeliveries(GetSession().Query(`
+			SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? AND delivery_id < ? LIMIT ?`,
+			webhookID, *cursor, limit).Iter())
+	}
+	return scanWebhookDeliveries(GetSession().Query(`
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? LIMIT ?`,
+		webhookID, limit).Iter())
+}
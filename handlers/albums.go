@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+const (
+	maxAlbumTitleLength = 100
+	maxAlbumImages      = 500
+)
+
+// AlbumRequest is the body for creating or editing an album. Omitted fields
+// are left unchanged on edit; kind can only be set on creation.
+type AlbumRequest struct {
+	Title        *string `json:"title,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	Kind         string  `json:"kind,omitempty" enums:"album,collection"`
+	CoverImageID *string `json:"cover_image_id,omitempty"`
+}
+
+// AlbumImageRequest is the body for adding an image to an album. Without
+// position the image is appended.
+type AlbumImageRequest struct {
+	ImageID  string `json:"image_id" binding:"required"`
+	Position *int   `json:"position,omitempty"`
+}
+
+// AlbumOrderRequest is the body for reordering an album: every image of the
+// album, in the new order.
+type AlbumOrderRequest struct {
+	ImageIDs []string `json:"image_ids" binding:"required"`
+}
+
+func albumInternalError(c *gin.Context, err error) {
+	log.Printf("Album error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":         "Could not update album. Please try again later.",
+		"documentation": "https://docs.osohub.com/errors#internal",
+	})
+}
+
+// loadOwnAlbum loads the album in the path and checks that the current
+// user owns it. It writes the error response and returns nil otherwise.
+func loadOwnAlbum(c *gin.Context) *models.Album {
+	albumID, err := gocql.ParseUUID(c.Param("album_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid album_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/albums",
+		})
+		return nil
+	}
+	album, err := db.GetAlbum(albumID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Album not found.",
+			"documentation": "https://docs.osohub.com/albums",
+		})
+		return nil
+	}
+	if album.UserID.String() != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this album"})
+		return nil
+	}
+	return album
+}
+
+// attachAlbumCovers fills in the cover URLs of a list of albums.
+func attachAlbumCovers(viewerID string, albums []models.Album) {
+	var ids []gocql.UUID
+	for _, a := range albums {
+		if a.CoverImageID != nil {
+			ids = append(ids, *a.CoverImageID)
+		}
+	}
+	covers, err := db.GetImagesByIDs(ids)
+	if err != nil {
+		log.Printf("Error loading album covers: %v", err)
+		return
+	}
+	urls := map[gocql.UUID]string{}
+	access := newViewerAccess(viewerID)
+	for _, img := range covers {
+		if access.canView(img) {
+			urls[img.ImageID] = img.ImageURL
+		}
+	}
+	for i := range albums {
+		if albums[i].CoverImageID == nil {
+			continue
+		}
+		// sin la portada si quien mira no puede verla
+		url, ok := urls[*albums[i].CoverImageID]
+		if !ok {
+			albums[i].CoverImageID = nil
+		}
+		albums[i].CoverURL = url
+	}
+}
+
+// CreateAlbum godoc
+// @Summary Create an album or collection
+// @Description Albums hold the user's own images; collections can hold any image the user can see (e.g. saved images of others).
+// @Tags Albums
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param album body AlbumRequest true "title is required; kind defaults to album"
+// @Success 201 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums [post]
+func CreateAlbum(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req AlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == nil || *req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "title is required.",
+			"documentation": "https://docs.osohub.com/albums#create",
+		})
+		return
+	}
+	kind := req.Kind
+	if kind == "" {
+		kind = models.AlbumKindAlbum
+	}
+	if kind != models.AlbumKindAlbum && kind != models.AlbumKindCollection {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kind. Use album or collection."})
+		return
+	}
+	album := models.Album{
+		AlbumID: gocql.TimeUUID(),
+		UserID:  userID,
+		Kind:    kind,
+	}
+	if !applyAlbumText(c, &album, req) {
+		return
+	}
+	album.CreatedAt = album.AlbumID.Time().UTC()
+	album.UpdatedAt = album.CreatedAt
+	if err := db.SaveAlbum(album); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, album)
+}
+
+// applyAlbumText validates and applies the title and description of req.
+func applyAlbumText(c *gin.Context, album *models.Album, req AlbumRequest) bool {
+	if req.Title != nil {
+		if *req.Title == "" || utf8.RuneCountInString(*req.Title) > maxAlbumTitleLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title must have between 1 and 100 characters."})
+			return false
+		}
+		album.Title = *req.Title
+	}
+	if req.Description != nil {
+		if utf8.RuneCountInString(*req.Description) > maxDescriptionLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Description too long. Maximum 2000 characters."})
+			return false
+		}
+		album.Description = *req.Description
+	}
+	return true
+}
+
+// GetMyAlbums godoc
+// @Summary List the current user's albums and collections
+// @Tags Albums
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Album
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums [get]
+func GetMyAlbums(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	albums, err := db.GetAlbumsByUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch albums. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	attachAlbumCovers(userID.String(), albums)
+	c.JSON(http.StatusOK, albums)
+}
+
+// UpdateAlbum godoc
+// @Summary Edit an album's title, description or cover
+// @Description cover_image_id must be an image of the album.
+// @Tags Albums
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param album_id path string true "Album ID"
+// @Param album body AlbumRequest true "Fields to update"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums/{album_id} [patch]
+func UpdateAlbum(c *gin.Context) {
+	album := loadOwnAlbum(c)
+	if album == nil {
+		return
+	}
+	var req AlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid body. Optional fields: title, description, cover_image_id.",
+			"documentation": "https://docs.osohub.com/albums#update",
+		})
+		return
+	}
+	if req.Kind != "" && req.Kind != album.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The kind of an album cannot be changed."})
+		return
+	}
+	if !applyAlbumText(c, album, req) {
+		return
+	}
+	if req.CoverImageID != nil {
+		coverID, err := gocql.ParseUUID(*req.CoverImageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cover_image_id. Must be a valid UUID."})
+			return
+		}
+		ids, err := db.GetAlbumImageIDs(album.AlbumID)
+		if err != nil {
+			albumInternalError(c, err)
+			return
+		}
+		if indexOfImage(ids, coverID) < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The cover must be an image of the album."})
+			return
+		}
+		album.CoverImageID = &coverID
+	}
+	album.UpdatedAt = time.Now().UTC()
+	if err := db.SaveAlbum(*album); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// DeleteAlbum godoc
+// @Summary Delete an album (the images are kept)
+// @Tags Albums
+// @Security BearerAuth
+// @Param album_id path string true "Album ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums/{album_id} [delete]
+func DeleteAlbum(c *gin.Context) {
+	album := loadOwnAlbum(c)
+	if album == nil {
+		return
+	}
+	if err := db.DeleteAlbum(*album); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func indexOfImage(ids []gocql.UUID, id gocql.UUID) int {
+	for i, other := range ids {
+		if other == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddAlbumImage godoc
+// @Summary Add an image to an album
+// @Description Albums accept only the user's own images; collections accept any image the user can see.
+// @Tags Albums
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param album_id path string true "Album ID"
+// @Param image body AlbumImageRequest true "Image and optional position (0-based)"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums/{album_id}/images [post]
+func AddAlbumImage(c *gin.Context) {
+	album := loadOwnAlbum(c)
+	if album == nil {
+		return
+	}
+	var req AlbumImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "image_id is required.",
+			"documentation": "https://docs.osohub.com/albums#images",
+		})
+		return
+	}
+	imageID, err := gocql.ParseUUID(req.ImageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image_id. Must be a valid UUID."})
+		return
+	}
+
+	viewerID := c.GetString("user_id")
+	loaded, err := db.GetImagesByIDs([]gocql.UUID{imageID})
+	if err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	if len(loaded) == 0 || !canViewImage(viewerID, loaded[0]) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found."})
+		return
+	}
+	if album.Kind == models.AlbumKindAlbum && loaded[0].UserID.String() != viewerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Albums can only hold your own images. Use a collection to save images of others."})
+		return
+	}
+
+	ids, err := db.GetAlbumImageIDs(album.AlbumID)
+	if err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	if indexOfImage(ids, imageID) >= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The image is already in the album."})
+		return
+	}
+	if len(ids) >= maxAlbumImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Album is full. Maximum " + strconv.Itoa(maxAlbumImages) + " images."})
+		return
+	}
+	position := len(ids)
+	if req.Position != nil && *req.Position >= 0 && *req.Position < len(ids) {
+		position = *req.Position
+	}
+	ids = append(ids[:position], append([]gocql.UUID{imageID}, ids[position:]...)...)
+	if err := db.SaveAlbumImages(album, ids); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// RemoveAlbumImage godoc
+// @Summary Remove an image from an album (the image is kept)
+// @Tags Albums
+// @Produce json
+// @Security BearerAuth
+// @Param album_id path string true "Album ID"
+// @Param image_id path string true "Image ID"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums/{album_id}/images/{image_id} [delete]
+func RemoveAlbumImage(c *gin.Context) {
+	album := loadOwnAlbum(c)
+	if album == nil {
+		return
+	}
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image_id. Must be a valid UUID."})
+		return
+	}
+	ids, err := db.GetAlbumImageIDs(album.AlbumID)
+	if err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	i := indexOfImage(ids, imageID)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The image is not in the album."})
+		return
+	}
+	if err := db.SaveAlbumImages(album, append(ids[:i], ids[i+1:]...)); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// ReorderAlbumImages godoc
+// @Summary Reorder the images of an album
+// @Description image_ids must contain every image of the album exactly once.
+// @Tags Albums
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param album_id path string true "Album ID"
+// @Param order body AlbumOrderRequest true "Images in the new order"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/albums/{album_id}/images [put]
+func ReorderAlbumImages(c *gin.Context) {
+	album := loadOwnAlbum(c)
+	if album == nil {
+		return
+	}
+	var req AlbumOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "image_ids is required.",
+			"documentation": "https://docs.osohub.com/albums#order",
+		})
+		return
+	}
+	current, err := db.GetAlbumImageIDs(album.AlbumID)
+	if err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	ids := make([]gocql.UUID, 0, len(req.ImageIDs))
+	seen := map[gocql.UUID]bool{}
+	for _, raw := range req.ImageIDs {
+		id, err := gocql.ParseUUID(raw)
+		if err != nil || seen[id] || indexOfImage(current, id) < 0 {
+			ids = nil
+			break
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) != len(current) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must contain every image of the album exactly once."})
+		return
+	}
+	if err := db.SaveAlbumImages(album, ids); err != nil {
+		albumInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// GetAlbum godoc
+// @Summary Get an album with its images
+// @Description Images the viewer may not see (private, followers-only, unlisted, scheduled or deleted) are left out, and so is the cover (cover_image_id and cover_url then point to the first visible image). Purged images leave the album. Send a JWT to be identified.
+// @Tags Albums
+// @Produce json
+// @Param album_id path string true "Album ID"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /albums/{album_id} [get]
+func GetAlbum(c *gin.Context) {
+	albumID, err := gocql.ParseUUID(c.Param("album_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid album_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/albums",
+		})
+		return
+	}
+	album, err := db.GetAlbum(albumID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Album not found.",
+			"documentation": "https://docs.osohub.com/albums",
+		})
+		return
+	}
+	ids, err := db.GetAlbumImageIDs(albumID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch album. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	viewerID := c.GetString("user_id")
+	images, err := hydrateImages(viewerID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch album. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	album.Images = make([]models.Image, 0, len(images))
+	access := newViewerAccess(viewerID)
+	for _, img := range images {
+		if access.listed(img) {
+			album.Images = append(album.Images, img)
+		}
+	}
+	// La portada solo se muestra si el visitante puede verla; si no, la primera visible
+	var cover *models.Image
+	for i, img := range album.Images {
+		if album.CoverImageID != nil && img.ImageID == *album.CoverImageID {
+			cover = &album.Images[i]
+		}
+	}
+	if cover == nil && len(album.Images) > 0 {
+		cover = &album.Images[0]
+	}
+	album.CoverImageID, album.CoverURL = nil, ""
+	if cover != nil {
+		coverID := cover.ImageID
+		album.CoverImageID, album.CoverURL = &coverID, cover.ImageURL
+	}
+	album.ImageCount = len(album.Images)
+	c.JSON(http.StatusOK, album)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Neither of you can see the other's profile, images or comments, nor like, comment or follow. Any follow between you is removed.
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/block [post]
+func BlockUser(c *gin.Context) {
+	userID, targetID, ok := userTarget(c, "block")
+	if !ok {
+		return
+	}
+	if err := db.BlockUser(userID, targetID, time.Now().UTC()); err != nil {
+		log.Printf("Error blocking %v for %v: %v", targetID, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not block user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Follows removed by the block are not restored.
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/block [delete]
+func UnblockUser(c *gin.Context) {
+	userID, targetID, ok := userTarget(c, "block")
+	if !ok {
+		return
+	}
+	if err := db.UnblockUser(userID, targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not unblock user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// MuteUser godoc
+// @Summary Mute a user
+// @Description Their images are left out of your /feed and /feed/home. They are not told and can still see and interact with your content.
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/mute [post]
+func MuteUser(c *gin.Context) {
+	userID, targetID, ok := userTarget(c, "mute")
+	if !ok {
+		return
+	}
+	if err := db.MuteUser(userID, targetID, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not mute user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnmuteUser godoc
+// @Summary Unmute a user
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/mute [delete]
+func UnmuteUser(c *gin.Context) {
+	userID, targetID, ok := userTarget(c, "mute")
+	if !ok {
+		return
+	}
+	if err := db.UnmuteUser(userID, targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not unmute user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// relatedUsers writes the current user's block or mute list.
+func relatedUsers(c *gin.Context, relation string) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	users, err := db.GetRelatedUsers(userID, relation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch users. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	for i := range users {
+		if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, users[i].UserID).Scan(&users[i].Username, &users[i].ProfilePictureURL); err != nil && err != gocql.ErrNotFound {
+			log.Printf("Error loading user %v: %v", users[i].UserID, err)
+		}
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// GetMyBlocks godoc
+// @Summary List the users the current user blocked
+// @Tags Auth & Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} db.RelatedUser
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/blocks [get]
+func GetMyBlocks(c *gin.Context) {
+	relatedUsers(c, db.RelationBlock)
+}
+
+// GetMyMutes godoc
+// @Summary List the users the current user muted
+// @Tags Auth & Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} db.RelatedUser
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/mutes [get]
+func GetMyMutes(c *gin.Context) {
+	relatedUsers(c, db.RelationMute)
+}
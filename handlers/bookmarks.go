@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"net/http"
+	"osohub/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// bookmarkImageAndUser parses the image in the path and the current user.
+func bookmarkImageAndUser(c *gin.Context) (gocql.UUID, gocql.UUID, bool) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#bookmarks",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	return imageID, userID, true
+}
+
+// BookmarkImage godoc
+// @Summary Save an image for later
+// @Description Bookmarks are private. Saving an image twice keeps the first bookmarked_at.
+// @Tags Images
+// @Produce json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Success 200 {object} map[string]interface{} "bookmarked and bookmarked_at"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/bookmark [post]
+func BookmarkImage(c *gin.Context) {
+	imageID, userID, ok := bookmarkImageAndUser(c)
+	if !ok {
+		return
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
+	at, err := db.AddBookmark(imageID, userID, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not save bookmark. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"bookmarked":    true,
+		"bookmarked_at": at,
+	})
+}
+
+// RemoveBookmark godoc
+// @Summary Remove an image from the saved images
+// @Description Works even if the image is no longer visible to the user.
+// @Tags Images
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/bookmark [delete]
+func RemoveBookmark(c *gin.Context) {
+	imageID, userID, ok := bookmarkImageAndUser(c)
+	if !ok {
+		return
+	}
+	removed, err := db.RemoveBookmark(imageID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not remove bookmark. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image is not bookmarked.",
+			"documentation": "https://docs.osohub.com/images#bookmarks",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetMyBookmarks godoc
+// @Summary List the current user's saved images (most recent first)
+// @Description Images that are no longer visible (in the trash or made private) are left out; their bookmarks come back if the image is restored and are removed when it is purged. Paginate with the next_before value of the previous page.
+// @Tags Images
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query string false "Cursor: only images saved before this time (RFC 3339)"
+// @Success 200 {object} map[string]interface{} "images and next_before"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/bookmarks [get]
+func GetMyBookmarks(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+	before, ok := queryBefore(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid before. Use the next_before value of the previous page (RFC 3339).",
+			"documentation": "https://docs.osohub.com/users#bookmarks",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+	bookmarks, err := db.GetBookmarks(userID, before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch bookmarks. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	ids := make([]gocql.UUID, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		ids = append(ids, b.ImageID)
+	}
+	images, err := hydrateImages(userID.String(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch bookmarks. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	var nextBefore *time.Time
+	if len(bookmarks) == limit {
+		last := bookmarks[len(bookmarks)-1].BookmarkedAt
+		nextBefore = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"images":      images,
+		"next_before": nextBefore,
+	})
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/webhooks"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+const maxCommentLength = 1000
+
+// CommentRequest is the body for creating or editing a comment. parent_id
+// makes the comment a reply to a top-level comment of the same image.
+type CommentRequest struct {
+	Body     string  `json:"body" binding:"required"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// validateCommentBody trims a comment and checks its length.
+func validateCommentBody(c *gin.Context, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > maxCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Comment must have between 1 and 1000 characters.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return "", false
+	}
+	return body, true
+}
+
+// loadViewableImage loads an image the current viewer may see. It writes the
+// error response and returns nil otherwise.
+func loadViewableImage(c *gin.Context, imageID gocql.UUID) *models.Image {
+	loaded, err := db.GetImagesByIDs([]gocql.UUID{imageID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return nil
+	}
+	if len(loaded) == 0 || !canViewImage(c.GetString("user_id"), loaded[0]) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found.",
+			"documentation": "https://docs.osohub.com/images#byid",
+		})
+		return nil
+	}
+	return &loaded[0]
+}
+
+// loadComment loads the comment in the path. It writes the error response
+// and returns nil if it does not exist.
+func loadComment(c *gin.Context) *models.Comment {
+	commentID, err := gocql.ParseUUID(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid comment_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return nil
+	}
+	cm, err := db.GetComment(commentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Comment not found.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return nil
+	}
+	return cm
+}
+
+// attachCommentAuthors fills in the current username and profile picture
+// of each comment's author.
+func attachCommentAuthors(comments []models.Comment) {
+	type author struct{ username, picture string }
+	authors := map[gocql.UUID]author{}
+	for i := range comments {
+		a, ok := authors[comments[i].UserID]
+		if !ok {
+			if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, comments[i].UserID).Scan(&a.username, &a.picture); err != nil {
+				log.Printf("Error loading comment author %v: %v", comments[i].UserID, err)
+			}
+			authors[comments[i].UserID] = a
+		}
+		comments[i].Username = a.username
+		comments[i].UserProfilePictureURL = a.picture
+	}
+}
+
+// commentCursor reads the cursor query parameter (a comment_id).
+func commentCursor(c *gin.Context) (*gocql.UUID, bool) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return nil, true
+	}
+	cursor, err := gocql.ParseUUID(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid cursor. Use the next_cursor value of the previous page.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return nil, false
+	}
+	return &cursor, true
+}
+
+// commentPage writes a page of comments with its next cursor, leaving out
+// the comments of users blocked by or blocking the viewer.
+func commentPage(c *gin.Context, comments []models.Comment, limit int) {
+	var nextCursor *gocql.UUID
+	if len(comments) == limit {
+		last := comments[len(comments)-1].CommentID
+		nextCursor = &last
+	}
+	hidden, err := hiddenAuthors(c.GetString("user_id"), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch comments. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if len(hidden) > 0 {
+		visible := comments[:0]
+		for _, cm := range comments {
+			if !hidden[cm.UserID] {
+				visible = append(visible, cm)
+			}
+		}
+		comments = visible
+	}
+	attachCommentAuthors(comments)
+	c.JSON(http.StatusOK, gin.H{
+		"comments":    comments,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetImageComments godoc
+// @Summary List the comments of an image (newest first)
+// @Description Top-level comments with their reply_count; replies are listed with GET /comments/{comment_id}/replies. Paginate with the next_cursor value of the previous page.
+// @Tags Comments
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "comments and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/comments [get]
+func GetImageComments(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return
+	}
+	cursor, ok := commentCursor(c)
+	if !ok {
+		return
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+	comments, err := db.GetCommentsByImage(imageID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch comments. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	ids := make([]gocql.UUID, 0, len(comments))
+	for _, cm := range comments {
+		ids = append(ids, cm.CommentID)
+	}
+	replies, err := db.GetReplyCounts(ids)
+	if err != nil {
+		log.Printf("Error loading reply counts of image %v: %v", imageID, err)
+	}
+	for i := range comments {
+		comments[i].ReplyCount = replies[comments[i].CommentID]
+	}
+	commentPage(c, comments, limit)
+}
+
+// GetCommentReplies godoc
+// @Summary List the replies to a comment (oldest first)
+// @Tags Comments
+// @Produce json
+// @Param comment_id path string true "Comment ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "comments and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comments/{comment_id}/replies [get]
+func GetCommentReplies(c *gin.Context) {
+	parent := loadComment(c)
+	if parent == nil {
+		return
+	}
+	cursor, ok := commentCursor(c)
+	if !ok {
+		return
+	}
+	if loadViewableImage(c, parent.ImageID) == nil {
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+	replies, err := db.GetReplies(*parent, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch replies. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	commentPage(c, replies, limit)
+}
+
+// CreateComment godoc
+// @Summary Comment on an image or reply to a comment
+// @Description Send parent_id to reply to a top-level comment. Replies cannot be replied to.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Param comment body CommentRequest true "Comment (max 1000 characters)"
+// @Success 201 {object} models.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/comments [post]
+func CreateComment(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return
+	}
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var parent *models.Comment
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "body is required. parent_id is optional.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return
+	}
+	body, ok := validateCommentBody(c, req.Body)
+	if !ok {
+		return
+	}
+	img := loadViewableImage(c, imageID)
+	if img == nil {
+		return
+	}
+
+	commentID := gocql.TimeUUID()
+	cm := models.Comment{
+		CommentID: commentID,
+		ImageID:   imageID,
+		UserID:    userID,
+		Body:      body,
+		CreatedAt: commentID.Time().UTC(),
+	}
+	if req.ParentID != nil {
+		parentID, err := gocql.ParseUUID(*req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent_id. Must be a valid UUID."})
+			return
+		}
+		parent, err = db.GetComment(parentID)
+		if err != nil || parent.ImageID != imageID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found on this image."})
+			return
+		}
+		if parent.ParentID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Replies cannot be replied to. Reply to the top-level comment instead."})
+			return
+		}
+		if blockedBetween(userID.String(), parent.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot reply to this user."})
+			return
+		}
+		cm.ParentID = &parentID
+	}
+
+	if err := db.InsertComment(cm); err != nil {
+		log.Printf("Error saving comment on %v: %v", imageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not save comment. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if parent != nil {
+		notify(parent.UserID, models.Notification{Type: models.NotificationReply, ActorID: &userID, ImageID: &imageID, CommentID: &commentID})
+	}
+	if parent == nil || parent.UserID != img.UserID {
+		notify(img.UserID, models.Notification{Type: models.NotificationComment, ActorID: &userID, ImageID: &imageID, CommentID: &commentID})
+	}
+	comments := []models.Comment{cm}
+	attachCommentAuthors(comments)
+	c.JSON(http.StatusCreated, comments[0])
+}
+
+// UpdateComment godoc
+// @Summary Edit a comment (author only)
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param comment_id path string true "Comment ID"
+// @Param comment body CommentRequest true "New body (parent_id is ignored)"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comments/{comment_id} [patch]
+func UpdateComment(c *gin.Context) {
+	cm := loadComment(c)
+	if cm == nil {
+		return
+	}
+	if cm.UserID.String() != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the author of this comment"})
+		return
+	}
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "body is required.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return
+	}
+	body, ok := validateCommentBody(c, req.Body)
+	if !ok {
+		return
+	}
+	editedAt := time.Now().UTC()
+	if err := db.UpdateCommentBody(*cm, body, editedAt); err != nil {
+		log.Printf("Error editing comment %v: %v", cm.CommentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not edit comment. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	cm.Body = body
+	cm.EditedAt = &editedAt
+	comments := []models.Comment{*cm}
+	attachCommentAuthors(comments)
+	c.JSON(http.StatusOK, comments[0])
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description The author, the owner of the image and admins can delete a comment. Deleting a top-level comment also deletes its replies.
+// @Tags Comments
+// @Security BearerAuth
+// @Param comment_id path string true "Comment ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comments/{comment_id} [delete]
+func DeleteComment(c *gin.Context) {
+	cm := loadComment(c)
+	if cm == nil {
+		return
+	}
+	userID := c.GetString("user_id")
+	isAdmin := c.GetString("role") == models.RoleAdmin
+	allowed := cm.UserID.String() == userID
+	if !allowed {
+		if ref, err := db.GetImageRef(cm.ImageID); err == nil && ref.UserID.String() == userID {
+			allowed = true
+		}
+	}
+	// si lo borra un admin que no es el autor ni el dueño, es una decisión de moderación
+	moderated := !allowed && isAdmin
+	if !allowed && !moderated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or the image owner can delete this comment"})
+		return
+	}
+	if err := db.DeleteComment(*cm); err != nil {
+		log.Printf("Error deleting comment %v: %v", cm.CommentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not delete comment. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if moderated {
+		notifyModeration(cm.UserID, "Your comment was removed by a moderator.", &cm.ImageID, &cm.CommentID)
+		reporters, err := db.GetCommentReporters(cm.CommentID)
+		if err != nil {
+			log.Printf("Error loading reporters of comment %v: %v", cm.CommentID, err)
+		}
+		for _, reporterID := range reporters {
+			notifyModeration(reporterID, "A comment you reported was removed. Thanks for your report.", &cm.ImageID, &cm.CommentID)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReportComment godoc
+// @Summary Report a comment
+// @Description Uses the same categories as image reports (see /reports/categories). A copy of the comment is kept with the report.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param comment_id path string true "Comment ID"
+// @Param report body models.ReportRequest true "Report reason"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /comments/{comment_id}/report [post]
+func ReportComment(c *gin.Context) {
+	reporterID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Missing user_id in token.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+	cm := loadComment(c)
+	if cm == nil {
+		return
+	}
+	var req models.ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Category is required. Reason is optional.",
+			"documentation": "https://docs.osohub.com/comments#report",
+		})
+		return
+	}
+	if !validReportCategories[req.Category] {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid category. Use /reports/categories to get valid categories.",
+			"documentation": "https://docs.osohub.com/comments#report",
+		})
+		return
+	}
+	if err := db.InsertCommentReport(*cm, reporterID, req.Category, req.Reason); err != nil {
+		log.Printf("Error reporting comment %v: %v", cm.CommentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not report comment. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	webhooks.ReportCreated(webhooks.ReportData{ImageID: cm.ImageID, CommentID: &cm.CommentID, ReporterID: reporterID, Category: req.Category, Reason: req.Reason})
+	c.JSON(http.StatusOK, gin.H{"message": "Comment reported"})
+}
+
+// GetImageCommentsCount godoc
+// @Summary Get the number of comments of an image (replies included)
+// @Description Images the viewer may not see answer 404. Send a JWT to be identified.
+// @Tags Comments
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/comments/count [get]
+func GetImageCommentsCount(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/comments",
+		})
+		return
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
+	count, err := db.GetImageCommentCount(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch comment count. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comments": count})
+}
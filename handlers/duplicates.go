@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"osohub/config"
+	"osohub/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Acciones posibles cuando una subida es casi idéntica a otra imagen
+const (
+	DuplicateActionReject = "reject" // rechazar la subida
+	DuplicateActionWarn   = "warn"   // aceptar y avisar al cliente
+	DuplicateActionFlag   = "flag"   // aceptar y reportar para moderación
+)
+
+// systemReporterID identifica los reportes automáticos generados por el servidor
+var systemReporterID = gocql.UUID{}
+
+// duplicateMatch describes an earlier image that an upload nearly duplicates.
+type duplicateMatch struct {
+	ImageID  gocql.UUID
+	Distance int
+	Banned   bool
+	Action   string
+}
+
+func duplicateAction(key, fallback string) string {
+	switch action := config.GetEnv(key, fallback); action {
+	case DuplicateActionReject, DuplicateActionWarn, DuplicateActionFlag:
+		return action
+	default:
+		return fallback
+	}
+}
+
+// duplicateMaxDistance reads DUPLICATE_HASH_DISTANCE, the number of differing
+// hash bits still considered the same picture.
+func duplicateMaxDistance() int {
+	distance, err := strconv.Atoi(config.GetEnv("DUPLICATE_HASH_DISTANCE", "3"))
+	if err != nil || distance < 0 {
+		return 3
+	}
+	return distance
+}
+
+// findUploadDuplicate checks a new upload's hash against banned hashes and
+// the uploader's own images. Banned matches take precedence.
+func findUploadDuplicate(userID gocql.UUID, hash uint64) (*duplicateMatch, error) {
+	maxDistance := duplicateMaxDistance()
+	banned, err := db.FindBannedHash(hash, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	if banned != nil {
+		return &duplicateMatch{
+			ImageID:  banned.ImageID,
+			Distance: banned.Distance,
+			Banned:   true,
+			Action:   duplicateAction("BANNED_HASH_ACTION", DuplicateActionReject),
+		}, nil
+	}
+	similar, err := db.FindSimilarImages(hash, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	var best *duplicateMatch
+	for _, s := range similar {
+		if s.UserID != userID {
+			continue
+		}
+		if best == nil || s.Distance < best.Distance {
+			best = &duplicateMatch{
+				ImageID:  s.ImageID,
+				Distance: s.Distance,
+				Action:   duplicateAction("DUPLICATE_UPLOAD_ACTION", DuplicateActionWarn),
+			}
+		}
+	}
+	return best, nil
+}
+
+// flagDuplicate files an automatic spam report against a new image.
+func flagDuplicate(imageID gocql.UUID, match *duplicateMatch) {
+	reason := fmt.Sprintf("Automatic: near-duplicate of image %s (distance %d)", match.ImageID, match.Distance)
+	if match.Banned {
+		reason = fmt.Sprintf("Automatic: matches banned image %s (distance %d)", match.ImageID, match.Distance)
+	}
+	if err := saveImageReport(imageID, systemReporterID, "spam", reason); err != nil {
+		log.Printf("Error flagging duplicate image %v: %v", imageID, err)
+	}
+}
+
+// imagePerceptualHash returns the stored hash of an image. ok is false when
+// the image does not exist or was uploaded before hashing was introduced.
+func imagePerceptualHash(imageID gocql.UUID) (hash uint64, ok bool, err error) {
+	var phash *int64
+	err = db.GetSession().Query(`SELECT phash FROM images_by_id WHERE image_id = ?`, imageID).Scan(&phash)
+	if err == gocql.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil || phash == nil {
+		return 0, false, err
+	}
+	return uint64(*phash), true, nil
+}
+
+// GetSimilarImages godoc
+// @Summary Find images similar to a given one (Admin only)
+// @Description Lists images whose perceptual hash is within `distance` bits of the given image, to investigate reposted content
+// @Tags Moderation
+// @Security BearerAuth
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Param distance query int false "Maximum hash distance (default DUPLICATE_HASH_DISTANCE, max 3)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /images/{image_id}/similar [get]
+func GetSimilarImages(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/moderation#similar",
+		})
+		return
+	}
+	distance := duplicateMaxDistance()
+	if d, err := strconv.Atoi(c.Query("distance")); err == nil && d >= 0 {
+		distance = d
+	}
+
+	hash, ok, err := imagePerceptualHash(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch image hash. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found or has no perceptual hash.",
+			"documentation": "https://docs.osohub.com/moderation#similar",
+		})
+		return
+	}
+
+	similar, err := db.FindSimilarImages(hash, distance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not search similar images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	results := []db.SimilarImage{}
+	for _, s := range similar {
+		if s.ImageID != imageID {
+			results = append(results, s)
+		}
+	}
+	banned, err := db.FindBannedHash(hash, distance)
+	if err != nil {
+		log.Printf("Error checking banned hashes for image %v: %v", imageID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"image_id":     imageID,
+		"similar":      results,
+		"banned_match": banned,
+	})
+}
+
+// BanHashRequest is the body for banning an image hash
+type BanHashRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BanImageHash godoc
+// @Summary Ban an image's perceptual hash (Admin only)
+// @Description Future uploads within DUPLICATE_HASH_DISTANCE bits of this image are handled according to BANNED_HASH_ACTION
+// @Tags Moderation
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Param ban body BanHashRequest false "Reason"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /images/{image_id}/ban-hash [post]
+func BanImageHash(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/moderation#ban-hash",
+		})
+		return
+	}
+	var req BanHashRequest
+	_ = c.ShouldBindJSON(&req) // el motivo es opcional
+
+	hash, ok, err := imagePerceptualHash(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch image hash. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found or has no perceptual hash.",
+			"documentation": "https://docs.osohub.com/moderation#ban-hash",
+		})
+		return
+	}
+	if err := db.BanImageHash(hash, imageID, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not ban image hash. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if ref, err := db.GetImageRef(imageID); err == nil {
+		notifyImageModeration(*ref, "A moderator banned your image: copies of it can no longer be uploaded.",
+			"An image you reported was banned by the moderators. Thanks for your report.")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Image hash banned", "image_id": imageID})
+}
@@ -7,10 +7,12 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
 )
 
 // GetFeed godoc
 // @Summary Get global image feed (latest images)
+// @Description Send a JWT to leave out the users you muted or blocked (and those who blocked you).
 // @Produce json
 // @Tags Images
 // @Param day_bucket query string false "Day bucket (YYYY-MM-DD)"
@@ -33,7 +35,7 @@ func GetFeed(c *gin.Context) {
 	}
 
 	// Get images from images_by_date
-	query := `SELECT image_id, user_id, username, image_url, title, uploaded_at FROM images_by_date WHERE day_bucket = ? LIMIT ?`
+	query := `SELECT image_id, user_id, username, image_url, title, description, alt_text, edited_at, uploaded_at, blurhash, dominant_color, item_count FROM images_by_date WHERE day_bucket = ? LIMIT ?`
 	iter := db.GetSession().Query(query, dayBucket, limit).Iter()
 	var images []models.Image
 	var img models.Image
@@ -43,7 +45,7 @@ func GetFeed(c *gin.Context) {
 
 	// First, collect all images and unique user IDs
 	var tempImages []models.Image
-	for iter.Scan(&img.ImageID, &img.UserID, &img.Username, &img.ImageURL, &img.Title, &img.UploadedAt) {
+	for iter.Scan(&img.ImageID, &img.UserID, &img.Username, &img.ImageURL, &img.Title, &img.Description, &img.AltText, &img.EditedAt, &img.UploadedAt, &img.BlurHash, &img.DominantColor, &img.ItemCount) {
 		tempImages = append(tempImages, img)
 		userProfilePictures[img.UserID.String()] = "" // Initialize with empty string
 	}
@@ -64,11 +66,131 @@ func GetFeed(c *gin.Context) {
 		}
 	}
 
-	// Now build the final images array with current profile pictures
+	// Now build the final images array with current profile pictures,
+	// sin los usuarios silenciados o bloqueados por quien mira
+	hidden, err := hiddenAuthors(c.GetString("user_id"), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
 	for _, img := range tempImages {
+		if hidden[img.UserID] {
+			continue
+		}
 		img.UserProfilePictureURL = userProfilePictures[img.UserID.String()]
 		images = append(images, img)
 	}
+	attachPostItems(images)
 
 	c.JSON(http.StatusOK, images)
 }
+
+// hydrateImages loads the given images from images_by_id in order, drops
+// the ones viewerID may not see and fills in the current profile pictures
+// and gallery items. Used by the listings that index images by ID.
+func hydrateImages(viewerID string, ids []gocql.UUID) ([]models.Image, error) {
+	loaded, err := db.GetImagesByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]models.Image, 0, len(loaded))
+	profilePictures := make(map[gocql.UUID]string)
+	access := newViewerAccess(viewerID)
+	for _, img := range loaded {
+		if !access.canView(img) {
+			continue
+		}
+		picture, ok := profilePictures[img.UserID]
+		if !ok {
+			if err := db.GetSession().Query(`SELECT profile_picture_url FROM users_by_id WHERE user_id = ?`, img.UserID).Scan(&picture); err != nil {
+				picture = ""
+			}
+			profilePictures[img.UserID] = picture
+		}
+		img.UserProfilePictureURL = picture
+		images = append(images, img)
+	}
+	attachPostItems(images)
+	return images, nil
+}
+
+// GetTrendingFeed godoc
+// @Summary Get the trending images
+// @Description Recent public images ranked by a time-decayed score of their likes, views and comments. The ranking is recomputed in the background every TRENDING_INTERVAL (10 minutes by default); computed_at says when. Send a JWT to leave out muted and blocked users. Paginate with the next_offset value of the previous page.
+// @Tags Images
+// @Produce json
+// @Param window query string false "Ranking window: 24h (default) or 7d" Enums(24h, 7d)
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of ranked images to skip"
+// @Success 200 {object} map[string]interface{} "window, computed_at, images and next_offset"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /feed/trending [get]
+func GetTrendingFeed(c *gin.Context) {
+	window := c.DefaultQuery("window", "24h")
+	if _, ok := db.TrendingPeriods[window]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid window. Use 24h or 7d.",
+			"documentation": "https://docs.osohub.com/images#trending",
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	limit := queryLimit(c, 20, 100)
+	entries, computedAt, err := db.GetTrending(window, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch trending images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	viewerID := c.GetString("user_id")
+	hidden, err := hiddenAuthors(viewerID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch trending images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	ids := make([]gocql.UUID, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ImageID)
+	}
+	loaded, err := hydrateImages(viewerID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch trending images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	// la clasificación puede tener imágenes que ya no son públicas
+	images := make([]models.Image, 0, len(loaded))
+	for _, img := range loaded {
+		public := img.Visibility == "" || img.Visibility == models.VisibilityPublic
+		if public && !hidden[img.UserID] {
+			images = append(images, img)
+		}
+	}
+
+	var nextOffset *int
+	if len(entries) == limit {
+		next := offset + limit
+		nextOffset = &next
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"window":      window,
+		"computed_at": computedAt,
+		"images":      images,
+		"next_offset": nextOffset,
+	})
+}
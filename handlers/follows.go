@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// homeFeedMaxFollowing caps how many followed users the home feed reads
+// from (it fans out on read, one query per followed user, several at a
+// time). It is documented in GET /feed/home.
+const homeFeedMaxFollowing = 2000
+
+// userTarget parses the user in the path and the current user, and checks
+// that the target exists and is not the current user. action names the
+// operation in the error messages ("follow", "block", ...).
+func userTarget(c *gin.Context, action string) (gocql.UUID, gocql.UUID, bool) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	targetID, err := gocql.ParseUUID(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid user_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/users#" + action,
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "You cannot " + action + " yourself.",
+			"documentation": "https://docs.osohub.com/users#" + action,
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	var username string
+	if err := db.GetSession().Query(`SELECT username FROM users_by_id WHERE user_id = ?`, targetID).Scan(&username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "User not found.",
+			"documentation": "https://docs.osohub.com/users#" + action,
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	return userID, targetID, true
+}
+
+// followTarget is userTarget for follows: users blocked in either
+// direction cannot follow each other and look like they do not exist.
+func followTarget(c *gin.Context) (gocql.UUID, gocql.UUID, bool) {
+	followerID, followedID, ok := userTarget(c, "follow")
+	if !ok {
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	if blockedBetween(followerID.String(), followedID) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "User not found.",
+			"documentation": "https://docs.osohub.com/users#follow",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	return followerID, followedID, true
+}
+
+// FollowUser godoc
+// @Summary Follow a user
+// @Description Their public and followers-only images show up in GET /feed/home. Following someone twice is a no-op.
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/follow [post]
+func FollowUser(c *gin.Context) {
+	followerID, followedID, ok := followTarget(c)
+	if !ok {
+		return
+	}
+	followed, err := db.Follow(followerID, followedID, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not follow user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if followed {
+		notify(followedID, models.Notification{Type: models.NotificationFollow, ActorID: &followerID})
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnfollowUser godoc
+// @Summary Unfollow a user
+// @Tags Auth & Users
+// @Security BearerAuth
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{user_id}/follow [delete]
+func UnfollowUser(c *gin.Context) {
+	followerID, followedID, ok := followTarget(c)
+	if !ok {
+		return
+	}
+	removed, err := db.Unfollow(followerID, followedID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not unfollow user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "You do not follow this user.",
+			"documentation": "https://docs.osohub.com/users#follow",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetHomeFeed godoc
+// @Summary Get the current user's home feed
+// @Description Latest images of the users you follow and your own, newest first. Unlisted, scheduled and deleted images and muted users are left out. Paginate with the next_before value of the previous page; a page can hold fewer than limit images. Only the first 2000 followed accounts (in no particular order) are read.
+// @Tags Images
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query string false "Cursor: only images uploaded before this time (RFC 3339)"
+// @Success 200 {object} map[string]interface{} "images and next_before"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /feed/home [get]
+func GetHomeFeed(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+	before, ok := queryBefore(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid before. Use the next_before value of the previous page (RFC 3339).",
+			"documentation": "https://docs.osohub.com/images#home-feed",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+
+	following, err := db.GetFollowing(userID, homeFeedMaxFollowing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch home feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	entries, err := db.GetTimeline(append(following, userID), before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch home feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	// el cursor sale de la página sin filtrar, así no se saltan imágenes
+	var nextBefore *time.Time
+	if len(entries) == limit {
+		last := entries[limit-1].UploadedAt
+		nextBefore = &last
+	}
+	// las no listadas y las de usuarios silenciados no salen; el resto de permisos los aplica hydrateImages
+	muted, err := db.GetMutedIDs(userID)
+	if err != nil {
+		log.Printf("Error loading mutes of %v: %v", userID, err)
+	}
+	ids := make([]gocql.UUID, 0, len(entries))
+	for _, e := range entries {
+		if e.UserID != userID && (e.Visibility == models.VisibilityUnlisted || muted[e.UserID]) {
+			continue
+		}
+		ids = append(ids, e.ImageID)
+	}
+	images, err := hydrateImages(userID.String(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch home feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"images":      images,
+		"next_before": nextBefore,
+	})
+}
@@ -1,25 +1,22 @@
 package handlers
 
 import (
-	"context"
-	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"os"
 	"osohub/db"
 	"osohub/models"
-	"path/filepath"
-	"strings"
+	"osohub/search"
+	"osohub/webhooks"
 	"time"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
-	"github.com/google/uuid"
 )
 
 // LikeImage godoc
 // @Summary Like an image (one like per user)
+// @Description Same as reacting with "heart": it replaces any other reaction of the user.
 // @Param image_id path string true "Image ID"
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]interface{}
@@ -28,57 +25,25 @@ import (
 // @Router /images/{image_id}/like [post]
 // @Tags Images
 func LikeImage(c *gin.Context) {
-	imageIDStr := c.Param("image_id")
-	imageID, err := gocql.ParseUUID(imageIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "Invalid image_id. Must be a valid UUID.",
-			"documentation": "https://docs.osohub.com/images#like",
-		})
-		return
-	}
-	userIDStr, ok := c.Get("user_id")
+	imageID, userID, ok := reactionImageAndUser(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":         "Unauthorized.",
-			"documentation": "https://docs.osohub.com/auth#jwt",
-		})
 		return
 	}
-	userID, err := gocql.ParseUUID(userIDStr.(string))
+	changed, err := db.SetReaction(imageID, userID, db.ReactionHeart)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "Invalid user_id. Must be a valid UUID.",
-			"documentation": "https://docs.osohub.com/auth#jwt",
-		})
+		reactionError(c, err)
 		return
 	}
-	var exists gocql.UUID
-	err = db.GetSession().Query(`SELECT user_id FROM likes_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Scan(&exists)
-	if err == nil {
-		c.Status(http.StatusNoContent)
-		return
-	}
-	now := time.Now()
-	if err := db.GetSession().Query(`INSERT INTO likes_by_image (image_id, user_id, liked_at) VALUES (?, ?, ?)`, imageID, userID, now).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Error liking image. Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
-	}
-	if err := db.GetSession().Query(`UPDATE image_counters SET likes = likes + 1 WHERE image_id = ?`, imageID).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Error updating like counter. Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
+	if changed {
+		announceLike(imageID, userID)
+		publishLikeCount(imageID)
 	}
 	c.Status(http.StatusNoContent)
 }
 
 // UnlikeImage godoc
 // @Summary Remove like from an image
+// @Description Removes the "heart" reaction; other reactions are kept.
 // @Param image_id path string true "Image ID"
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]interface{}
@@ -87,54 +52,26 @@ func LikeImage(c *gin.Context) {
 // @Router /images/{image_id}/like [delete]
 // @Tags Images
 func UnlikeImage(c *gin.Context) {
-	imageIDStr := c.Param("image_id")
-	imageID, err := gocql.ParseUUID(imageIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "Invalid image_id. Must be a valid UUID.",
-			"documentation": "https://docs.osohub.com/images#like",
-		})
-		return
-	}
-	userIDStr, ok := c.Get("user_id")
+	imageID, userID, ok := reactionImageAndUser(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":         "Unauthorized.",
-			"documentation": "https://docs.osohub.com/auth#jwt",
-		})
-		return
-	}
-	userID, err := gocql.ParseUUID(userIDStr.(string))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "Invalid user_id. Must be a valid UUID.",
-			"documentation": "https://docs.osohub.com/auth#jwt",
-		})
 		return
 	}
-	if err := db.GetSession().Query(`DELETE FROM likes_by_image WHERE image_id = ? AND user_id = ?`, imageID, userID).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Error removing like. Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
-	}
-	if err := db.GetSession().Query(`UPDATE image_counters SET likes = likes - 1 WHERE image_id = ?`, imageID).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Error updating like counter. Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
+	if err := db.RemoveReaction(imageID, userID, db.ReactionHeart); err != nil {
+		reactionError(c, err)
 		return
 	}
+	publishLikeCount(imageID)
 	c.Status(http.StatusNoContent)
 }
 
 // GetImageLikesCount godoc
 // @Summary Get like count for an image
+// @Description Images the viewer may not see (private, followers-only, scheduled, deleted or from a blocked user) answer 404. Send a JWT to be identified.
 // @Param image_id path string true "Image ID"
 // @Success 200 {object} map[string]int64
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
 // @Router /images/{image_id}/likes/count [get]
 // @Tags Images
 func GetImageLikesCount(c *gin.Context) {
@@ -147,30 +84,35 @@ func GetImageLikesCount(c *gin.Context) {
 		})
 		return
 	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
 	var likes int64
 	err = db.GetSession().Query(`SELECT likes FROM image_counters WHERE image_id = ?`, imageID).Scan(&likes)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":         "Image not found or no likes.",
-			"documentation": "https://docs.osohub.com/images#like",
+	if err != nil && err != gocql.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch like count. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
 		})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"likes": likes})
+	c.JSON(http.StatusOK, gin.H{"likes": likes}) // sin fila en image_counters: ningún like
 }
 
 // DeleteImage godoc
-// @Summary Delete an image by ID (solo el dueño puede borrar)
+// @Summary Move an image to the trash (the owner, or an admin as moderation)
+// @Description The image disappears from the feed and the profile but keeps its likes and reports. It can be restored with POST /images/{image_id}/restore until it is purged after TRASH_RETENTION_DAYS. When an admin removes someone else's image, the owner and the users who reported it are notified, and only an admin can restore it.
 // @Param image_id path string true "Image ID"
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /images/{image_id} [delete]
 // @Tags Images
 func DeleteImage(c *gin.Context) {
-	imageID := c.Param("image_id")
-	if _, err := uuid.Parse(imageID); err != nil {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":         "Invalid image_id. Must be a valid UUID.",
 			"documentation": "https://docs.osohub.com/images#delete",
@@ -184,55 +126,42 @@ func DeleteImage(c *gin.Context) {
 		c.JSON(401, gin.H{"error": "Unauthorized"})
 		return
 	}
-	var ownerID gocql.UUID
-	var dayBucket string
-	var uploadedAt time.Time
-	err := db.GetSession().Query(`SELECT user_id, day_bucket, uploaded_at FROM images_by_id WHERE image_id = ?`, imageID).Scan(&ownerID, &dayBucket, &uploadedAt)
-	if err != nil {
+	ref, err := db.GetImageRef(imageID)
+	if err != nil || ref.DeletedAt != nil {
 		c.JSON(404, gin.H{"error": "Image not found"})
 		return
 	}
-	if ownerID.String() != userIDStr {
+	// si la borra un admin que no es el dueño, es una decisión de moderación
+	moderated := ref.UserID.String() != userIDStr && c.GetString("role") == models.RoleAdmin
+	if ref.UserID.String() != userIDStr && !moderated {
 		c.JSON(403, gin.H{"error": "You are not the owner of this image"})
 		return
 	}
-
-	// Borra de images_by_id
-	if err := db.GetSession().Query(`DELETE FROM images_by_id WHERE image_id = ?`, imageID).Exec(); err != nil {
-		c.JSON(500, gin.H{"error": "Error deleting image (by_id)"})
-		return
-	}
-	// Borra de images_by_date
-	if err := db.GetSession().Query(`DELETE FROM images_by_date WHERE day_bucket = ? AND uploaded_at = ? AND image_id = ?`, dayBucket, uploadedAt, imageID).Exec(); err != nil {
-		c.JSON(500, gin.H{
-			"error":         "Error deleting image (by_date). Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
-	}
-	// Borra de images_by_user
-	if err := db.GetSession().Query(`DELETE FROM images_by_user WHERE user_id = ? AND uploaded_at = ? AND image_id = ?`, ownerID, uploadedAt, imageID).Exec(); err != nil {
-		c.JSON(500, gin.H{"error": "Error deleting image (by_user)"})
-		return
-	}
-	// Borra de image_counters
-	if err := db.GetSession().Query(`DELETE FROM image_counters WHERE image_id = ?`, imageID).Exec(); err != nil {
-		c.JSON(500, gin.H{"error": "Error deleting image (counters)"})
-		return
-	}
-	// Borra de likes_by_image
-	if err := db.GetSession().Query(`DELETE FROM likes_by_image WHERE image_id = ?`, imageID).Exec(); err != nil {
-		c.JSON(500, gin.H{"error": "Error deleting image (likes)"})
-		return
+	if moderated {
+		if err := db.SetRemovedByModerator(imageID, true); err != nil {
+			log.Printf("Error marking image %v as removed by a moderator: %v", imageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Error deleting image. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
 	}
-	// Borra de reports_by_image
-	if err := db.GetSession().Query(`DELETE FROM reports_by_image WHERE image_id = ?`, imageID).Exec(); err != nil {
+
+	// Se mueve a la papelera; el job de purga la borra definitivamente
+	if err := db.TrashImage(*ref, time.Now().UTC()); err != nil {
+		log.Printf("Error moving image %v to trash: %v", imageID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Error deleting image (reports). Please try again later.",
+			"error":         "Error deleting image. Please try again later.",
 			"documentation": "https://docs.osohub.com/errors#internal",
 		})
 		return
 	}
+	search.RemoveImage(imageID)
+	webhooks.ImageDeleted(*ref, false)
+	if moderated {
+		notifyImageModeration(*ref, "Your image was removed by a moderator.", "An image you reported was removed. Thanks for your report.")
+	}
 	c.Status(204)
 }
 
@@ -249,6 +178,11 @@ type UploadImageRequest struct {
 // @Security BearerAuth
 // @Param image formData file true "Image file (JPG, PNG, GIF, WebP, max 10MB)"
 // @Param title formData string true "Image title (max 100 characters)"
+// @Param description formData string false "Image description (max 2000 characters)"
+// @Param alt_text formData string false "Alternative text for screen readers (max 1000 characters)"
+// @Param visibility formData string false "public (default), unlisted, followers or private" Enums(public, unlisted, followers, private)
+// @Param publish_at formData string false "Scheduled publish time (RFC 3339). The image is stored now but only appears in the feed and profile from then on"
+// @Param tags formData []string false "Tags besides the #hashtags of the title (comma-separated or repeated, max 10)" collectionFormat(multi)
 // @Success 201 {object} models.Image
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
@@ -281,142 +215,64 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
-	// Validar tipo de archivo
-	allowedTypes := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
-	fileExt := strings.ToLower(filepath.Ext(file.Filename))
-	isValidType := false
-	for _, ext := range allowedTypes {
-		if fileExt == ext {
-			isValidType = true
-			break
-		}
-	}
-	if !isValidType {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid file type. Allowed: JPG, PNG, GIF, WebP",
-		})
+	title := c.PostForm("title")
+	description := c.PostForm("description")
+	altText := c.PostForm("alt_text")
+	if uerr := validateUploadMetadata(file.Filename, file.Size, title); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
 		return
 	}
-
-	// Validar tamaño (máximo 10MB)
-	if file.Size > 10*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "File too large. Maximum size: 10MB",
-		})
+	if uerr := validateImageText(description, altText); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
 		return
 	}
-
-	// Obtener título
-	title := c.PostForm("title")
-	if title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Title is required",
-		})
-		return
-	}
-
-	// Validar longitud del título
-	if len(title) > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Title too long. Maximum 100 characters.",
-		})
+	visibility, ok := normalizeVisibility(c.PostForm("visibility"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility. Use public, unlisted, followers or private."})
 		return
 	}
-	// Configurar Cloudinary usando CLOUDINARY_URL (método recomendado)
-	cloudinaryURL := os.Getenv("CLOUDINARY_URL")
-	if cloudinaryURL == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "CLOUDINARY_URL not configured"})
+	publishAt, uerr := parsePublishAt(c.PostForm("publish_at"))
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
 		return
 	}
-
-	fmt.Printf("DEBUG Cloudinary URL: %s\n", cloudinaryURL)
-
-	cld, err := cloudinary.NewFromURL(cloudinaryURL)
-	if err != nil {
-		fmt.Printf("DEBUG Cloudinary config error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cloudinary configuration error"})
+	tags, uerr := parseTagList(c.PostFormArray("tags"))
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
 		return
 	}
 
-	// Abrir archivo
+	// Leer el archivo completo (máx. 10MB) para poder analizarlo antes de subirlo
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not open uploaded file"})
 		return
 	}
-	defer src.Close()
-
-	// Subir a Cloudinary
-	uploadParams := uploader.UploadParams{
-		PublicID: fmt.Sprintf("osohub/%d_%s", time.Now().Unix(), strings.TrimSuffix(file.Filename, fileExt)),
-		Folder:   "osohub-images",
-	}
-
-	fmt.Printf("DEBUG Upload params: %+v\n", uploadParams)
-
-	result, err := cld.Upload.Upload(context.Background(), src, uploadParams)
+	data, err := io.ReadAll(src)
+	src.Close()
 	if err != nil {
-		fmt.Printf("DEBUG Cloudinary upload error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image to Cloudinary", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read uploaded file"})
 		return
 	}
 
-	fmt.Printf("DEBUG Cloudinary result: %+v\n", result)
-
-	// URL de Cloudinary (ya optimizada)
-	imageURL := result.SecureURL
-	fmt.Printf("DEBUG imageURL: %s\n", imageURL)
-
-	// Obtener información del usuario para el username y profile_picture_url
-	var username, userProfilePictureURL string
-	if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, userID).Scan(&username, &userProfilePictureURL); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
-		return
-	}
-
-	imageID := gocql.TimeUUID()
-	uploadedAt := imageID.Time()
-	dayBucket := uploadedAt.Format("2006-01-02")
-
-	// Insert into images_by_id
-	if err := db.GetSession().Query(`INSERT INTO images_by_id (image_id, day_bucket, uploaded_at, user_id, username, user_profile_picture_url, image_url, title) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		imageID, dayBucket, uploadedAt, userID, username, userProfilePictureURL, imageURL, title).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving image (by_id)"})
-		return
-	}
-
-	// Insert into images_by_date
-	if err := db.GetSession().Query(`INSERT INTO images_by_date (day_bucket, uploaded_at, image_id, user_id, username, user_profile_picture_url, image_url, title) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		dayBucket, uploadedAt, imageID, userID, username, userProfilePictureURL, imageURL, title).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Could not save image (by_date). Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
-	}
-
-	// Insert into images_by_user
-	if err := db.GetSession().Query(`INSERT INTO images_by_user (user_id, uploaded_at, image_id, user_profile_picture_url, image_url, title) VALUES (?, ?, ?, ?, ?, ?)`,
-		userID, uploadedAt, imageID, userProfilePictureURL, imageURL, title).Exec(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving image (by_user)"})
+	image, uerr := saveImageUpload(c, userID, imageUpload{
+		Files:       []uploadFile{{Filename: file.Filename, Data: data, AltText: altText}},
+		Title:       title,
+		Description: description,
+		Visibility:  visibility,
+		PublishAt:   publishAt,
+		Tags:        tags,
+	})
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
 		return
 	}
-
-	image := models.Image{
-		ImageID:               imageID,
-		DayBucket:             dayBucket,
-		UploadedAt:            uploadedAt,
-		UserID:                userID,
-		Username:              username,
-		UserProfilePictureURL: userProfilePictureURL,
-		ImageURL:              imageURL,
-		Title:                 title,
-	}
 	c.JSON(http.StatusCreated, image)
 }
 
 // GetImagesByUser godoc
 // @Summary Get all images for a user (profile)
+// @Description Unlisted, followers-only and private images are only included for viewers allowed to see them (send a JWT to be identified).
 // @Produce json
 // @Param user_id path string true "User ID"
 // @Success 200 {array} models.Image
@@ -437,7 +293,8 @@ func GetImagesByUser(c *gin.Context) {
 	// First get user info (username and profile picture)
 	var username, userProfilePictureURL string
 	userQuery := `SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`
-	if err := db.GetSession().Query(userQuery, userID).Scan(&username, &userProfilePictureURL); err != nil {
+	viewerID := c.GetString("user_id")
+	if err := db.GetSession().Query(userQuery, userID).Scan(&username, &userProfilePictureURL); err != nil || blockedBetween(viewerID, userID) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":         "User not found.",
 			"documentation": "https://docs.osohub.com/users#images",
@@ -446,12 +303,17 @@ func GetImagesByUser(c *gin.Context) {
 	}
 
 	// Then get user's images
-	query := `SELECT uploaded_at, image_id, image_url, title FROM images_by_user WHERE user_id = ?`
+	query := `SELECT uploaded_at, image_id, image_url, title, description, alt_text, edited_at, blurhash, dominant_color, item_count, visibility, deleted_at FROM images_by_user WHERE user_id = ?`
 	iter := db.GetSession().Query(query, userID).Iter()
+	access := newViewerAccess(viewerID)
 	var images []models.Image
 	var img models.Image
-	for iter.Scan(&img.UploadedAt, &img.ImageID, &img.ImageURL, &img.Title) {
+	for iter.Scan(&img.UploadedAt, &img.ImageID, &img.ImageURL, &img.Title, &img.Description, &img.AltText, &img.EditedAt, &img.BlurHash, &img.DominantColor, &img.ItemCount, &img.Visibility, &img.DeletedAt) {
 		img.UserID = userID
+		if !access.listed(img) {
+			continue
+		}
+		img.Scheduled = img.UploadedAt.After(time.Now())
 		img.Username = username
 		// Usar siempre la foto de perfil actual del usuario, no la guardada en las imágenes
 		img.UserProfilePictureURL = userProfilePictureURL
@@ -464,11 +326,13 @@ func GetImagesByUser(c *gin.Context) {
 		})
 		return
 	}
+	attachPostItems(images)
 	c.JSON(http.StatusOK, images)
 }
 
 // GetImageByIDByOnlyID godoc
 // @Summary Get image by ID (direct, for Swagger compatibility)
+// @Description Private and followers-only images are returned only to viewers allowed to see them (send a JWT to be identified). Images in the trash are only returned to admins. Counts as a view of the image (see GET /images/{image_id}/stats).
 // @Produce json
 // @Param image_id path string true "Image ID"
 // @Success 200 {object} models.Image
@@ -487,9 +351,10 @@ func GetImageByIDByOnlyID(c *gin.Context) {
 		return
 	}
 	var image models.Image
-	query := `SELECT image_id, day_bucket, uploaded_at, user_id, username, image_url, title FROM images_by_id WHERE image_id = ? LIMIT 1`
+	query := `SELECT image_id, day_bucket, uploaded_at, user_id, username, image_url, title, description, alt_text, edited_at, blurhash, dominant_color, item_count, visibility, deleted_at, tags FROM images_by_id WHERE image_id = ? LIMIT 1`
 	if err := db.GetSession().Query(query, imageID).Consistency(gocql.One).Scan(
 		&image.ImageID, &image.DayBucket, &image.UploadedAt, &image.UserID, &image.Username, &image.ImageURL, &image.Title,
+		&image.Description, &image.AltText, &image.EditedAt, &image.BlurHash, &image.DominantColor, &image.ItemCount, &image.Visibility, &image.DeletedAt, &image.Tags,
 	); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":         "Image not found.",
@@ -497,6 +362,18 @@ func GetImageByIDByOnlyID(c *gin.Context) {
 		})
 		return
 	}
+	// Las imágenes privadas, solo para seguidores o en la papelera se ocultan como
+	// inexistentes; los admins siguen viendo las borradas (evidencia para moderación)
+	trashedForAdmin := image.DeletedAt != nil && c.GetString("role") == models.RoleAdmin
+	if !canViewImage(c.GetString("user_id"), image) && !trashedForAdmin {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found.",
+			"documentation": "https://docs.osohub.com/images#byid",
+		})
+		return
+	}
+
+	image.Scheduled = image.UploadedAt.After(time.Now())
 
 	// Get current user profile picture
 	var userProfilePictureURL string
@@ -505,14 +382,29 @@ func GetImageByIDByOnlyID(c *gin.Context) {
 		image.UserProfilePictureURL = userProfilePictureURL
 	}
 
+	if image.ItemCount > 1 {
+		items, err := db.GetPostItems(image.ImageID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not fetch post images. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		image.Items = items
+	}
+
+	if !trashedForAdmin {
+		recordView(c, image)
+	}
 	c.JSON(http.StatusOK, image)
 }
 
 // GetImageLikeStatus godoc
-// @Summary Check if current user has liked an image
+// @Summary Check if current user has liked and bookmarked an image
 // @Produce json
 // @Param image_id path string true "Image ID"
-// @Success 200 {object} map[string]bool "Returns {'liked': true/false}"
+// @Success 200 {object} map[string]interface{} "Returns {'liked': true/false, 'bookmarked': true/false} with liked_at and bookmarked_at when set"
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Security BearerAuth
@@ -547,6 +439,19 @@ func GetImageLikeStatus(c *gin.Context) {
 		return
 	}
 
+	bookmarkedAt, err := db.GetBookmark(imageID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Database error while checking bookmark status.",
+			"documentation": "https://docs.osohub.com/images#like-status",
+		})
+		return
+	}
+	status := gin.H{"liked": false, "bookmarked": bookmarkedAt != nil}
+	if bookmarkedAt != nil {
+		status["bookmarked_at"] = *bookmarkedAt
+	}
+
 	// Verificar si el usuario ya le dio like a esta imagen
 	var likedAt time.Time
 	query := `SELECT liked_at FROM likes_by_image WHERE image_id = ? AND user_id = ?`
@@ -555,9 +460,7 @@ func GetImageLikeStatus(c *gin.Context) {
 	if err != nil {
 		if err == gocql.ErrNotFound {
 			// El usuario no le ha dado like a esta imagen
-			c.JSON(http.StatusOK, gin.H{
-				"liked": false,
-			})
+			c.JSON(http.StatusOK, status)
 			return
 		}
 		// Error de base de datos
@@ -569,8 +472,7 @@ func GetImageLikeStatus(c *gin.Context) {
 	}
 
 	// El usuario ya le dio like a esta imagen
-	c.JSON(http.StatusOK, gin.H{
-		"liked":    true,
-		"liked_at": likedAt,
-	})
+	status["liked"] = true
+	status["liked_at"] = likedAt
+	c.JSON(http.StatusOK, status)
 }
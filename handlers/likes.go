@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"osohub/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Liker is a user who liked an image.
+type Liker struct {
+	UserID            gocql.UUID `json:"user_id"`
+	Username          string     `json:"username"`
+	ProfilePictureURL string     `json:"profile_picture_url"`
+	LikedAt           time.Time  `json:"liked_at"`
+}
+
+// GetImageLikes godoc
+// @Summary List the users who liked an image
+// @Description Paginate with the next_cursor value of the previous page (null on the last page).
+// @Tags Images
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "likes and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/likes [get]
+func GetImageLikes(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#likes",
+		})
+		return
+	}
+	// el cursor es el paging state de Cassandra (likes_by_image se ordena por user_id)
+	pageState, err := base64.RawURLEncoding.DecodeString(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid cursor. Use the next_cursor value of the previous page.",
+			"documentation": "https://docs.osohub.com/images#likes",
+		})
+		return
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
+	if len(pageState) == 0 {
+		pageState = nil
+	}
+	likes, next, err := db.GetImageLikes(imageID, pageState, queryLimit(c, 20, 100))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch likes. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	likers := make([]Liker, 0, len(likes))
+	for _, l := range likes {
+		liker := Liker{UserID: l.UserID, LikedAt: l.LikedAt}
+		if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, l.UserID).Scan(&liker.Username, &liker.ProfilePictureURL); err != nil {
+			log.Printf("Error loading liker %v: %v", l.UserID, err)
+		}
+		likers = append(likers, liker)
+	}
+	var nextCursor *string
+	if len(next) > 0 {
+		encoded := base64.RawURLEncoding.EncodeToString(next)
+		nextCursor = &encoded
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"likes":       likers,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetMyLikes godoc
+// @Summary List the images the current user liked (most recent like first)
+// @Description Images that are no longer visible (deleted or made private) are left out. Paginate with the next_before value of the previous page.
+// @Tags Images
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query string false "Cursor: only likes made before this time (RFC 3339)"
+// @Success 200 {object} map[string]interface{} "images and next_before"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/likes [get]
+func GetMyLikes(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+	before, ok := queryBefore(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid before. Use the next_before value of the previous page (RFC 3339).",
+			"documentation": "https://docs.osohub.com/users#likes",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+	likes, err := db.GetUserLikes(userID, before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch likes. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	ids := make([]gocql.UUID, 0, len(likes))
+	for _, l := range likes {
+		ids = append(ids, l.ImageID)
+	}
+	images, err := hydrateImages(userID.String(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch likes. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	var nextBefore *time.Time
+	if len(likes) == limit {
+		last := likes[len(likes)-1].LikedAt
+		nextBefore = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"images":      images,
+		"next_before": nextBefore,
+	})
+}
@@ -0,0 +1,563 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/realtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxMessageLength is the maximum length of a direct message, in characters.
+const maxMessageLength = 2000
+
+// StartConversationRequest is the body of POST /conversations.
+type StartConversationRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// SendMessageRequest is the body of POST /conversations/{conversation_id}/messages.
+type SendMessageRequest struct {
+	Body    string `json:"body,omitempty"`
+	ImageID string `json:"image_id,omitempty"` // imagen a compartir
+}
+
+// MarkReadRequest is the optional body of POST /conversations/{conversation_id}/read.
+type MarkReadRequest struct {
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// loadConversation loads the conversation in the path if the current user
+// takes part in it and there is no block between the participants. It
+// writes the error response and returns nil otherwise.
+func loadConversation(c *gin.Context) (*db.ConversationRef, gocql.UUID) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, userID
+	}
+	conversationID, err := gocql.ParseUUID(c.Param("conversation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid conversation_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return nil, userID
+	}
+	ref, err := db.GetConversation(conversationID)
+	if err != nil && err != gocql.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch conversation. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return nil, userID
+	}
+	if ref == nil || !ref.Has(userID) || blockedBetween(userID.String(), ref.Other(userID)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Conversation not found.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return nil, userID
+	}
+	return ref, userID
+}
+
+// conversationUsers loads the username and profile picture of users.
+func conversationUsers(ids []gocql.UUID) map[gocql.UUID]models.User {
+	users := make(map[gocql.UUID]models.User, len(ids))
+	for _, id := range ids {
+		if _, ok := users[id]; ok {
+			continue
+		}
+		u := models.User{UserID: id}
+		if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, id).Scan(&u.Username, &u.ProfilePictureURL); err != nil {
+			log.Printf("Error loading conversation user %v: %v", id, err)
+		}
+		users[id] = u
+	}
+	return users
+}
+
+// conversationView builds a conversation as seen by userID.
+func conversationView(userID gocql.UUID, uc db.UserConversation, other models.User) models.Conversation {
+	conv := models.Conversation{
+		ConversationID:         uc.ConversationID,
+		OtherUserID:            uc.OtherUserID,
+		OtherUsername:          other.Username,
+		OtherProfilePictureURL: other.ProfilePictureURL,
+		Unread:                 uc.Unread(userID),
+		CreatedAt:              uc.CreatedAt,
+		UpdatedAt:              uc.UpdatedAt(),
+	}
+	if uc.LastMessage != nil {
+		last := *uc.LastMessage
+		last.Read = messageRead(userID, last, uc)
+		conv.LastMessage = &last
+	}
+	return conv
+}
+
+// messageRead reports whether the recipient of m read it: the other user
+// for userID's messages, userID for the other's.
+func messageRead(userID gocql.UUID, m models.Message, uc db.UserConversation) bool {
+	mark := uc.LastReadID
+	if m.SenderID == userID {
+		mark = uc.OtherReadID
+	}
+	return mark != nil && !mark.Time().Before(m.CreatedAt)
+}
+
+// attachMessageImages adds the shared images the viewer can see.
+func attachMessageImages(viewerID gocql.UUID, messages []models.Message) {
+	var ids []gocql.UUID
+	for _, m := range messages {
+		if m.ImageID != nil {
+			ids = append(ids, *m.ImageID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	images, err := hydrateImages(viewerID.String(), ids)
+	if err != nil {
+		log.Printf("Error loading images shared in messages: %v", err)
+		return
+	}
+	byID := make(map[gocql.UUID]models.Image, len(images))
+	for _, img := range images {
+		byID[img.ImageID] = img
+	}
+	for i := range messages {
+		if messages[i].ImageID == nil {
+			continue
+		}
+		if img, ok := byID[*messages[i].ImageID]; ok {
+			messages[i].Image = &img
+		}
+	}
+}
+
+// StartConversation godoc
+// @Summary Start a conversation with a user (or get the existing one)
+// @Description Each pair of users has a single conversation, so this is idempotent. It shows up in the other user's conversations once a message is sent. Users who blocked each other cannot message.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param conversation body StartConversationRequest true "User to talk to"
+// @Success 200 {object} models.Conversation "Existing conversation"
+// @Success 201 {object} models.Conversation "New conversation"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /conversations [post]
+func StartConversation(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req StartConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "user_id is required.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	otherID, err := gocql.ParseUUID(req.UserID)
+	if err != nil || otherID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid user_id. Must be the UUID of another user.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	var other models.User
+	err = db.GetSession().Query(`SELECT username, profile_picture_url, role FROM users_by_id WHERE user_id = ?`, otherID).Scan(&other.Username, &other.ProfilePictureURL, &other.Role)
+	if err != nil && err != gocql.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch user. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if err == gocql.ErrNotFound || other.Role == models.RoleBanned || blockedBetween(userID.String(), otherID) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "User not found",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+
+	ref, created, err := db.StartConversation(userID, otherID, time.Now().UTC().Truncate(time.Millisecond))
+	if err != nil {
+		log.Printf("Error starting conversation between %v and %v: %v", userID, otherID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not start conversation. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	uc, err := db.GetUserConversation(userID, ref.ConversationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not start conversation. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, conversationView(userID, *uc, other))
+}
+
+// GetMyConversations godoc
+// @Summary List the current user's conversations (most recent activity first)
+// @Description Each conversation has the other user, the last message (with read set once the recipient read it) and whether it has unread messages. Conversations with blocked users are left out. Paginate with the next_before value of the previous page.
+// @Tags Messages
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query string false "Only conversations with activity before this time (RFC 3339)"
+// @Success 200 {object} map[string]interface{} "conversations and next_before"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/conversations [get]
+func GetMyConversations(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	before, ok := queryBefore(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid before. Use the next_before value of the previous page.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+	hidden, err := hiddenAuthors(userID.String(), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch conversations. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	page, err := db.GetUserConversations(userID, before, limit, func(uc db.UserConversation) bool {
+		return !hidden[uc.OtherUserID]
+	})
+	if err != nil {
+		log.Printf("Error loading conversations of %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch conversations. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	ids := make([]gocql.UUID, 0, len(page))
+	for _, uc := range page {
+		ids = append(ids, uc.OtherUserID)
+	}
+	users := conversationUsers(ids)
+	conversations := make([]models.Conversation, 0, len(page))
+	lastMessages := make([]models.Message, 0, len(page))
+	for _, uc := range page {
+		conv := conversationView(userID, uc, users[uc.OtherUserID])
+		conversations = append(conversations, conv)
+		if conv.LastMessage != nil {
+			lastMessages = append(lastMessages, *conv.LastMessage)
+		}
+	}
+	attachMessageImages(userID, lastMessages)
+	for i, j := 0, 0; i < len(conversations); i++ {
+		if conversations[i].LastMessage != nil {
+			conversations[i].LastMessage = &lastMessages[j]
+			j++
+		}
+	}
+
+	var nextBefore *string
+	if len(page) == limit {
+		next := page[len(page)-1].UpdatedAt().Format(time.RFC3339Nano)
+		nextBefore = &next
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"next_before":   nextBefore,
+	})
+}
+
+// GetUnreadConversationsCount godoc
+// @Summary Count the current user's conversations with unread messages
+// @Tags Messages
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int "unread_count"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/conversations/unread-count [get]
+func GetUnreadConversationsCount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	rows, err := db.GetUnreadConversations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not count unread conversations. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	hidden, err := hiddenAuthors(userID.String(), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not count unread conversations. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	unread := 0
+	for _, otherID := range rows {
+		if !hidden[otherID] {
+			unread++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"unread_count": unread})
+}
+
+// GetConversationMessages godoc
+// @Summary List the messages of a conversation (newest first)
+// @Description read is true once the recipient read the message. Shared images are included when the current user can see them. Paginate with the next_cursor value of the previous page.
+// @Tags Messages
+// @Produce json
+// @Security BearerAuth
+// @Param conversation_id path string true "Conversation ID"
+// @Param limit query int false "Page size (default 30, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "messages and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /conversations/{conversation_id}/messages [get]
+func GetConversationMessages(c *gin.Context) {
+	ref, userID := loadConversation(c)
+	if ref == nil {
+		return
+	}
+	var cursor *gocql.UUID
+	if raw := c.Query("cursor"); raw != "" {
+		parsed, err := gocql.ParseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid cursor. Use the next_cursor value of the previous page.",
+				"documentation": "https://docs.osohub.com/messages",
+			})
+			return
+		}
+		cursor = &parsed
+	}
+	limit := queryLimit(c, 30, 100)
+	messages, err := db.GetMessages(*ref, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch messages. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	uc, err := db.GetUserConversation(userID, ref.ConversationID)
+	if err != nil && err != gocql.ErrNotFound {
+		log.Printf("Error loading read marks of conversation %v: %v", ref.ConversationID, err)
+	}
+	if uc != nil {
+		for i := range messages {
+			messages[i].Read = messageRead(userID, messages[i], *uc)
+		}
+	}
+	attachMessageImages(userID, messages)
+
+	var nextCursor *gocql.UUID
+	if len(messages) == limit {
+		last := messages[len(messages)-1].MessageID
+		nextCursor = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"messages":    messages,
+		"next_cursor": nextCursor,
+	})
+}
+
+// SendMessage godoc
+// @Summary Send a direct message
+// @Description A message has a body, an image_id to share an image, or both. Only images the sender can see can be shared; the recipient gets the image only if they can see it too. The recipient's open streams get a "message" event.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param conversation_id path string true "Conversation ID"
+// @Param message body SendMessageRequest true "Message"
+// @Success 201 {object} models.Message
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /conversations/{conversation_id}/messages [post]
+func SendMessage(c *gin.Context) {
+	ref, userID := loadConversation(c)
+	if ref == nil {
+		return
+	}
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid body. Send body and/or image_id.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" && req.ImageID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "A message needs a body or an image_id.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Message is too long. Maximum 2000 characters.",
+			"documentation": "https://docs.osohub.com/messages",
+		})
+		return
+	}
+	msg := models.Message{
+		MessageID:      gocql.TimeUUID(),
+		ConversationID: ref.ConversationID,
+		SenderID:       userID,
+		Body:           body,
+	}
+	msg.CreatedAt = msg.MessageID.Time().UTC()
+	if req.ImageID != "" {
+		imageID, err := gocql.ParseUUID(req.ImageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid image_id. Must be a valid UUID.",
+				"documentation": "https://docs.osohub.com/messages",
+			})
+			return
+		}
+		img := loadViewableImage(c, imageID)
+		if img == nil {
+			return
+		}
+		msg.ImageID = &imageID
+	}
+
+	if err := db.InsertMessage(*ref, msg); err != nil {
+		log.Printf("Error sending message in %v: %v", ref.ConversationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not send message. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	recipientID := ref.Other(userID)
+	if realtime.HasSubscribers(realtime.UserTopic(recipientID)) {
+		received := []models.Message{msg}
+		attachMessageImages(recipientID, received)
+		realtime.PublishMessage(recipientID, received[0])
+	}
+	sent := []models.Message{msg}
+	attachMessageImages(userID, sent)
+	realtime.PublishMessage(userID, sent[0]) // otras sesiones del remitente
+	c.JSON(http.StatusCreated, sent[0])
+}
+
+// MarkConversationRead godoc
+// @Summary Mark a conversation as read
+// @Description Marks the messages up to message_id (by default, the last one) as read. The other user sees read receipts on their messages and their open streams get a "read" event. Read marks never move back.
+// @Tags Messages
+// @Accept json
+// @Security BearerAuth
+// @Param conversation_id path string true "Conversation ID"
+// @Param read body MarkReadRequest false "Last message read"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /conversations/{conversation_id}/read [post]
+func MarkConversationRead(c *gin.Context) {
+	ref, userID := loadConversation(c)
+	if ref == nil {
+		return
+	}
+	var req MarkReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid body.",
+				"documentation": "https://docs.osohub.com/messages",
+			})
+			return
+		}
+	}
+	uc, err := db.GetUserConversation(userID, ref.ConversationID)
+	if err != nil && err != gocql.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not mark conversation as read. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if uc == nil || uc.LastMessage == nil {
+		c.Status(http.StatusNoContent) // no hay mensajes que leer
+		return
+	}
+	messageID := uc.LastMessage.MessageID
+	if req.MessageID != "" {
+		parsed, err := gocql.ParseUUID(req.MessageID)
+		if err != nil || parsed.Version() != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid message_id. Must be the ID of a message.",
+				"documentation": "https://docs.osohub.com/messages",
+			})
+			return
+		}
+		// no se puede marcar como leído un mensaje posterior al último
+		if !parsed.Time().After(uc.LastMessage.CreatedAt) {
+			messageID = parsed
+		}
+	}
+	if uc.LastReadID != nil && !uc.LastReadID.Time().Before(messageID.Time()) {
+		c.Status(http.StatusNoContent) // ya estaba leído
+		return
+	}
+	if err := db.MarkConversationRead(*ref, userID, messageID); err != nil {
+		log.Printf("Error marking conversation %v as read: %v", ref.ConversationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not mark conversation as read. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	realtime.PublishMessagesRead(ref.Other(userID), realtime.MessagesRead{
+		ConversationID: ref.ConversationID, UserID: userID, MessageID: messageID,
+	})
+	c.Status(http.StatusNoContent)
+}
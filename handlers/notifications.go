@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/realtime"
+	"osohub/webhooks"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// notify stores a notification for userID. Notifications are best effort:
+// errors are logged and never fail the request that caused them. Users are
+// not notified of their own actions.
+func notify(userID gocql.UUID, n models.Notification) {
+	if n.ActorID != nil && *n.ActorID == userID {
+		return
+	}
+	stored, err := db.InsertNotification(userID, &n)
+	if err != nil {
+		log.Printf("Error notifying %v (%s): %v", userID, n.Type, err)
+		return
+	}
+	if stored && realtime.HasSubscribers(realtime.UserTopic(userID)) {
+		notifications := []models.Notification{n}
+		attachNotificationActors(notifications)
+		realtime.PublishNotification(userID, notifications[0])
+	}
+}
+
+// announceLike tells the owner of an image that someone liked it and sends
+// the image.liked webhook event.
+func announceLike(imageID, likerID gocql.UUID) {
+	ref, err := db.GetImageRef(imageID)
+	if err != nil {
+		log.Printf("Error loading image %v for like notification: %v", imageID, err)
+		return
+	}
+	// un solo aviso por (usuario, imagen) aunque quite y vuelva a dar like
+	first, err := db.FirstLikeNotification(imageID, likerID)
+	if err != nil {
+		log.Printf("Error checking like notification of %v on %v: %v", likerID, imageID, err)
+	}
+	if first {
+		notify(ref.UserID, models.Notification{Type: models.NotificationLike, ActorID: &likerID, ImageID: &imageID})
+	}
+	webhooks.ImageLiked(imageID, ref.UserID, likerID)
+}
+
+// notifyModeration tells a user about a moderation decision.
+func notifyModeration(userID gocql.UUID, message string, imageID, commentID *gocql.UUID) {
+	notify(userID, models.Notification{Type: models.NotificationModeration, Message: message, ImageID: imageID, CommentID: commentID})
+}
+
+// notifyImageModeration tells the owner of an image and the users who
+// reported it about a moderation decision on it.
+func notifyImageModeration(ref db.ImageRef, ownerMessage, reporterMessage string) {
+	notifyModeration(ref.UserID, ownerMessage, &ref.ImageID, nil)
+	reporters, err := db.GetImageReporters(ref.ImageID)
+	if err != nil {
+		log.Printf("Error loading reporters of image %v: %v", ref.ImageID, err)
+	}
+	for _, reporterID := range reporters {
+		if reporterID == systemReporterID || reporterID == ref.UserID {
+			continue // reportes automáticos
+		}
+		notifyModeration(reporterID, reporterMessage, &ref.ImageID, nil)
+	}
+}
+
+// attachNotificationActors fills in the current username and profile
+// picture of each notification's actor.
+func attachNotificationActors(notifications []models.Notification) {
+	type actor struct{ username, picture string }
+	actors := map[gocql.UUID]actor{}
+	for i := range notifications {
+		if notifications[i].ActorID == nil {
+			continue
+		}
+		id := *notifications[i].ActorID
+		a, ok := actors[id]
+		if !ok {
+			if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, id).Scan(&a.username, &a.picture); err != nil {
+				log.Printf("Error loading notification actor %v: %v", id, err)
+			}
+			actors[id] = a
+		}
+		notifications[i].ActorUsername = a.username
+		notifications[i].ActorProfilePictureURL = a.picture
+	}
+}
+
+// currentUserID parses the authenticated user. It writes the error
+// response and reports false if it is missing.
+func currentUserID(c *gin.Context) (gocql.UUID, bool) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return gocql.UUID{}, false
+	}
+	return userID, true
+}
+
+// GetMyNotifications godoc
+// @Summary List the current user's notifications (newest first)
+// @Description Likes, new followers, comments, replies and moderation decisions from the last 90 days. unread_count is capped at 100. Paginate with the next_cursor value of the previous page.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "notifications, unread_count and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications [get]
+func GetMyNotifications(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var cursor *gocql.UUID
+	if raw := c.Query("cursor"); raw != "" {
+		parsed, err := gocql.ParseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid cursor. Use the next_cursor value of the previous page.",
+				"documentation": "https://docs.osohub.com/notifications",
+			})
+			return
+		}
+		cursor = &parsed
+	}
+	limit := queryLimit(c, 20, 100)
+	notifications, err := db.GetNotifications(userID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch notifications. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	unread, err := db.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Printf("Error counting unread notifications of %v: %v", userID, err)
+	}
+	attachNotificationActors(notifications)
+
+	var nextCursor *gocql.UUID
+	if len(notifications) == limit {
+		last := notifications[len(notifications)-1].NotificationID
+		nextCursor = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread_count":  unread,
+		"next_cursor":   nextCursor,
+	})
+}
+
+// GetUnreadNotificationsCount godoc
+// @Summary Get the current user's unread notifications count
+// @Description Capped at 100.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int "unread_count"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications/unread-count [get]
+func GetUnreadNotificationsCount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	unread, err := db.CountUnreadNotifications(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not count notifications. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread_count": unread})
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification as read
+// @Tags Notifications
+// @Security BearerAuth
+// @Param notification_id path string true "Notification ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications/{notification_id}/read [post]
+func MarkNotificationRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	notificationID, err := gocql.ParseUUID(c.Param("notification_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid notification_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/notifications",
+		})
+		return
+	}
+	found, err := db.MarkNotificationRead(userID, notificationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not update notification. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Notification not found.",
+			"documentation": "https://docs.osohub.com/notifications",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// MarkAllNotificationsRead godoc
+// @Summary Mark all of the current user's notifications as read
+// @Tags Notifications
+// @Security BearerAuth
+// @Success 204 "No Content"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications/read-all [post]
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := db.MarkAllNotificationsRead(userID, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not update notifications. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetNotificationPreferences godoc
+// @Summary Get which notification types the current user receives
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]bool "like, follow, comment, reply and moderation"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications/preferences [get]
+func GetNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	prefs, err := db.GetNotificationPrefs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch preferences. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateNotificationPreferences godoc
+// @Summary Turn notification types on or off
+// @Description Send only the types to change, e.g. {"like": false}. Returns all the preferences.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param preferences body map[string]bool true "Types to change"
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/notifications/preferences [patch]
+func UpdateNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req map[string]bool
+	if err := c.ShouldBindJSON(&req); err != nil || len(req) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Send an object of notification types to true or false.",
+			"documentation": "https://docs.osohub.com/notifications#preferences",
+		})
+		return
+	}
+	prefs, err := db.GetNotificationPrefs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch preferences. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	for t := range req {
+		if _, known := prefs[t]; !known {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Unknown notification type: " + t,
+				"documentation": "https://docs.osohub.com/notifications#preferences",
+			})
+			return
+		}
+	}
+	for t, enabled := range req {
+		if err := db.SetNotificationPref(userID, t, enabled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not save preferences. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		prefs[t] = enabled
+	}
+	c.JSON(http.StatusOK, prefs)
+}
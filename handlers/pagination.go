@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryLimit reads the limit query parameter, clamped to [1, max].
+func queryLimit(c *gin.Context, fallback, max int) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		return fallback
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// queryBefore reads the before cursor (RFC 3339) of time-ordered listings.
+// Without it the listing starts now.
+func queryBefore(c *gin.Context) (time.Time, bool) {
+	value := c.Query("before")
+	if value == "" {
+		return time.Now().UTC(), true
+	}
+	before, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return before.UTC(), true
+}
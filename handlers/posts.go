@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"osohub/config"
+	"osohub/db"
+	"osohub/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxPostImages reads MAX_POST_IMAGES, the largest number of images a
+// gallery post may contain (default 10).
+func maxPostImages() int {
+	n, err := strconv.Atoi(config.GetEnv("MAX_POST_IMAGES", "10"))
+	if err != nil || n < 1 {
+		return 10
+	}
+	return n
+}
+
+// attachPostItems loads the gallery items of every post with more than one
+// image. Plain images are left untouched.
+func attachPostItems(images []models.Image) {
+	for i := range images {
+		if images[i].ItemCount <= 1 {
+			continue
+		}
+		items, err := db.GetPostItems(images[i].ImageID)
+		if err != nil {
+			log.Printf("Error loading post items for %v: %v", images[i].ImageID, err)
+			continue
+		}
+		images[i].Items = items
+	}
+}
+
+// CreatePost godoc
+// @Summary Publish a multi-image post (gallery)
+// @Description Uploads up to MAX_POST_IMAGES ordered images as a single post. captions and alt_texts are matched to images by position. The post is returned by the feed, profile and byid endpoints as one item with an `items` array; the first image is the cover.
+// @Tags Images
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param images formData file true "Image files in order (JPG, PNG, GIF, WebP, max 10MB each); repeat the field"
+// @Param title formData string true "Post title (max 100 characters)"
+// @Param description formData string false "Post description (max 2000 characters)"
+// @Param visibility formData string false "public (default), unlisted, followers or private" Enums(public, unlisted, followers, private)
+// @Param publish_at formData string false "Scheduled publish time (RFC 3339)"
+// @Param tags formData []string false "Tags besides the #hashtags of the title (comma-separated or repeated, max 10)" collectionFormat(multi)
+// @Param captions formData []string false "Per-image captions, same order as images" collectionFormat(multi)
+// @Param alt_texts formData []string false "Per-image alt text, same order as images" collectionFormat(multi)
+// @Success 201 {object} models.Image
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /posts [post]
+func CreatePost(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["images"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "No images uploaded. Use the 'images' field in form-data, once per image.",
+			"documentation": "https://docs.osohub.com/posts#create",
+		})
+		return
+	}
+	files := form.File["images"]
+	if max := maxPostImages(); len(files) > max {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         fmt.Sprintf("Too many images. Maximum %d per post.", max),
+			"documentation": "https://docs.osohub.com/posts#create",
+		})
+		return
+	}
+	title := c.PostForm("title")
+	captions := form.Value["captions"]
+	altTexts := form.Value["alt_texts"]
+
+	description := c.PostForm("description")
+	if uerr := validateImageText(description, ""); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+
+	visibility, ok := normalizeVisibility(c.PostForm("visibility"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility. Use public, unlisted, followers or private."})
+		return
+	}
+
+	publishAt, uerr := parsePublishAt(c.PostForm("publish_at"))
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+
+	tags, uerr := parseTagList(c.PostFormArray("tags"))
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+
+	up := imageUpload{Title: title, Description: description, Visibility: visibility, PublishAt: publishAt, Tags: tags}
+	for i, file := range files {
+		if uerr := validateUploadMetadata(file.Filename, file.Size, title); uerr != nil {
+			c.JSON(uerr.Status, uerr.Body)
+			return
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not open uploaded file"})
+			return
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read uploaded file"})
+			return
+		}
+		f := uploadFile{Filename: file.Filename, Data: data}
+		if i < len(captions) {
+			f.Caption = captions[i]
+		}
+		if i < len(altTexts) {
+			f.AltText = altTexts[i]
+		}
+		if uerr := validateImageText(f.Caption, f.AltText); uerr != nil {
+			c.JSON(uerr.Status, uerr.Body)
+			return
+		}
+		up.Files = append(up.Files, f)
+	}
+
+	image, uerr := saveImageUpload(c, userID, up)
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	c.JSON(http.StatusCreated, image)
+}
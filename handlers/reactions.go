@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/config"
+	"osohub/db"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Reaction is one of the reactions users can leave on an image.
+type Reaction struct {
+	Name  string `json:"name"`
+	Emoji string `json:"emoji,omitempty"`
+}
+
+// defaultReactionEmoji son las reacciones por defecto (REACTIONS las sustituye)
+var defaultReactionEmoji = map[string]string{
+	"heart": "❤️",
+	"laugh": "😂",
+	"wow":   "😮",
+	"sad":   "😢",
+	"clap":  "👏",
+	"fire":  "🔥",
+}
+
+// availableReactions reads the REACTIONS list (comma-separated names,
+// optionally name:emoji). "heart" is always available because the like
+// endpoints use it.
+func availableReactions() []Reaction {
+	raw := config.GetEnv("REACTIONS", "heart,laugh,wow,sad,clap,fire")
+	reactions := []Reaction{}
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(raw, ",") {
+		name, emoji, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if emoji == "" {
+			emoji = defaultReactionEmoji[name]
+		}
+		seen[name] = true
+		reactions = append(reactions, Reaction{Name: name, Emoji: emoji})
+	}
+	if !seen[db.ReactionHeart] {
+		reactions = append([]Reaction{{Name: db.ReactionHeart, Emoji: defaultReactionEmoji[db.ReactionHeart]}}, reactions...)
+	}
+	return reactions
+}
+
+func validReaction(name string) bool {
+	for _, r := range availableReactions() {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionRequest is the body for reacting to an image.
+type ReactionRequest struct {
+	Reaction string `json:"reaction" binding:"required"`
+}
+
+// reactionImageAndUser parses the image and the current user of a reaction
+// request and checks that the user can see the image.
+func reactionImageAndUser(c *gin.Context) (gocql.UUID, gocql.UUID, bool) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#reactions",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return gocql.UUID{}, gocql.UUID{}, false
+	}
+	return imageID, userID, true
+}
+
+// reactionError writes the response for a failed reaction change.
+func reactionError(c *gin.Context, err error) {
+	if err == db.ErrReactionConflict {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your reaction changed in the meantime. Please try again."})
+		return
+	}
+	log.Printf("Error updating reaction: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":         "Could not update reaction. Please try again later.",
+		"documentation": "https://docs.osohub.com/errors#internal",
+	})
+}
+
+// GetReactions godoc
+// @Summary List the available reactions
+// @Tags Images
+// @Produce json
+// @Success 200 {array} Reaction
+// @Router /reactions [get]
+func GetReactions(c *gin.Context) {
+	c.JSON(http.StatusOK, availableReactions())
+}
+
+// GetImageReactions godoc
+// @Summary Get the reaction counts of an image and the viewer's own reaction
+// @Description my_reaction is only set when a JWT is sent. Likes are the "heart" reaction.
+// @Tags Images
+// @Produce json
+// @Param image_id path string true "Image ID"
+// @Success 200 {object} map[string]interface{} "reactions (name -> count), total and my_reaction"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/reactions [get]
+func GetImageReactions(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#reactions",
+		})
+		return
+	}
+	if loadViewableImage(c, imageID) == nil {
+		return
+	}
+	counts, err := db.GetReactionCounts(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch reactions. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	var myReaction *string
+	if userID, err := gocql.ParseUUID(c.GetString("user_id")); err == nil {
+		if reaction, err := db.GetUserReaction(imageID, userID); err == nil && reaction != "" {
+			myReaction = &reaction
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"reactions":   counts,
+		"total":       total,
+		"my_reaction": myReaction,
+	})
+}
+
+// ReactToImage godoc
+// @Summary React to an image (one reaction per user, switchable)
+// @Description Sending a different reaction replaces the previous one. "heart" is the same as liking the image.
+// @Tags Images
+// @Accept json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Param reaction body ReactionRequest true "Reaction name (see GET /reactions)"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/reaction [put]
+func ReactToImage(c *gin.Context) {
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validReaction(req.Reaction) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid reaction. Use GET /reactions to get the available reactions.",
+			"documentation": "https://docs.osohub.com/images#reactions",
+		})
+		return
+	}
+	imageID, userID, ok := reactionImageAndUser(c)
+	if !ok {
+		return
+	}
+	changed, err := db.SetReaction(imageID, userID, req.Reaction)
+	if err != nil {
+		reactionError(c, err)
+		return
+	}
+	if changed && req.Reaction == db.ReactionHeart {
+		announceLike(imageID, userID)
+	}
+	if changed {
+		publishLikeCount(imageID) // también cuando se cambia un heart por otra reacción
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveImageReaction godoc
+// @Summary Remove the current user's reaction from an image
+// @Tags Images
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/reaction [delete]
+func RemoveImageReaction(c *gin.Context) {
+	imageID, userID, ok := reactionImageAndUser(c)
+	if !ok {
+		return
+	}
+	if err := db.RemoveReaction(imageID, userID, ""); err != nil {
+		reactionError(c, err)
+		return
+	}
+	publishLikeCount(imageID)
+	c.Status(http.StatusNoContent)
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"osohub/db"
 	"osohub/models"
+	"osohub/webhooks"
 	"strconv"
 	"time"
 
@@ -62,18 +64,7 @@ func ReportImage(c *gin.Context) {
 	}
 
 	// Validar que la categoría sea válida
-	validCategories := map[string]bool{
-		"harassment":     true,
-		"hate":           true,
-		"spam":           true,
-		"inappropriate":  true,
-		"violence":       true,
-		"misinformation": true,
-		"copyright":      true,
-		"other":          true,
-	}
-
-	if !validCategories[req.Category] {
+	if !validReportCategories[req.Category] {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":         "Invalid category. Use /reports/categories to get valid categories.",
 			"documentation": "https://docs.osohub.com/images#report",
@@ -81,35 +72,53 @@ func ReportImage(c *gin.Context) {
 		return
 	}
 
-	timeUUID := gocql.TimeUUID()
-	now := time.Now().UTC()
-
-	// Insertar en reports_by_image (tabla principal)
-	query1 := `INSERT INTO reports_by_image (image_id, report_id, reporter_id, category, reason, reported_at) VALUES (?, ?, ?, ?, ?, ?)`
-	if err := db.GetSession().Query(query1, gocql.UUID(imageUUID), timeUUID, gocql.UUID(userUUID), req.Category, req.Reason, now).Exec(); err != nil {
+	if err := saveImageReport(gocql.UUID(imageUUID), gocql.UUID(userUUID), req.Category, req.Reason); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":         "Could not report image. Please try again later.",
 			"documentation": "https://docs.osohub.com/errors#internal",
 		})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Image reported"})
+}
+
+// validReportCategories son los IDs aceptados por ReportImage (ver GetReportCategories)
+var validReportCategories = map[string]bool{
+	"harassment":     true,
+	"hate":           true,
+	"spam":           true,
+	"inappropriate":  true,
+	"violence":       true,
+	"misinformation": true,
+	"copyright":      true,
+	"other":          true,
+}
+
+// saveImageReport stores a report in reports_by_image and reports_by_category
+// and increments the image report counter.
+func saveImageReport(imageID, reporterID gocql.UUID, category, reason string) error {
+	timeUUID := gocql.TimeUUID()
+	now := time.Now().UTC()
+
+	// Insertar en reports_by_image (tabla principal)
+	query1 := `INSERT INTO reports_by_image (image_id, report_id, reporter_id, category, reason, reported_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if err := db.GetSession().Query(query1, imageID, timeUUID, reporterID, category, reason, now).Exec(); err != nil {
+		return err
+	}
 
 	// Insertar en reports_by_category (para análisis)
 	query2 := `INSERT INTO reports_by_category (category, reported_at, report_id, image_id, reporter_id, reason) VALUES (?, ?, ?, ?, ?, ?)`
-	if err := db.GetSession().Query(query2, req.Category, now, timeUUID, gocql.UUID(imageUUID), gocql.UUID(userUUID), req.Reason).Exec(); err != nil {
-		// No fallar si esto falla, pero log el error
-		// Este insert es para análisis, no crítico
+	if err := db.GetSession().Query(query2, category, now, timeUUID, imageID, reporterID, reason).Exec(); err != nil {
+		// No fallar si esto falla: este insert es para análisis, no crítico
+		log.Printf("Error inserting report into reports_by_category: %v", err)
 	}
 
 	// Incrementar contador
-	if err := db.IncrementImageReportCounter(imageIDStr); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":         "Could not update report counter. Please try again later.",
-			"documentation": "https://docs.osohub.com/errors#internal",
-		})
-		return
+	if err := db.IncrementImageReportCounter(imageID.String()); err != nil {
+		return err
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Image reported"})
+	webhooks.ReportCreated(webhooks.ReportData{ImageID: imageID, ReporterID: reporterID, Category: category, Reason: reason})
+	return nil
 }
 
 // GetImageReportsCount godoc
@@ -236,10 +245,10 @@ func GetReportsByCategory(c *gin.Context) {
 	var args []interface{}
 
 	if category != "" {
-		query = `SELECT category, reported_at, report_id, image_id, reporter_id, reason FROM reports_by_category WHERE category = ? LIMIT ?`
+		query = `SELECT category, reported_at, report_id, image_id, comment_id, reporter_id, reason FROM reports_by_category WHERE category = ? LIMIT ?`
 		args = []interface{}{category, limit}
 	} else {
-		query = `SELECT category, reported_at, report_id, image_id, reporter_id, reason FROM reports_by_category LIMIT ?`
+		query = `SELECT category, reported_at, report_id, image_id, comment_id, reporter_id, reason FROM reports_by_category LIMIT ?`
 		args = []interface{}{limit}
 	}
 
@@ -251,8 +260,9 @@ func GetReportsByCategory(c *gin.Context) {
 		var reportCategory, reason string
 		var reportedAt time.Time
 		var reportID, imageID, reporterID gocql.UUID
+		var commentID *gocql.UUID // solo en reportes de comentarios
 
-		if !iter.Scan(&reportCategory, &reportedAt, &reportID, &imageID, &reporterID, &reason) {
+		if !iter.Scan(&reportCategory, &reportedAt, &reportID, &imageID, &commentID, &reporterID, &reason) {
 			break
 		}
 
@@ -263,6 +273,9 @@ func GetReportsByCategory(c *gin.Context) {
 			"reason":      reason,
 			"reported_at": reportedAt,
 		}
+		if commentID != nil {
+			report["comment_id"] = *commentID
+		}
 
 		reports[reportCategory] = append(reports[reportCategory], report)
 	}
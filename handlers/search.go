@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/search"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+const maxSearchQueryLength = 100
+
+// searchUser is a user in the search results (only public profile fields).
+type searchUser struct {
+	UserID            gocql.UUID `json:"user_id"`
+	Username          string     `json:"username"`
+	ProfilePictureURL string     `json:"profile_picture_url"`
+	Bio               string     `json:"bio"`
+}
+
+// Search godoc
+// @Summary Search images and users
+// @Description Full-text search over image titles, descriptions and tags and over usernames and bios. Tolerates typos and matches word prefixes. Only public images are returned; images and profiles of users blocked by or blocking the viewer are left out. Paginate with the next_offset value of the previous page.
+// @Produce json
+// @Param q query string true "Search terms (max 100 characters)"
+// @Param type query string false "What to search: all (default), images or users" Enums(all, images, users)
+// @Param limit query int false "Page size for each result list (default 20, max 50)"
+// @Param offset query int false "Number of results to skip"
+// @Success 200 {object} map[string]interface{} "images, users, totals and next_offset"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /search [get]
+// @Tags Images
+func Search(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "q is required (max 100 characters).",
+			"documentation": "https://docs.osohub.com/search",
+		})
+		return
+	}
+	kind := c.DefaultQuery("type", "all")
+	if kind != "all" && kind != "images" && kind != "users" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid type. Use all, images or users.",
+			"documentation": "https://docs.osohub.com/search",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 50)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	response := gin.H{"query": q}
+	hasMore := false
+	if kind != "users" {
+		ids, total := search.SearchImages(q, offset, limit)
+		images, err := hydrateImages(c.GetString("user_id"), ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not search. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		response["images"] = images
+		response["total_images"] = total
+		hasMore = hasMore || offset+limit < total
+	}
+	if kind != "images" {
+		ids, total := search.SearchUsers(q, offset, limit)
+		hidden, err := hiddenAuthors(c.GetString("user_id"), false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not search. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		users := make([]searchUser, 0, len(ids))
+		for _, id := range ids {
+			if hidden[id] {
+				continue
+			}
+			u := searchUser{UserID: id}
+			var role string
+			if err := db.GetSession().Query(`SELECT username, profile_picture_url, bio, role FROM users_by_id WHERE user_id = ?`, id).Scan(
+				&u.Username, &u.ProfilePictureURL, &u.Bio, &role); err != nil || role == models.RoleBanned {
+				continue
+			}
+			users = append(users, u)
+		}
+		response["users"] = users
+		response["total_users"] = total
+		hasMore = hasMore || offset+limit < total
+	}
+	if hasMore {
+		response["next_offset"] = offset + limit
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"osohub/config"
+	"osohub/db"
+	"osohub/imaging"
+	"osohub/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// sharePageMaxAge is how long crawlers and proxies may cache a share page.
+const sharePageMaxAge = 5 * time.Minute
+
+// oembedCacheAge is the cache_age suggested to oEmbed consumers, in seconds.
+const oembedCacheAge = 3600
+
+// imageSizeClient fetches images whose dimensions were not recorded at upload.
+var imageSizeClient = &http.Client{Timeout: 5 * time.Second}
+
+// DefaultPublicBaseURL is used when PUBLIC_BASE_URL is not set: the web app
+// in development.
+const DefaultPublicBaseURL = "http://localhost:5173"
+
+// publicBaseURL is the public URL of the site (PUBLIC_BASE_URL), used in
+// shared links, share pages, feeds and oEmbed. The site must route /p/,
+// /u/, /oembed and the Atom feeds to this API and the rest to the web app.
+// It never comes from the request: the Host header is chosen by the client
+// and would end up in cached pages and links.
+func publicBaseURL() string {
+	if base := strings.TrimRight(config.GetEnv("PUBLIC_BASE_URL", ""), "/"); base != "" {
+		return base
+	}
+	return DefaultPublicBaseURL
+}
+
+// sharePostURL is the share page of an image, with its preview tags.
+func sharePostURL(base string, imageID gocql.UUID) string {
+	return base + "/p/" + imageID.String()
+}
+
+// shareProfileURL is the share page of a profile, with its preview tags.
+func shareProfileURL(base, username string) string {
+	return base + "/u/" + url.PathEscape(username)
+}
+
+// profilePageURL is the profile in the web app.
+func profilePageURL(base, username string) string {
+	return base + "/profile/" + url.PathEscape(username)
+}
+
+// oembedURL is the oEmbed endpoint for a share page, for discovery.
+func oembedURL(base, pageURL string) string {
+	return base + "/oembed?" + url.Values{"url": {pageURL}, "format": {"json"}}.Encode()
+}
+
+// shareImage is an image of a share page.
+type shareImage struct {
+	URL    string
+	Alt    string
+	Width  int
+	Height int
+}
+
+// sharePage holds what a share page shows to crawlers (Open Graph and
+// Twitter Card tags) and to people.
+type sharePage struct {
+	Title       string
+	Description string
+	Type        string // og:type
+	Card        string // twitter:card
+	PageURL     string
+	HomeURL     string
+	AppURL      string // si no está vacío, se redirige a las personas aquí
+	Username    string
+	AuthorURL   string
+	OEmbedURL   string
+	Images      []shareImage
+	Message     string // páginas de error
+}
+
+// Cover is the image used by previews that show only one.
+func (p sharePage) Cover() *shareImage {
+	if len(p.Images) == 0 {
+		return nil
+	}
+	return &p.Images[0]
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} · OSOHUB</title>
+{{- if .Message}}
+<meta name="robots" content="noindex">
+{{- else}}
+<meta name="description" content="{{.Description}}">
+<link rel="canonical" href="{{.PageURL}}">
+<meta property="og:site_name" content="OSOHUB">
+<meta property="og:type" content="{{.Type}}">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta property="og:url" content="{{.PageURL}}">
+{{- if eq .Type "profile"}}
+<meta property="profile:username" content="{{.Username}}">
+{{- end}}
+{{- range .Images}}
+<meta property="og:image" content="{{.URL}}">
+{{- if .Width}}
+<meta property="og:image:width" content="{{.Width}}">
+<meta property="og:image:height" content="{{.Height}}">
+{{- end}}
+{{- if .Alt}}
+<meta property="og:image:alt" content="{{.Alt}}">
+{{- end}}
+{{- end}}
+<meta name="twitter:card" content="{{.Card}}">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- with .Cover}}
+<meta name="twitter:image" content="{{.URL}}">
+{{- if .Alt}}
+<meta name="twitter:image:alt" content="{{.Alt}}">
+{{- end}}
+{{- end}}
+{{- with .OEmbedURL}}
+<link rel="alternate" type="application/json+oembed" href="{{.}}" title="{{$.Title}}">
+{{- end}}
+{{- with .AppURL}}
+<meta http-equiv="refresh" content="0; url={{.}}">
+{{- end}}
+{{- end}}
+</head>
+<body>
+{{- if .Message}}
+<p>{{.Message}}</p>
+<p><a href="{{.HomeURL}}">OSOHUB</a></p>
+{{- else}}
+<h1>{{.Title}}</h1>
+{{- range .Images}}
+<p><img src="{{.URL}}" alt="{{.Alt}}"{{if .Width}} width="{{.Width}}" height="{{.Height}}"{{end}}></p>
+{{- end}}
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .AppURL}}
+<p><a href="{{.AppURL}}">Open in OSOHUB</a></p>
+{{- else}}
+<p><a href="{{.AuthorURL}}">@{{.Username}} on OSOHUB</a></p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// renderSharePage writes a share page as HTML.
+func renderSharePage(c *gin.Context, status int, page sharePage) {
+	var buf bytes.Buffer
+	if err := shareTemplate.Execute(&buf, page); err != nil {
+		log.Printf("Error rendering share page: %v", err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if status == http.StatusOK {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(sharePageMaxAge.Seconds())))
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// shareError writes an HTML error page.
+func shareError(c *gin.Context, status int, message string) {
+	renderSharePage(c, status, sharePage{
+		Title:   http.StatusText(status),
+		HomeURL: publicBaseURL(),
+		Message: message,
+	})
+}
+
+// imageTitle is the title shown for an image in previews.
+func imageTitle(img models.Image) string {
+	if img.Title != "" {
+		return img.Title
+	}
+	return "Photo by @" + img.Username
+}
+
+// loadSharedImage loads an image for anonymous viewers (crawlers, oEmbed
+// consumers). found is false if the image does not exist or is in the
+// trash; visible is false if only some users may see it.
+func loadSharedImage(imageID gocql.UUID) (img models.Image, found, visible bool, err error) {
+	loaded, err := db.GetImagesByIDs([]gocql.UUID{imageID})
+	if err != nil || len(loaded) == 0 || loaded[0].DeletedAt != nil {
+		return models.Image{}, false, false, err
+	}
+	return loaded[0], true, canViewImage("", loaded[0]), nil
+}
+
+// loadSharedUser loads a user by username for share pages and oEmbed. It
+// returns nil for unknown and banned users.
+func loadSharedUser(username string) (*models.User, error) {
+	var user models.User
+	err := db.GetSession().Query(`SELECT user_id, username, profile_picture_url, bio, role FROM users_by_id WHERE username = ? ALLOW FILTERING`,
+		username).Scan(&user.UserID, &user.Username, &user.ProfilePictureURL, &user.Bio, &user.Role)
+	if err == gocql.ErrNotFound || (err == nil && user.Role == models.RoleBanned) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// imageSize returns the cover dimensions of an image. Images uploaded
+// before they were recorded are measured from the image itself once.
+func imageSize(img models.Image) (width, height int) {
+	width, height, err := db.GetImageSize(img.ImageID)
+	if err == nil && width > 0 && height > 0 {
+		return width, height
+	}
+	resp, err := imageSizeClient.Get(img.ImageURL)
+	if err != nil {
+		log.Printf("Error fetching image %v to measure it: %v", img.ImageID, err)
+		return 0, 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Error fetching image %v to measure it: status %d", img.ImageID, resp.StatusCode)
+		return 0, 0
+	}
+	// La cabecera de la imagen basta para conocer sus dimensiones
+	width, height, err = imaging.Size(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		log.Printf("Error reading size of image %v: %v", img.ImageID, err)
+		return 0, 0
+	}
+	if err := db.SetImageSize(img.ImageID, width, height); err != nil {
+		log.Printf("Error saving size of image %v: %v", img.ImageID, err)
+	}
+	return width, height
+}
+
+// SharePostPage godoc
+// @Summary Share page of an image
+// @Description HTML page with Open Graph and Twitter Card tags so links shared in chat apps and social networks show a preview. Advertises the oEmbed endpoint. Only images visible without an account are shown.
+// @Tags Sharing
+// @Produce html
+// @Param image_id path string true "Image ID"
+// @Success 200 {string} string "HTML page"
+// @Failure 404 {string} string "HTML page"
+// @Router /p/{image_id} [get]
+func SharePostPage(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		shareError(c, http.StatusNotFound, "This photo does not exist.")
+		return
+	}
+	img, found, visible, err := loadSharedImage(imageID)
+	if err != nil {
+		log.Printf("Error loading shared image %v: %v", imageID, err)
+		shareError(c, http.StatusInternalServerError, "Could not load this photo. Please try again later.")
+		return
+	}
+	if !found || !visible {
+		shareError(c, http.StatusNotFound, "This photo does not exist or is not available.")
+		return
+	}
+
+	base := publicBaseURL()
+	pageURL := sharePostURL(base, img.ImageID)
+	description := img.Description
+	if description == "" {
+		description = "Photo by @" + img.Username + " on OSOHUB"
+	}
+	alt := img.AltText
+	if alt == "" {
+		alt = img.Title
+	}
+	cover := shareImage{URL: img.ImageURL, Alt: alt}
+	if width, height, err := db.GetImageSize(img.ImageID); err == nil {
+		cover.Width, cover.Height = width, height
+	}
+	images := []shareImage{cover}
+	if img.ItemCount > 1 {
+		items, err := db.GetPostItems(img.ImageID)
+		if err != nil {
+			log.Printf("Error loading items of shared post %v: %v", img.ImageID, err)
+		}
+		// el primer elemento es la portada
+		for _, it := range items {
+			if it.Position == 0 {
+				continue
+			}
+			images = append(images, shareImage{URL: it.ImageURL, Alt: it.AltText})
+		}
+	}
+
+	renderSharePage(c, http.StatusOK, sharePage{
+		Title:       imageTitle(img),
+		Description: description,
+		Type:        "article",
+		Card:        "summary_large_image",
+		PageURL:     pageURL,
+		HomeURL:     base,
+		Username:    img.Username,
+		AuthorURL:   profilePageURL(base, img.Username),
+		OEmbedURL:   oembedURL(base, pageURL),
+		Images:      images,
+	})
+}
+
+// ShareProfilePage godoc
+// @Summary Share page of a profile
+// @Description HTML page with Open Graph and Twitter Card tags for a profile. People are redirected to the profile in the web app.
+// @Tags Sharing
+// @Produce html
+// @Param username path string true "Username"
+// @Success 200 {string} string "HTML page"
+// @Failure 404 {string} string "HTML page"
+// @Router /u/{username} [get]
+func ShareProfilePage(c *gin.Context) {
+	user, err := loadSharedUser(c.Param("username"))
+	if err != nil {
+		log.Printf("Error loading shared profile %q: %v", c.Param("username"), err)
+		shareError(c, http.StatusInternalServerError, "Could not load this profile. Please try again later.")
+		return
+	}
+	if user == nil {
+		shareError(c, http.StatusNotFound, "This profile does not exist.")
+		return
+	}
+
+	base := publicBaseURL()
+	pageURL := shareProfileURL(base, user.Username)
+	description := user.Bio
+	if description == "" {
+		description = "Photos by @" + user.Username + " on OSOHUB"
+	}
+	var images []shareImage
+	if user.ProfilePictureURL != "" {
+		images = append(images, shareImage{URL: user.ProfilePictureURL, Alt: "@" + user.Username})
+	}
+	renderSharePage(c, http.StatusOK, sharePage{
+		Title:       "@" + user.Username,
+		Description: description,
+		Type:        "profile",
+		Card:        "summary",
+		PageURL:     pageURL,
+		HomeURL:     base,
+		AppURL:      profilePageURL(base, user.Username),
+		Username:    user.Username,
+		AuthorURL:   profilePageURL(base, user.Username),
+		OEmbedURL:   oembedURL(base, pageURL),
+		Images:      images,
+	})
+}
+
+// oembedResponse is an oEmbed 1.0 response of type "photo" or "link".
+type oembedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Title        string `json:"title,omitempty"`
+	AuthorName   string `json:"author_name,omitempty"`
+	AuthorURL    string `json:"author_url,omitempty"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	CacheAge     int    `json:"cache_age"`
+	URL          string `json:"url,omitempty"` // solo type=photo
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+}
+
+// fitWithin scales width x height down, keeping the aspect ratio, so it
+// is no larger than maxWidth x maxHeight (0 means no limit).
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+// resizedImageURL asks Cloudinary for a copy of the image no larger than
+// width x height. Other URLs are returned unchanged.
+func resizedImageURL(imageURL string, width, height int) string {
+	const marker = "/image/upload/"
+	i := strings.Index(imageURL, marker)
+	if i < 0 {
+		return imageURL
+	}
+	i += len(marker)
+	return fmt.Sprintf("%sc_limit,w_%d,h_%d/%s", imageURL[:i], width, height, imageURL[i:])
+}
+
+// OEmbed godoc
+// @Summary oEmbed for image and profile links
+// @Description Implements oEmbed 1.0 (https://oembed.com) for share page URLs: /p/{image_id} returns a "photo" and /u/{username} a "link". Only the json format is supported. Images that need an account to be seen return 401.
+// @Tags Sharing
+// @Produce json
+// @Param url query string true "URL of a share page"
+// @Param maxwidth query int false "Maximum width of the image"
+// @Param maxheight query int false "Maximum height of the image"
+// @Param format query string false "Response format (only json)"
+// @Success 200 {object} oembedResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 501 {object} map[string]interface{}
+// @Router /oembed [get]
+func OEmbed(c *gin.Context) {
+	if format := c.Query("format"); format != "" && format != "json" {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":         "Only the json format is supported.",
+			"documentation": "https://docs.osohub.com/sharing#oembed",
+		})
+		return
+	}
+	var maxSize [2]int
+	for i, param := range []string{"maxwidth", "maxheight"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         fmt.Sprintf("Invalid %s. Must be a positive integer.", param),
+				"documentation": "https://docs.osohub.com/sharing#oembed",
+			})
+			return
+		}
+		maxSize[i] = n
+	}
+
+	base := publicBaseURL()
+	target, err := url.Parse(c.Query("url"))
+	baseURL, _ := url.Parse(base)
+	if err != nil || baseURL == nil || target.Host != baseURL.Host {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "url is not an OSOHUB share link.",
+			"documentation": "https://docs.osohub.com/sharing#oembed",
+		})
+		return
+	}
+	resp := oembedResponse{
+		Version:      "1.0",
+		ProviderName: "OSOHUB",
+		ProviderURL:  base,
+		CacheAge:     oembedCacheAge,
+	}
+	sharePath := strings.TrimPrefix(target.Path, baseURL.Path)
+	switch {
+	case strings.HasPrefix(sharePath, "/p/"):
+		imageID, err := gocql.ParseUUID(strings.TrimPrefix(sharePath, "/p/"))
+		if err != nil {
+			break
+		}
+		img, found, visible, err := loadSharedImage(imageID)
+		if err != nil {
+			log.Printf("Error loading oEmbed image %v: %v", imageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not fetch image. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		if !found {
+			break
+		}
+		if !visible {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":         "This image is not public.",
+				"documentation": "https://docs.osohub.com/sharing#oembed",
+			})
+			return
+		}
+		resp.Title = imageTitle(img)
+		resp.AuthorName = img.Username
+		resp.AuthorURL = profilePageURL(base, img.Username)
+		resp.Type = "link"
+		// type=photo exige width y height
+		if width, height := imageSize(img); width > 0 && height > 0 {
+			resp.Type = "photo"
+			resp.URL = img.ImageURL
+			resp.Width, resp.Height = fitWithin(width, height, maxSize[0], maxSize[1])
+			if resp.Width != width {
+				resp.URL = resizedImageURL(img.ImageURL, resp.Width, resp.Height)
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	case strings.HasPrefix(sharePath, "/u/"):
+		user, err := loadSharedUser(strings.TrimPrefix(sharePath, "/u/"))
+		if err != nil {
+			log.Printf("Error loading oEmbed profile %q: %v", sharePath, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not fetch user. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		if user == nil {
+			break
+		}
+		resp.Type = "link"
+		resp.Title = "@" + user.Username
+		resp.AuthorName = user.Username
+		resp.AuthorURL = profilePageURL(base, user.Username)
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":         "Nothing found at url.",
+		"documentation": "https://docs.osohub.com/sharing#oembed",
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"osohub/config"
+	"osohub/db"
+	"osohub/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxStatsHours is the longest range of GET /images/:image_id/stats (90 days).
+const maxStatsHours = 90 * 24
+
+// viewWriters bounds how many views are being recorded at the same time;
+// views arriving while it is full are not counted.
+var viewWriters = make(chan struct{}, 64)
+
+// viewDedupWindow is how long repeated views by the same viewer count once.
+func viewDedupWindow() time.Duration {
+	d, err := time.ParseDuration(config.GetEnv("VIEW_DEDUP_WINDOW", "30m"))
+	if err != nil || d < time.Second {
+		return 30 * time.Minute
+	}
+	return d
+}
+
+// viewerKey identifies who is viewing: the user if authenticated, otherwise
+// a hash of the client IP and user agent (the IP itself is not stored).
+func viewerKey(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return "u:" + userID
+	}
+	sum := sha256.Sum256([]byte(c.ClientIP() + "|" + c.Request.UserAgent()))
+	return "a:" + hex.EncodeToString(sum[:16])
+}
+
+// recordView counts a view of img in the background. The owner's own views
+// are not counted.
+func recordView(c *gin.Context, img models.Image) {
+	if c.GetString("user_id") == img.UserID.String() {
+		return
+	}
+	select {
+	case viewWriters <- struct{}{}:
+	default:
+		return // demasiadas vistas pendientes: se descarta antes que acumular goroutines
+	}
+	key := viewerKey(c)
+	go func() {
+		defer func() { <-viewWriters }()
+		if _, err := db.RecordView(img.ImageID, key, viewDedupWindow(), time.Now()); err != nil {
+			log.Printf("Error recording view of %v: %v", img.ImageID, err)
+		}
+	}()
+}
+
+// GetImageStats godoc
+// @Summary Get the views, likes and reports of an image over time (owner only)
+// @Description totals are lifetime counters. series has one entry per hour of the range, oldest first; likes there are net (likes minus removed likes) and comments are counted in the hour they were written, minus deleted ones. Views by the same viewer within VIEW_DEDUP_WINDOW (30 minutes by default) count once, and the owner's own views are not counted.
+// @Tags Images
+// @Produce json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Param hours query int false "Range in hours up to now (default 168, max 2160)"
+// @Success 200 {object} map[string]interface{} "image_id, totals, from, to and series"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/stats [get]
+func GetImageStats(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#stats",
+		})
+		return
+	}
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "168"))
+	if err != nil || hours < 1 || hours > maxStatsHours {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid hours. Use a number between 1 and 2160.",
+			"documentation": "https://docs.osohub.com/images#stats",
+		})
+		return
+	}
+	ref, err := db.GetImageRef(imageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found.",
+			"documentation": "https://docs.osohub.com/images#stats",
+		})
+		return
+	}
+	if ref.UserID.String() != c.GetString("user_id") && c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this image"})
+		return
+	}
+
+	views, likes, reports, comments, err := db.GetImageTotals(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch stats. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	to := time.Now().UTC().Truncate(time.Hour)
+	from := to.Add(-time.Duration(hours-1) * time.Hour)
+	active, err := db.GetHourlyStats(imageID, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch stats. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	// serie completa, con ceros en las horas sin actividad
+	byHour := make(map[time.Time]db.HourlyStats, len(active))
+	for _, s := range active {
+		byHour[s.Hour.UTC()] = s
+	}
+	series := make([]db.HourlyStats, 0, hours)
+	for h := from; !h.After(to); h = h.Add(time.Hour) {
+		s, ok := byHour[h]
+		if !ok {
+			s = db.HourlyStats{Hour: h}
+		}
+		series = append(series, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"image_id": imageID,
+		"totals": gin.H{
+			"views":    views,
+			"likes":    likes,
+			"reports":  reports,
+			"comments": comments,
+		},
+		"from":   from,
+		"to":     to,
+		"series": series,
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/realtime"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// streamHeartbeat is how often an idle stream gets a comment line, so
+// proxies do not close it and dead clients are noticed.
+const streamHeartbeat = 25 * time.Second
+
+// maxStreamImages caps how many images one stream can watch.
+const maxStreamImages = 100
+
+// streamHiddenRefresh is how often a stream reloads the users blocked or
+// muted by its user, whose new images it leaves out.
+const streamHiddenRefresh = time.Minute
+
+// publishLikeCount pushes the current like count of an image to the
+// clients watching it.
+func publishLikeCount(imageID gocql.UUID) {
+	if !realtime.HasSubscribers(realtime.ImageTopic(imageID)) {
+		return
+	}
+	var likes int64
+	if err := db.GetSession().Query(`SELECT likes FROM image_counters WHERE image_id = ?`, imageID).Scan(&likes); err != nil && err != gocql.ErrNotFound {
+		log.Printf("Error loading like count of %v: %v", imageID, err)
+		return
+	}
+	realtime.PublishLikeCount(imageID, likes)
+}
+
+// writeEvent writes one SSE event and flushes it.
+func writeEvent(c *gin.Context, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// CreateStreamTicket godoc
+// @Summary Get a ticket to open the event stream
+// @Description Returns a single-use ticket, valid for 60 seconds, to open /stream?ticket=... from clients that cannot send the Authorization header (EventSource). Unlike the JWT, it is harmless if the URL ends up in logs.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} map[string]interface{} "ticket and expires_in (seconds)"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /stream/ticket [post]
+func CreateStreamTicket(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ticket, err := db.CreateStreamTicket(userID.String(), c.GetString("role"))
+	if err != nil {
+		log.Printf("Error creating stream ticket for %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not create stream ticket. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(db.StreamTicketTTL.Seconds()),
+	})
+}
+
+// Stream godoc
+// @Summary Stream real-time updates (Server-Sent Events)
+// @Description Pushes "image" events for new images in the global feed (except those of blocked and muted users), "notification" events, "message" events for new direct messages and "read" events for read receipts of the current user, and "likes" events with the like count of the watched images. Browsers using EventSource, which cannot send headers, pass a ticket from POST /stream/ticket instead of the Authorization header. A client that falls too far behind gets a "reconnect" event and is disconnected; it should reconnect and refetch. Idle streams get a comment line every 25 seconds.
+// @Tags Notifications
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param images query string false "Comma-separated image IDs to watch for like counts (max 100). Images the user cannot see are ignored"
+// @Param ticket query string false "Single-use ticket from POST /stream/ticket, for clients that cannot send headers"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /stream [get]
+func Stream(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	topics := []string{realtime.TopicFeed, realtime.UserTopic(userID)}
+	if raw := c.Query("images"); raw != "" {
+		ids := strings.Split(raw, ",")
+		if len(ids) > maxStreamImages {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         fmt.Sprintf("Too many images. Watch at most %d.", maxStreamImages),
+				"documentation": "https://docs.osohub.com/stream",
+			})
+			return
+		}
+		imageIDs := make([]gocql.UUID, 0, len(ids))
+		for _, raw := range ids {
+			imageID, err := gocql.ParseUUID(strings.TrimSpace(raw))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":         "Invalid image ID in images: " + raw,
+					"documentation": "https://docs.osohub.com/stream",
+				})
+				return
+			}
+			imageIDs = append(imageIDs, imageID)
+		}
+		images, err := db.GetImagesByIDs(imageIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not open stream. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		// solo las imágenes que el usuario puede ver; las demás se ignoran
+		access := newViewerAccess(userID.String())
+		for _, img := range images {
+			if access.canView(img) {
+				topics = append(topics, realtime.ImageTopic(img.ImageID))
+			}
+		}
+	}
+
+	hidden, err := hiddenAuthors(userID.String(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not open stream. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	sub := realtime.Subscribe(topics...)
+	defer realtime.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx: no acumular el stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	refresh := time.NewTicker(streamHiddenRefresh)
+	defer refresh.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Dropped():
+			// el cliente iba demasiado atrasado: que reconecte y recargue
+			writeEvent(c, "reconnect", gin.H{"reason": "too many pending events"})
+			return
+		case ev := <-sub.Events():
+			// sin imágenes nuevas de usuarios bloqueados o silenciados; si la
+			// lista no se pudo recargar, ninguna hasta que se pueda
+			if item, ok := ev.Data.(realtime.FeedItem); ok && (hidden == nil || hidden[item.UserID]) {
+				continue
+			}
+			if err := writeEvent(c, ev.Type, ev.Data); err != nil {
+				return
+			}
+		case <-refresh.C:
+			if hidden, err = hiddenAuthors(userID.String(), true); err != nil {
+				hidden = nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
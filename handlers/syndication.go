@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// syndicationSize is how many images a feed holds.
+const syndicationSize = 20
+
+// syndicationMaxAge is how long readers and proxies may cache a feed.
+const syndicationMaxAge = 5 * time.Minute
+
+// requestURL is the public URL of the current request, for a feed's self
+// link.
+func requestURL(c *gin.Context) string {
+	return publicBaseURL() + c.Request.URL.Path
+}
+
+// imageMimeType guesses the MIME type of an image from its URL.
+func imageMimeType(imageURL string) string {
+	switch strings.ToLower(path.Ext(strings.SplitN(imageURL, "?", 2)[0])) {
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".avif":
+		return "image/avif"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// syndicationItem is an image of a feed.
+type syndicationItem struct {
+	ImageID    gocql.UUID
+	Username   string
+	ImageURL   string
+	Title      string
+	Summary    string
+	AltText    string
+	UploadedAt time.Time
+	EditedAt   *time.Time
+}
+
+func (it syndicationItem) updated() time.Time {
+	if it.EditedAt != nil && it.EditedAt.After(it.UploadedAt) {
+		return *it.EditedAt
+	}
+	return it.UploadedAt
+}
+
+// syndicationFeed is a feed independent of its format.
+type syndicationFeed struct {
+	Title    string
+	HomeURL  string
+	SelfURL  string
+	SiteURL  string // base de los enlaces a /p/:image_id
+	Author   string
+	IconURL  string
+	Updated  time.Time
+	Items    []syndicationItem
+	Fallback time.Time // updated de un feed sin imágenes
+}
+
+// Atom (RFC 4287)
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Summary   *atomText   `xml:"summary,omitempty"`
+	Content   *atomText   `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Icon    string      `xml:"icon,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// JSON Feed 1.1
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+// itemHTML is the HTML body of an entry: the image and its description.
+func itemHTML(it syndicationItem) string {
+	alt := it.AltText
+	if alt == "" {
+		alt = it.Title
+	}
+	html := fmt.Sprintf(`<p><img src="%s" alt="%s"></p>`, escapeHTML(it.ImageURL), escapeHTML(alt))
+	if it.Summary != "" {
+		html += "<p>" + escapeHTML(it.Summary) + "</p>"
+	}
+	return html
+}
+
+func escapeHTML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (f syndicationFeed) updated() time.Time {
+	updated := f.Fallback
+	for _, it := range f.Items {
+		if it.updated().After(updated) {
+			updated = it.updated()
+		}
+	}
+	return updated.UTC()
+}
+
+func (f syndicationFeed) atom() atomFeed {
+	feed := atomFeed{
+		ID:      f.SelfURL,
+		Title:   f.Title,
+		Updated: f.updated().Format(time.RFC3339),
+		Icon:    f.IconURL,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.SelfURL},
+			{Rel: "alternate", Type: "text/html", Href: f.HomeURL},
+		},
+		Entries: []atomEntry{},
+	}
+	if f.Author != "" {
+		feed.Author = &atomPerson{Name: f.Author, URI: f.HomeURL}
+	}
+	for _, it := range f.Items {
+		entry := atomEntry{
+			ID:        "urn:uuid:" + it.ImageID.String(),
+			Title:     it.Title,
+			Updated:   it.updated().UTC().Format(time.RFC3339),
+			Published: it.UploadedAt.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Type: "text/html", Href: sharePostURL(f.SiteURL, it.ImageID)},
+				{Rel: "enclosure", Type: imageMimeType(it.ImageURL), Href: it.ImageURL},
+			},
+			Content: &atomText{Type: "html", Body: itemHTML(it)},
+		}
+		if it.Summary != "" {
+			entry.Summary = &atomText{Type: "text", Body: it.Summary}
+		}
+		if f.Author == "" {
+			entry.Author = &atomPerson{Name: it.Username}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func (f syndicationFeed) json() jsonFeed {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.SelfURL,
+		Icon:        f.IconURL,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: f.Author, URL: f.HomeURL}}
+	}
+	for _, it := range f.Items {
+		item := jsonFeedItem{
+			ID:            it.ImageID.String(),
+			URL:           sharePostURL(f.SiteURL, it.ImageID),
+			Title:         it.Title,
+			ContentHTML:   itemHTML(it),
+			Summary:       it.Summary,
+			Image:         it.ImageURL,
+			DatePublished: it.UploadedAt.UTC().Format(time.RFC3339),
+			DateModified:  it.updated().UTC().Format(time.RFC3339),
+			Attachments:   []jsonFeedAttachment{{URL: it.ImageURL, MimeType: imageMimeType(it.ImageURL)}},
+		}
+		if f.Author == "" {
+			item.Authors = []jsonFeedAuthor{{Name: it.Username}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// writeSyndication writes a feed as Atom or JSON Feed with caching headers,
+// answering 304 when the reader already has the current version.
+func writeSyndication(c *gin.Context, f syndicationFeed, format string) {
+	var body []byte
+	var contentType string
+	var err error
+	if format == "json" {
+		contentType = "application/feed+json; charset=utf-8"
+		body, err = json.Marshal(f.json())
+	} else {
+		contentType = "application/atom+xml; charset=utf-8"
+		body, err = xml.Marshal(f.atom())
+		body = append([]byte(xml.Header), body...)
+	}
+	if err != nil {
+		log.Printf("Error encoding %s feed: %v", format, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not build feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	updated := f.updated()
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(syndicationMaxAge.Seconds())))
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", updated.Format(http.TimeFormat))
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if match == etag || match == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !updated.Truncate(time.Second).After(since) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// profileFeed writes the feed of a user's latest public images.
+func profileFeed(c *gin.Context, format string) {
+	username := c.Param("username")
+	var user models.User
+	query := `SELECT user_id, username, profile_picture_url, role, created_at FROM users_by_id WHERE username = ? ALLOW FILTERING`
+	if err := db.GetSession().Query(query, username).Scan(&user.UserID, &user.Username, &user.ProfilePictureURL, &user.Role, &user.CreatedAt); err != nil || user.Role == models.RoleBanned {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "User not found",
+			"documentation": "https://docs.osohub.com/profile#feeds",
+		})
+		return
+	}
+
+	items := []syndicationItem{}
+	iter := db.GetSession().Query(`
+		SELECT image_id, uploaded_at, image_url, title, description, alt_text, edited_at, visibility, deleted_at FROM images_by_user WHERE user_id = ? AND uploaded_at <= ?`,
+		user.UserID, time.Now().UTC()).Iter()
+	var img models.Image
+	for len(items) < syndicationSize && iter.Scan(&img.ImageID, &img.UploadedAt, &img.ImageURL, &img.Title, &img.Description, &img.AltText, &img.EditedAt, &img.Visibility, &img.DeletedAt) {
+		img.UserID = user.UserID
+		// los lectores de feeds son anónimos: solo imágenes públicas
+		if !listedForViewer("", img) {
+			img = models.Image{}
+			continue
+		}
+		items = append(items, syndicationItem{
+			ImageID: img.ImageID, Username: user.Username, ImageURL: img.ImageURL, Title: img.Title,
+			Summary: img.Description, AltText: img.AltText, UploadedAt: img.UploadedAt, EditedAt: img.EditedAt,
+		})
+		img = models.Image{}
+	}
+	if err := iter.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not build feed. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	writeSyndication(c, syndicationFeed{
+		Title:    user.Username + " on OSOHUB",
+		HomeURL:  profilePageURL(publicBaseURL(), user.Username),
+		SelfURL:  requestURL(c),
+		SiteURL:  publicBaseURL(),
+		Author:   user.Username,
+		IconURL:  user.ProfilePictureURL,
+		Items:    items,
+		Fallback: user.CreatedAt,
+	}, format)
+}
+
+// GetProfileAtomFeed godoc
+// @Summary Atom feed of a user's latest public images
+// @Description The 20 latest public images, with the image as enclosure. Supports conditional requests (ETag / Last-Modified).
+// @Tags Feeds
+// @Produce application/atom+xml
+// @Param username path string true "Username"
+// @Success 200 {string} string "Atom feed"
+// @Success 304 "Not Modified"
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/{username}/feed.atom [get]
+func GetProfileAtomFeed(c *gin.Context) {
+	profileFeed(c, "atom")
+}
+
+// GetProfileJSONFeed godoc
+// @Summary JSON Feed of a user's latest public images
+// @Description JSON Feed 1.1 with the 20 latest public images as attachments. Supports conditional requests (ETag / Last-Modified).
+// @Tags Feeds
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {string} string "JSON Feed"
+// @Success 304 "Not Modified"
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/{username}/feed.json [get]
+func GetProfileJSONFeed(c *gin.Context) {
+	profileFeed(c, "json")
+}
+
+// GetGlobalAtomFeed godoc
+// @Summary Atom feed of the latest images of the global feed
+// @Description The 20 latest public images from the last week. Supports conditional requests (ETag / Last-Modified).
+// @Tags Feeds
+// @Produce application/atom+xml
+// @Success 200 {string} string "Atom feed"
+// @Success 304 "Not Modified"
+// @Failure 500 {object} map[string]interface{}
+// @Router /feed.atom [get]
+func GetGlobalAtomFeed(c *gin.Context) {
+	now := time.Now().UTC()
+	items := []syndicationItem{}
+	// images_by_date va por días: se recorre hacia atrás hasta llenar el feed
+	for day := 0; day < 7 && len(items) < syndicationSize; day++ {
+		iter := db.GetSession().Query(`
+			SELECT image_id, username, image_url, title, description, alt_text, edited_at, uploaded_at FROM images_by_date WHERE day_bucket = ? LIMIT ?`,
+			now.AddDate(0, 0, -day).Format("2006-01-02"), syndicationSize-len(items)).Iter()
+		var it syndicationItem
+		for iter.Scan(&it.ImageID, &it.Username, &it.ImageURL, &it.Title, &it.Summary, &it.AltText, &it.EditedAt, &it.UploadedAt) {
+			items = append(items, it)
+			it = syndicationItem{}
+		}
+		if err := iter.Close(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not build feed. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+	}
+
+	writeSyndication(c, syndicationFeed{
+		Title:    "OSOHUB",
+		HomeURL:  publicBaseURL(),
+		SelfURL:  requestURL(c),
+		SiteURL:  publicBaseURL(),
+		Items:    items,
+		Fallback: now.Truncate(24 * time.Hour),
+	}, "atom")
+}
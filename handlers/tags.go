@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"osohub/db"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+const (
+	maxTagsPerImage = 10
+	maxTagLength    = 50
+)
+
+var (
+	hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+	tagPattern     = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+)
+
+// normalizeTag lowercases a tag and strips its leading '#'. Tags are made
+// of letters, digits and underscores.
+func normalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" || len([]rune(tag)) > maxTagLength || !tagPattern.MatchString(tag) {
+		return "", false
+	}
+	return tag, true
+}
+
+// parseTagList validates the explicit tags sent on upload or edit. Each
+// value may hold several comma-separated tags.
+func parseTagList(values []string) ([]string, *uploadError) {
+	var tags []string
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+			tag, ok := normalizeTag(raw)
+			if !ok {
+				return nil, newUploadError(http.StatusBadRequest, "Invalid tag \""+strings.TrimSpace(raw)+"\". Tags may contain letters, digits and underscores (max 50 characters).")
+			}
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTagsPerImage {
+		return nil, newUploadError(http.StatusBadRequest, "Too many tags. Maximum "+strconv.Itoa(maxTagsPerImage)+".")
+	}
+	return tags, nil
+}
+
+// imageTags merges the #hashtags of a title with the explicit tags, without
+// duplicates and up to maxTagsPerImage.
+func imageTags(title string, explicit []string) []string {
+	candidates := explicit
+	for _, m := range hashtagPattern.FindAllStringSubmatch(title, -1) {
+		candidates = append(candidates, m[1])
+	}
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, candidate := range candidates {
+		tag, ok := normalizeTag(candidate)
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerImage {
+			break
+		}
+	}
+	return tags
+}
+
+// GetImagesByTag godoc
+// @Summary Get the public images with a tag (newest first)
+// @Description Paginate with the next_before value of the previous page.
+// @Produce json
+// @Param tag path string true "Tag, with or without the leading #"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query string false "Cursor: only images uploaded before this time (RFC 3339)"
+// @Success 200 {object} map[string]interface{} "tag, images and next_before"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tags/{tag}/images [get]
+// @Tags Images
+func GetImagesByTag(c *gin.Context) {
+	tag, ok := normalizeTag(c.Param("tag"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid tag. Tags may contain letters, digits and underscores.",
+			"documentation": "https://docs.osohub.com/tags#images",
+		})
+		return
+	}
+	before, ok := queryBefore(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid before. Use the next_before value of the previous page (RFC 3339).",
+			"documentation": "https://docs.osohub.com/tags#images",
+		})
+		return
+	}
+	limit := queryLimit(c, 20, 100)
+
+	tagged, err := db.GetImagesByTag(tag, before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch tag images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	ids := make([]gocql.UUID, len(tagged))
+	for i, t := range tagged {
+		ids[i] = t.ImageID
+	}
+	images, err := hydrateImages(c.GetString("user_id"), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch tag images. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	var nextBefore *time.Time
+	if len(tagged) == limit {
+		last := tagged[len(tagged)-1].UploadedAt
+		nextBefore = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tag":         tag,
+		"images":      images,
+		"next_before": nextBefore,
+	})
+}
+
+// GetTrendingTags godoc
+// @Summary Get the most used tags of the last hours
+// @Produce json
+// @Param hours query int false "Window in hours (default 24, max 168)"
+// @Param limit query int false "Number of tags (default 10, max 50)"
+// @Success 200 {array} db.TagCount
+// @Failure 500 {object} map[string]interface{}
+// @Router /tags/trending [get]
+// @Tags Images
+func GetTrendingTags(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours < 1 {
+		hours = 24
+	}
+	if hours > 168 {
+		hours = 168
+	}
+	trending, err := db.GetTrendingTags(hours, queryLimit(c, 10, 50))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch trending tags. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, trending)
+}
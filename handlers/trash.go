@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/search"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// GetMyTrash godoc
+// @Summary List the images in the current user's trash
+// @Description Deleted images stay here until they are purged after TRASH_RETENTION_DAYS (longer if they were reported).
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} db.TrashedImage
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/me/trash [get]
+// @Tags Images
+func GetMyTrash(c *gin.Context) {
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":         "Unauthorized. Valid JWT token required.",
+			"documentation": "https://docs.osohub.com/auth#jwt",
+		})
+		return
+	}
+	trash, err := db.GetTrash(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch trash. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreImage godoc
+// @Summary Restore an image from the trash (owner or admin)
+// @Description The image goes back to the profile and, if public, to the feed, with its likes and reports. Images removed by a moderator can only be restored by an admin.
+// @Produce json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id}/restore [post]
+// @Tags Images
+func RestoreImage(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#restore",
+		})
+		return
+	}
+	ref, err := db.GetImageRef(imageID)
+	if err != nil || ref.DeletedAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found in trash.",
+			"documentation": "https://docs.osohub.com/images#restore",
+		})
+		return
+	}
+	isAdmin := c.GetString("role") == models.RoleAdmin
+	if ref.UserID.String() != c.GetString("user_id") && !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this image"})
+		return
+	}
+	removed, err := db.IsRemovedByModerator(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not restore image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if removed && !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "This image was removed by a moderator and cannot be restored.",
+			"documentation": "https://docs.osohub.com/moderation",
+		})
+		return
+	}
+	loaded, err := db.GetImagesByIDs([]gocql.UUID{imageID})
+	if err != nil || len(loaded) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not restore image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if err := db.RestoreImage(*ref); err != nil {
+		log.Printf("Error restoring image %v: %v", imageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not restore image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if removed {
+		if err := db.SetRemovedByModerator(imageID, false); err != nil {
+			log.Printf("Error clearing moderator removal of image %v: %v", imageID, err)
+		}
+		notifyModeration(ref.UserID, "Your image was reinstated by a moderator.", &imageID, nil)
+	}
+	restored := loaded[0]
+	restored.DeletedAt = nil
+	search.SyncImage(restored)
+	c.JSON(http.StatusOK, gin.H{"message": "Image restored", "image_id": imageID})
+}
@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"osohub/config"
+	"osohub/db"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Resumable uploads implement the core tus 1.0.0 protocol
+// (https://tus.io/protocols/resumable-upload) with the creation,
+// termination and expiration extensions. Chunks are appended to a file in
+// TUS_UPLOAD_DIR and, once complete, go through the same pipeline as
+// UploadImage. With several API replicas, TUS_UPLOAD_DIR must be a shared
+// volume or uploads must be routed with sticky sessions.
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,termination,expiration"
+)
+
+// uploadLocks serializes PATCH requests for the same upload on this replica.
+var uploadLocks sync.Map
+
+// tusUpload is the state of a resumable upload stored in uploads_by_id.
+type tusUpload struct {
+	UploadID    gocql.UUID
+	UserID      gocql.UUID
+	Length      int64
+	Filename    string
+	Title       string
+	Description string
+	AltText     string
+	Visibility  string
+	PublishAt   *time.Time
+	Tags        []string
+	CreatedAt   time.Time
+	ImageID     *gocql.UUID
+	LastError   string // por qué falló el último intento de publicarla
+}
+
+func tusUploadDir() string {
+	return config.GetEnv("TUS_UPLOAD_DIR", filepath.Join(os.TempDir(), "osohub-uploads"))
+}
+
+// tusUploadExpiry reads TUS_UPLOAD_EXPIRY, how long an unfinished upload is
+// kept (Go duration, default 24h).
+func tusUploadExpiry() time.Duration {
+	expiry, err := time.ParseDuration(config.GetEnv("TUS_UPLOAD_EXPIRY", "24h"))
+	if err != nil || expiry <= 0 {
+		return 24 * time.Hour
+	}
+	return expiry
+}
+
+// uploadTTL returns the remaining lifetime of an upload row, so every
+// write to it keeps the expiry set when it was created.
+func uploadTTL(up *tusUpload) int {
+	return max(1, int(time.Until(up.CreatedAt.Add(tusUploadExpiry())).Seconds()))
+}
+
+func tusUploadPath(uploadID gocql.UUID) string {
+	return filepath.Join(tusUploadDir(), uploadID.String())
+}
+
+// TusHeaders sets the headers every tus response must carry.
+func TusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+}
+
+// TusOptionsHeaders sets the headers a tus server returns on OPTIONS
+// requests so clients can discover its capabilities.
+func TusOptionsHeaders(c *gin.Context) {
+	TusHeaders(c)
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", TusExtensions)
+	c.Header("Tus-Max-Size", strconv.Itoa(maxImageSize))
+}
+
+// checkTusResumable rejects requests made with another tus version, as the
+// protocol requires for every request but OPTIONS.
+func checkTusResumable(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported tus version"})
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated
+// "key base64(value)" pairs.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// loadTusUpload fetches an upload and checks it belongs to the authenticated
+// user, writing the error response if it does not.
+func loadTusUpload(c *gin.Context) (*tusUpload, bool) {
+	TusHeaders(c)
+	if !checkTusResumable(c) {
+		return nil, false
+	}
+	uploadID, err := gocql.ParseUUID(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	var up tusUpload
+	err = db.GetSession().Query(`SELECT upload_id, user_id, upload_length, filename, title, description, alt_text, visibility, publish_at, tags, created_at, image_id, last_error FROM uploads_by_id WHERE upload_id = ?`, uploadID).Scan(
+		&up.UploadID, &up.UserID, &up.Length, &up.Filename, &up.Title, &up.Description, &up.AltText, &up.Visibility, &up.PublishAt, &up.Tags, &up.CreatedAt, &up.ImageID, &up.LastError)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	if up.UserID.String() != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this upload"})
+		return nil, false
+	}
+	return &up, true
+}
+
+// uploadOffset returns how many bytes of an upload have been received.
+func uploadOffset(uploadID gocql.UUID) (int64, error) {
+	info, err := os.Stat(tusUploadPath(uploadID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func setUploadExpires(c *gin.Context, up *tusUpload) {
+	c.Header("Upload-Expires", up.CreatedAt.Add(tusUploadExpiry()).UTC().Format(http.TimeFormat))
+}
+
+// CreateUpload godoc
+// @Summary Create a resumable image upload (tus)
+// @Description Starts a tus 1.0.0 upload. Upload-Metadata must include base64 encoded `filename` and `title`, and may include `description`, `alt_text`, `visibility`, `publish_at` (RFC 3339; if it has passed when the upload completes, the image is published right away) and `tags` (comma-separated). Chunks are then sent with PATCH to the returned Location.
+// @Tags Images
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param Upload-Length header int true "Total file size in bytes (max 10MB)"
+// @Param Upload-Metadata header string true "filename <base64>,title <base64>"
+// @Success 201 "Created, see Location header"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Router /uploads [post]
+func CreateUpload(c *gin.Context) {
+	TusHeaders(c)
+	if !checkTusResumable(c) {
+		return
+	}
+	userID, err := gocql.ParseUUID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id in token"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length header is required"})
+		return
+	}
+	if length > maxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large. Maximum size: 10MB"})
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata header"})
+		return
+	}
+	if uerr := validateUploadMetadata(metadata["filename"], length, metadata["title"]); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	if uerr := validateImageText(metadata["description"], metadata["alt_text"]); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	visibility, ok := normalizeVisibility(metadata["visibility"])
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility. Use public, unlisted, followers or private."})
+		return
+	}
+	publishAt, uerr := parsePublishAt(metadata["publish_at"])
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	tags, uerr := parseTagList([]string{metadata["tags"]})
+	if uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+
+	if err := os.MkdirAll(tusUploadDir(), 0o700); err != nil {
+		log.Printf("Error creating upload dir: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create upload"})
+		return
+	}
+	up := tusUpload{
+		UploadID:    gocql.TimeUUID(),
+		UserID:      userID,
+		Length:      length,
+		Filename:    metadata["filename"],
+		Title:       metadata["title"],
+		Description: metadata["description"],
+		AltText:     metadata["alt_text"],
+		Visibility:  visibility,
+		PublishAt:   publishAt,
+		Tags:        tags,
+		CreatedAt:   time.Now().UTC(),
+	}
+	f, err := os.OpenFile(tusUploadPath(up.UploadID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Error creating upload file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create upload"})
+		return
+	}
+	f.Close()
+
+	// La fila expira sola junto con la subida abandonada
+	ttl := int(tusUploadExpiry().Seconds())
+	if err := db.GetSession().Query(`INSERT INTO uploads_by_id (upload_id, user_id, upload_length, filename, title, description, alt_text, visibility, publish_at, tags, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?`,
+		up.UploadID, up.UserID, up.Length, up.Filename, up.Title, up.Description, up.AltText, up.Visibility, up.PublishAt, up.Tags, up.CreatedAt, ttl).Exec(); err != nil {
+		os.Remove(tusUploadPath(up.UploadID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not create upload. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+
+	setUploadExpires(c, &up)
+	c.Header("Location", "/uploads/"+up.UploadID.String())
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset godoc
+// @Summary Get the offset of a resumable upload (tus)
+// @Description If the upload is complete but could not be published, X-Upload-Error says why; send an empty PATCH at the final offset to retry.
+// @Tags Images
+// @Security BearerAuth
+// @Param upload_id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Success 200 "Upload-Offset and Upload-Length headers"
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Router /uploads/{upload_id} [head]
+func GetUploadOffset(c *gin.Context) {
+	up, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	offset, err := uploadOffset(up.UploadID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if up.ImageID != nil {
+		offset = up.Length
+		c.Header("X-Image-ID", up.ImageID.String())
+	} else if up.LastError != "" {
+		c.Header("X-Upload-Error", up.LastError)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(up.Length, 10))
+	setUploadExpires(c, up)
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload godoc
+// @Summary Append a chunk to a resumable upload (tus)
+// @Description When the last chunk arrives the image is validated and published like POST /images; its ID is returned in the X-Image-ID header. If publishing fails the upload is kept: an empty PATCH at the final offset retries it.
+// @Tags Images
+// @Security BearerAuth
+// @Accept application/offset+octet-stream
+// @Param upload_id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204 "Upload-Offset header with the new offset"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Router /uploads/{upload_id} [patch]
+func PatchUpload(c *gin.Context) {
+	up, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	if up.ImageID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload already completed", "image_id": up.ImageID})
+		return
+	}
+	clientOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+
+	lock, _ := uploadLocks.LoadOrStore(up.UploadID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	offset, err := uploadOffset(up.UploadID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read upload"})
+		return
+	}
+	if clientOffset != offset {
+		c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the current offset"})
+		return
+	}
+
+	f, err := os.OpenFile(tusUploadPath(up.UploadID), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	// Nunca escribir más allá de Upload-Length; una conexión cortada deja lo ya recibido
+	written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, up.Length-offset))
+	f.Close()
+	offset += written
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	setUploadExpires(c, up)
+	if copyErr != nil {
+		log.Printf("Upload %v interrupted at offset %d: %v", up.UploadID, offset, copyErr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload interrupted, resume from Upload-Offset"})
+		return
+	}
+	if offset < up.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// Subida completa: mismo pipeline de validación y guardado que UploadImage
+	data, err := os.ReadFile(tusUploadPath(up.UploadID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read uploaded file"})
+		return
+	}
+	visibility, _ := normalizeVisibility(up.Visibility)
+	// publish_at se comprobó al crear la subida; si ya pasó mientras se
+	// enviaba, se publica ahora (como parsePublishAt con una fecha pasada)
+	publishAt := up.PublishAt
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		publishAt = nil
+	}
+	image, uerr := saveImageUpload(c, up.UserID, imageUpload{
+		Files:       []uploadFile{{Filename: up.Filename, Data: data, AltText: up.AltText}},
+		Title:       up.Title,
+		Description: up.Description,
+		Visibility:  visibility,
+		PublishAt:   publishAt,
+		Tags:        up.Tags,
+	})
+	if uerr != nil {
+		// se conservan el archivo y la fila: un PATCH vacío en el offset final reintenta
+		message, _ := uerr.Body["error"].(string)
+		if err := db.GetSession().Query(`UPDATE uploads_by_id USING TTL ? SET last_error = ? WHERE upload_id = ?`,
+			uploadTTL(up), message, up.UploadID).Exec(); err != nil {
+			log.Printf("Error marking upload %v as failed: %v", up.UploadID, err)
+		}
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	os.Remove(tusUploadPath(up.UploadID))
+	uploadLocks.Delete(up.UploadID)
+	if err := db.GetSession().Query(`UPDATE uploads_by_id USING TTL ? SET image_id = ?, last_error = null WHERE upload_id = ?`,
+		uploadTTL(up), image.ImageID, up.UploadID).Exec(); err != nil {
+		log.Printf("Error marking upload %v as completed: %v", up.UploadID, err)
+	}
+	c.Header("X-Image-ID", image.ImageID.String())
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload godoc
+// @Summary Cancel a resumable upload (tus termination)
+// @Tags Images
+// @Security BearerAuth
+// @Param upload_id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Success 204 "No Content"
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Router /uploads/{upload_id} [delete]
+func DeleteUpload(c *gin.Context) {
+	up, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	if err := os.Remove(tusUploadPath(up.UploadID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error removing upload file %v: %v", up.UploadID, err)
+	}
+	if err := db.GetSession().Query(`DELETE FROM uploads_by_id WHERE upload_id = ?`, up.UploadID).Exec(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not delete upload. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CleanupExpiredUploads removes upload files older than TUS_UPLOAD_EXPIRY.
+// Their uploads_by_id rows expire on their own through the row TTL.
+func CleanupExpiredUploads() {
+	entries, err := os.ReadDir(tusUploadDir())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error listing upload dir: %v", err)
+		}
+		return
+	}
+	cutoff := time.Now().Add(-tusUploadExpiry())
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(tusUploadDir(), entry.Name())); err != nil {
+			log.Printf("Error removing expired upload %s: %v", entry.Name(), err)
+			continue
+		}
+		log.Printf("Removed expired upload %s", entry.Name())
+	}
+}
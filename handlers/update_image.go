@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/search"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// UpdateImageRequest is the body for editing an image. Omitted fields are
+// left unchanged; an empty string clears description or alt_text. Tags
+// replaces the explicit tags; the #hashtags of the title are always kept.
+type UpdateImageRequest struct {
+	Title       *string   `json:"title,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	AltText     *string   `json:"alt_text,omitempty"`
+	Visibility  *string   `json:"visibility,omitempty" enums:"public,unlisted,followers,private"`
+	Tags        *[]string `json:"tags,omitempty"`
+}
+
+// UpdateImage godoc
+// @Summary Edit an image's title, description, alt text, visibility or tags (owner only)
+// @Description Updates the image in images_by_id, images_by_date and images_by_user and sets edited_at. Likes and reports are kept. Changing visibility adds the image to or removes it from the global feed.
+// @Tags Images
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param image_id path string true "Image ID"
+// @Param image body UpdateImageRequest true "Fields to update"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /images/{image_id} [patch]
+func UpdateImage(c *gin.Context) {
+	imageID, err := gocql.ParseUUID(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid image_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/images#update",
+		})
+		return
+	}
+	var req UpdateImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid body. Optional fields: title, description, alt_text, visibility, tags.",
+			"documentation": "https://docs.osohub.com/images#update",
+		})
+		return
+	}
+
+	// Build update fields dynamically
+	updateFields := make(map[string]interface{})
+	if req.Title != nil {
+		if *req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title cannot be empty"})
+			return
+		}
+		if len(*req.Title) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title too long. Maximum 100 characters."})
+			return
+		}
+		updateFields["title"] = *req.Title
+	}
+	var description, altText string
+	if req.Description != nil {
+		description = *req.Description
+		updateFields["description"] = description
+	}
+	if req.AltText != nil {
+		altText = *req.AltText
+		updateFields["alt_text"] = altText
+	}
+	var visibility string
+	if req.Visibility != nil {
+		var ok bool
+		if visibility, ok = normalizeVisibility(*req.Visibility); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility. Use public, unlisted, followers or private."})
+			return
+		}
+		updateFields["visibility"] = visibility
+	}
+	if uerr := validateImageText(description, altText); uerr != nil {
+		c.JSON(uerr.Status, uerr.Body)
+		return
+	}
+	var explicitTags []string
+	if req.Tags != nil {
+		var uerr *uploadError
+		if explicitTags, uerr = parseTagList(*req.Tags); uerr != nil {
+			c.JSON(uerr.Status, uerr.Body)
+			return
+		}
+	}
+	if len(updateFields) == 0 && req.Tags == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	// Validar que el usuario autenticado es el dueño de la imagen
+	ref, err := db.GetImageRef(imageID)
+	if err != nil || ref.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Image not found.",
+			"documentation": "https://docs.osohub.com/images#update",
+		})
+		return
+	}
+	if ref.UserID.String() != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this image"})
+		return
+	}
+	loaded, err := db.GetImagesByIDs([]gocql.UUID{imageID})
+	if err != nil || len(loaded) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not update image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	current := loaded[0]
+
+	// Las etiquetas dependen del título: recalcularlas si cambia alguno de los dos
+	var tags []string
+	if req.Title != nil || req.Tags != nil {
+		oldTitle := current.Title
+		title := oldTitle
+		if req.Title != nil {
+			title = *req.Title
+		}
+		if req.Tags == nil {
+			// Conservar las etiquetas explícitas que no venían del título anterior
+			fromTitle := map[string]bool{}
+			for _, tag := range imageTags(oldTitle, nil) {
+				fromTitle[tag] = true
+			}
+			for _, tag := range ref.Tags {
+				if !fromTitle[tag] {
+					explicitTags = append(explicitTags, tag)
+				}
+			}
+		}
+		tags = imageTags(title, explicitTags)
+	}
+
+	editedAt := time.Now().UTC()
+	updateFields["edited_at"] = editedAt
+	if err := db.UpdateImageColumns(*ref, updateFields); err != nil {
+		log.Printf("Error updating image %v: %v", imageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not update image. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	// Mantener el feed global (images_by_date) al cambiar la visibilidad
+	if req.Visibility != nil {
+		wasPublic := ref.Visibility == "" || ref.Visibility == models.VisibilityPublic
+		isPublic := visibility == models.VisibilityPublic
+		var err error
+		scheduled := ref.UploadedAt.After(time.Now()) // el scheduler la publicará a su hora
+		if isPublic && !wasPublic && !scheduled {
+			err = db.AddImageToFeed(imageID)
+		} else if wasPublic && !isPublic {
+			err = db.RemoveImageFromFeed(*ref)
+		}
+		if err != nil {
+			log.Printf("Error updating feed for image %v: %v", imageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not update image visibility. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+	}
+	if tags != nil {
+		if req.Visibility != nil {
+			ref.Visibility = visibility
+		}
+		if err := db.SetImageTags(*ref, tags); err != nil {
+			log.Printf("Error updating tags of image %v: %v", imageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not update image tags. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		updateFields["tags"] = tags
+	}
+	// En las galerías el alt text de la imagen es el de la portada
+	if req.AltText != nil {
+		m := map[string]interface{}{}
+		if _, err := db.GetSession().Query(`UPDATE post_items SET alt_text = ? WHERE post_id = ? AND position = 0 IF EXISTS`, altText, imageID).MapScanCAS(m); err != nil {
+			log.Printf("Error updating cover alt text of post %v: %v", imageID, err)
+		}
+	}
+
+	// Mantener el índice de búsqueda al día
+	if req.Title != nil {
+		current.Title = *req.Title
+	}
+	if req.Description != nil {
+		current.Description = description
+	}
+	if req.Visibility != nil {
+		current.Visibility = visibility
+	}
+	if tags != nil {
+		current.Tags = tags
+	}
+	search.SyncImage(current)
+
+	delete(updateFields, "edited_at")
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Image updated successfully",
+		"image_id":  imageID,
+		"updated":   updateFields,
+		"edited_at": editedAt,
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"osohub/db"
 	"osohub/middleware"
+	"osohub/search"
 	"path/filepath"
 	"strings"
 	"time"
@@ -232,9 +233,10 @@ func UpdateOwnUser(c *gin.Context) {
 
 				// Actualizar images_by_date
 				log.Printf("Updating %d images in images_by_date...", len(imagesToUpdate))
+				// IF EXISTS: las imágenes que no están en el feed (no públicas) no deben crearse ahí
 				for _, img := range imagesToUpdate {
-					updateDateImageQuery := `UPDATE images_by_date SET username = ?, user_profile_picture_url = ? WHERE day_bucket = ? AND uploaded_at = ? AND image_id = ?`
-					if err := session.Query(updateDateImageQuery, currentUsername, currentProfilePictureURL, img.DayBucket, img.UploadedAt, img.ImageID).Exec(); err != nil {
+					updateDateImageQuery := `UPDATE images_by_date SET username = ?, user_profile_picture_url = ? WHERE day_bucket = ? AND uploaded_at = ? AND image_id = ? IF EXISTS`
+					if _, err := session.Query(updateDateImageQuery, currentUsername, currentProfilePictureURL, img.DayBucket, img.UploadedAt, img.ImageID).MapScanCAS(map[string]interface{}{}); err != nil {
 						log.Printf("Error updating images_by_date for image %v: %v", img.ImageID, err)
 					}
 				}
@@ -246,6 +248,13 @@ func UpdateOwnUser(c *gin.Context) {
 		}
 	}
 
+	// Reindexar username y bio para la búsqueda
+	if username != "" || bio != "" {
+		if userUUID, err := gocql.ParseUUID(userID); err == nil {
+			search.SyncUserByID(userUUID)
+		}
+	}
+
 	response := gin.H{"message": "Profile updated successfully"}
 	if profilePictureURL != "" {
 		response["profile_picture_url"] = profilePictureURL
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"osohub/db"
+	"osohub/imaging"
+	"osohub/models"
+	"osohub/realtime"
+	"osohub/search"
+	"osohub/webhooks"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxImageSize is the largest image accepted by UploadImage and by
+// resumable uploads.
+const maxImageSize = 10 * 1024 * 1024
+
+// allowedImageTypes are the accepted image file extensions.
+var allowedImageTypes = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// uploadFile is one fully received image file of an upload.
+type uploadFile struct {
+	Filename string
+	Data     []byte
+	Caption  string
+	AltText  string
+}
+
+// imageUpload is a post being published: one file for a plain image or up
+// to maxPostImages ordered files for a gallery. UploadImage, CreatePost and
+// the resumable upload endpoints build one and hand it to saveImageUpload.
+type imageUpload struct {
+	Files       []uploadFile
+	Title       string
+	Description string
+	Visibility  string     // ya normalizada con normalizeVisibility
+	PublishAt   *time.Time // publicación programada; nil publica ya
+	Tags        []string   // etiquetas explícitas, ya validadas con parseTagList
+}
+
+// analyzedFile is an uploadFile after decoding and analysis.
+type analyzedFile struct {
+	uploadFile
+	Analysis imaging.Analysis
+	Analyzed bool // false si no se pudo decodificar: sin hash ni placeholders
+}
+
+// uploadError carries the status and body the caller should respond with.
+type uploadError struct {
+	Status int
+	Body   gin.H
+}
+
+func newUploadError(status int, message string) *uploadError {
+	return &uploadError{Status: status, Body: gin.H{"error": message}}
+}
+
+// validateUploadMetadata checks the file type, declared size and title
+// before any image data is processed.
+func validateUploadMetadata(filename string, size int64, title string) *uploadError {
+	// Validar tipo de archivo
+	fileExt := strings.ToLower(filepath.Ext(filename))
+	isValidType := false
+	for _, ext := range allowedImageTypes {
+		if fileExt == ext {
+			isValidType = true
+			break
+		}
+	}
+	if !isValidType {
+		return newUploadError(http.StatusBadRequest, "Invalid file type. Allowed: JPG, PNG, GIF, WebP")
+	}
+
+	// Validar tamaño (máximo 10MB)
+	if size > maxImageSize {
+		return newUploadError(http.StatusBadRequest, "File too large. Maximum size: 10MB")
+	}
+
+	// Validar título
+	if title == "" {
+		return newUploadError(http.StatusBadRequest, "Title is required")
+	}
+	if len(title) > 100 {
+		return newUploadError(http.StatusBadRequest, "Title too long. Maximum 100 characters.")
+	}
+	return nil
+}
+
+// Longitudes máximas de los textos editables de una imagen
+const (
+	maxDescriptionLength = 2000
+	maxAltTextLength     = 1000
+)
+
+// validateImageText checks the optional description and alt text.
+func validateImageText(description, altText string) *uploadError {
+	if len(description) > maxDescriptionLength {
+		return newUploadError(http.StatusBadRequest, fmt.Sprintf("Description too long. Maximum %d characters.", maxDescriptionLength))
+	}
+	if len(altText) > maxAltTextLength {
+		return newUploadError(http.StatusBadRequest, fmt.Sprintf("Alt text too long. Maximum %d characters.", maxAltTextLength))
+	}
+	return nil
+}
+
+// maxScheduleAhead is how far in the future a post can be scheduled.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// parsePublishAt parses an optional RFC 3339 publish time. Times in the
+// past (or empty) mean "publish now" and return nil.
+func parsePublishAt(value string) (*time.Time, *uploadError) {
+	if value == "" {
+		return nil, nil
+	}
+	publishAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, newUploadError(http.StatusBadRequest, "Invalid publish_at. Use RFC 3339, e.g. 2025-07-01T18:00:00Z.")
+	}
+	now := time.Now()
+	if !publishAt.After(now) {
+		return nil, nil
+	}
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return nil, newUploadError(http.StatusBadRequest, "publish_at is too far in the future. Maximum one year.")
+	}
+	// Cassandra guarda los timestamps con precisión de milisegundos
+	publishAt = publishAt.UTC().Truncate(time.Millisecond)
+	return &publishAt, nil
+}
+
+// saveImageUpload runs the upload pipeline shared by every upload path:
+// decode and analyze the files, check for duplicates, upload them to
+// Cloudinary and persist the post in images_by_id, images_by_date,
+// images_by_tag and images_by_user (plus post_items for galleries). The first file is the
+// cover shown by clients that do not know about galleries. The metadata
+// must already be validated.
+func saveImageUpload(c *gin.Context, userID gocql.UUID, up imageUpload) (models.Image, *uploadError) {
+	files := make([]analyzedFile, 0, len(up.Files))
+	var duplicate *duplicateMatch
+	for _, f := range up.Files {
+		decoded, err := imaging.Decode(f.Data)
+		if err != nil {
+			// formatos que Go no sabe decodificar (p. ej. WebP animado) o imágenes
+			// demasiado grandes: se suben igual, sin hash ni placeholders
+			log.Printf("Skipping analysis of %q: %v", f.Filename, err)
+			files = append(files, analyzedFile{uploadFile: f})
+			continue
+		}
+		// Hash perceptual y placeholders (BlurHash, color dominante)
+		analysis := imaging.Analyze(decoded)
+		files = append(files, analyzedFile{uploadFile: f, Analysis: analysis, Analyzed: true})
+
+		// Detectar casi-duplicados del mismo usuario o de imágenes baneadas
+		if duplicate == nil {
+			match, err := findUploadDuplicate(userID, analysis.DHash)
+			if err != nil {
+				log.Printf("Error checking duplicate uploads: %v", err)
+			}
+			duplicate = match
+		}
+	}
+	cover := files[0].Analysis
+	var phash *int64 // sin hash si la portada no se pudo analizar
+	if files[0].Analyzed {
+		h := int64(cover.DHash)
+		phash = &h
+	}
+
+	if duplicate != nil && duplicate.Action == DuplicateActionReject {
+		message := "This image is a duplicate of one you already uploaded."
+		if duplicate.Banned {
+			message = "This image has been banned by the moderators."
+		}
+		return models.Image{}, &uploadError{Status: http.StatusConflict, Body: gin.H{
+			"error":         message,
+			"duplicate_of":  duplicate.ImageID,
+			"documentation": "https://docs.osohub.com/images#duplicates",
+		}}
+	}
+
+	// Configurar Cloudinary usando CLOUDINARY_URL (método recomendado)
+	cloudinaryURL := os.Getenv("CLOUDINARY_URL")
+	if cloudinaryURL == "" {
+		return models.Image{}, newUploadError(http.StatusInternalServerError, "CLOUDINARY_URL not configured")
+	}
+
+	cld, err := cloudinary.NewFromURL(cloudinaryURL)
+	if err != nil {
+		fmt.Printf("DEBUG Cloudinary config error: %v\n", err)
+		return models.Image{}, newUploadError(http.StatusInternalServerError, "Cloudinary configuration error")
+	}
+
+	// El image_id se genera antes de subir: los public_id de Cloudinary se
+	// derivan de él, así dos archivos con el mismo nombre no se pisan
+	imageID := gocql.TimeUUID()
+
+	// Subir a Cloudinary
+	items := make([]models.PostItem, 0, len(files))
+	for i, f := range files {
+		uploadParams := uploader.UploadParams{
+			PublicID: fmt.Sprintf("osohub/%s_%d", imageID, i),
+			Folder:   "osohub-images",
+		}
+
+		fmt.Printf("DEBUG Upload params: %+v\n", uploadParams)
+
+		result, err := cld.Upload.Upload(context.Background(), bytes.NewReader(f.Data), uploadParams)
+		if err != nil {
+			fmt.Printf("DEBUG Cloudinary upload error: %v\n", err)
+			return models.Image{}, &uploadError{Status: http.StatusInternalServerError, Body: gin.H{"error": "Failed to upload image to Cloudinary", "details": err.Error()}}
+		}
+
+		// URL de Cloudinary (ya optimizada)
+		items = append(items, models.PostItem{
+			Position:      i,
+			ImageURL:      result.SecureURL,
+			Caption:       f.Caption,
+			AltText:       f.AltText,
+			BlurHash:      f.Analysis.BlurHash,
+			DominantColor: f.Analysis.DominantColor,
+			PHash:         f.Analysis.DHash,
+			Hashed:        f.Analyzed,
+		})
+	}
+	imageURL := items[0].ImageURL
+	fmt.Printf("DEBUG imageURL: %s\n", imageURL)
+
+	// Obtener información del usuario para el username y profile_picture_url
+	var username, userProfilePictureURL string
+	if err := db.GetSession().Query(`SELECT username, profile_picture_url FROM users_by_id WHERE user_id = ?`, userID).Scan(&username, &userProfilePictureURL); err != nil {
+		return models.Image{}, newUploadError(http.StatusBadRequest, "User not found")
+	}
+
+	uploadedAt := imageID.Time()
+	// Las imágenes programadas se guardan ya con su fecha de publicación
+	if up.PublishAt != nil {
+		uploadedAt = *up.PublishAt
+	}
+	dayBucket := uploadedAt.Format("2006-01-02")
+	title := up.Title
+	tags := imageTags(title, up.Tags)
+	altText := items[0].AltText
+	itemCount := len(items)
+
+	// Los elementos de una galería se guardan antes que las filas que la publican
+	if itemCount > 1 {
+		if err := db.InsertPostItems(imageID, items); err != nil {
+			return models.Image{}, newUploadError(http.StatusInternalServerError, "Error saving image (post_items)")
+		}
+	}
+
+	// Insert into images_by_id
+	if err := db.GetSession().Query(`INSERT INTO images_by_id (image_id, day_bucket, uploaded_at, user_id, username, user_profile_picture_url, image_url, title, description, alt_text, phash, blurhash, dominant_color, width, height, item_count, visibility, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		imageID, dayBucket, uploadedAt, userID, username, userProfilePictureURL, imageURL, title, up.Description, altText, phash, cover.BlurHash, cover.DominantColor, cover.Width, cover.Height, itemCount, up.Visibility, tags).Exec(); err != nil {
+		return models.Image{}, newUploadError(http.StatusInternalServerError, "Error saving image (by_id)")
+	}
+
+	// Insert into images_by_date (solo las públicas aparecen en el feed global);
+	// las programadas las añade el scheduler a su hora
+	if up.PublishAt != nil {
+		if err := db.ScheduleImage(imageID, uploadedAt); err != nil {
+			return models.Image{}, newUploadError(http.StatusInternalServerError, "Error scheduling image")
+		}
+	} else if up.Visibility == models.VisibilityPublic {
+		if err := db.GetSession().Query(`INSERT INTO images_by_date (day_bucket, uploaded_at, image_id, user_id, username, user_profile_picture_url, image_url, title, description, alt_text, blurhash, dominant_color, item_count, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			dayBucket, uploadedAt, imageID, userID, username, userProfilePictureURL, imageURL, title, up.Description, altText, cover.BlurHash, cover.DominantColor, itemCount, up.Visibility).Exec(); err != nil {
+			return models.Image{}, &uploadError{Status: http.StatusInternalServerError, Body: gin.H{
+				"error":         "Could not save image (by_date). Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			}}
+		}
+		if err := db.AddImageToTags(imageID, userID, uploadedAt, tags); err != nil {
+			return models.Image{}, newUploadError(http.StatusInternalServerError, "Error saving image (by_tag)")
+		}
+	}
+
+	// Insert into images_by_user
+	if err := db.GetSession().Query(`INSERT INTO images_by_user (user_id, uploaded_at, image_id, user_profile_picture_url, image_url, title, description, alt_text, blurhash, dominant_color, item_count, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, uploadedAt, imageID, userProfilePictureURL, imageURL, title, up.Description, altText, cover.BlurHash, cover.DominantColor, itemCount, up.Visibility).Exec(); err != nil {
+		return models.Image{}, newUploadError(http.StatusInternalServerError, "Error saving image (by_user)")
+	}
+
+	// Indexar el hash perceptual de cada imagen para detectar futuros duplicados
+	// (la portada primero; si se repite un hash basta con indexarlo una vez)
+	indexed := map[uint64]bool{}
+	for _, item := range items {
+		if !item.Hashed || indexed[item.PHash] {
+			continue
+		}
+		indexed[item.PHash] = true
+		if err := db.InsertImageHash(imageID, userID, item.PHash); err != nil {
+			log.Printf("Error indexing image hash for %v: %v", imageID, err)
+		}
+	}
+	if duplicate != nil {
+		switch duplicate.Action {
+		case DuplicateActionFlag:
+			flagDuplicate(imageID, duplicate)
+		case DuplicateActionWarn:
+			c.Header("X-Duplicate-Of", duplicate.ImageID.String())
+			c.Header("Warning", fmt.Sprintf(`299 - "Near-duplicate of image %s"`, duplicate.ImageID))
+		}
+	}
+
+	image := models.Image{
+		ImageID:               imageID,
+		DayBucket:             dayBucket,
+		UploadedAt:            uploadedAt,
+		UserID:                userID,
+		Username:              username,
+		UserProfilePictureURL: userProfilePictureURL,
+		ImageURL:              imageURL,
+		Title:                 title,
+		Description:           up.Description,
+		AltText:               altText,
+		BlurHash:              cover.BlurHash,
+		DominantColor:         cover.DominantColor,
+		ItemCount:             itemCount,
+		Visibility:            up.Visibility,
+		Tags:                  tags,
+		Scheduled:             up.PublishAt != nil,
+	}
+	if itemCount > 1 {
+		image.Items = items
+	}
+	search.SyncImage(image)
+	if up.PublishAt == nil && up.Visibility == models.VisibilityPublic {
+		realtime.PublishFeedItem(imageID, userID, uploadedAt)
+	}
+	webhooks.ImageUploaded(image)
+	return image, nil
+}
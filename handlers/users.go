@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
 	"net/http"
 	"osohub/db"
 	"osohub/models"
+	"osohub/search"
+	"osohub/webhooks"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
@@ -68,6 +71,8 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	search.SyncUser(userID, req.Username, req.Bio, "user", createdAt)
+
 	user := models.User{
 		UserID:            userID,
 		Username:          req.Username,
@@ -111,12 +116,15 @@ func GetUserByID(c *gin.Context) {
 }
 
 // BanUser godoc
-// @Summary Ban or unban a user
+// @Summary Ban or unban a user (admin only)
 // @Produce json
+// @Security BearerAuth
 // @Param user_id path string true "User ID"
 // @Param banned query bool true "Ban (true) or unban (false)"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Router /users/{user_id}/ban [patch]
 // @Tags Auth & Users
@@ -132,10 +140,34 @@ func BanUser(c *gin.Context) {
 	if banned == "false" {
 		newRole = "user"
 	}
+	// el UPDATE crearía un usuario fantasma y le llegaría la notificación
+	var currentRole string
+	if err := db.GetSession().Query(`SELECT role FROM users_by_id WHERE user_id = ?`, userID).Scan(&currentRole); err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
 	if err := db.GetSession().Query(`UPDATE users_by_id SET role = ? WHERE user_id = ?`, newRole, userID).Exec(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
 		return
 	}
+	webhooks.UserBanned(userID, newRole == models.RoleBanned)
+	// solo un administrador llega aquí (AdminOnly); se avisa solo si cambia algo
+	changed := (currentRole == models.RoleBanned) != (newRole == models.RoleBanned)
+	if newRole == models.RoleBanned {
+		search.RemoveUser(userID)
+		if changed {
+			notifyModeration(userID, "Your account was suspended for breaking the community guidelines.", nil, nil)
+		}
+	} else {
+		search.SyncUserByID(userID)
+		if changed {
+			notifyModeration(userID, "Your account was reinstated.", nil, nil)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User updated", "role": newRole})
 }
 
@@ -188,6 +220,7 @@ func GetCurrentUser(c *gin.Context) {
 
 // GetPublicProfile godoc
 // @Summary Get public profile by username (no authentication required)
+// @Description Only public images are listed, plus followers-only ones for followers and all of them for the owner (send a JWT to be identified). Includes follower counts and whether the viewer follows the user.
 // @Produce json
 // @Param username path string true "Username"
 // @Success 200 {object} map[string]interface{} "Returns user profile and their images"
@@ -208,9 +241,10 @@ func GetPublicProfile(c *gin.Context) {
 	// Buscar usuario por username
 	var user models.User
 	query := `SELECT user_id, username, profile_picture_url, bio, created_at FROM users_by_id WHERE username = ? ALLOW FILTERING`
+	viewerID := c.GetString("user_id")
 	if err := db.GetSession().Query(query, username).Scan(
 		&user.UserID, &user.Username, &user.ProfilePictureURL, &user.Bio, &user.CreatedAt,
-	); err != nil {
+	); err != nil || blockedBetween(viewerID, user.UserID) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":         "User not found",
 			"documentation": "https://docs.osohub.com/profile#public",
@@ -219,16 +253,21 @@ func GetPublicProfile(c *gin.Context) {
 	}
 	// Obtener todas las imágenes del usuario
 	var images []gin.H // Usamos gin.H para incluir likes_count
-	imageQuery := `SELECT image_id, uploaded_at, user_profile_picture_url, image_url, title FROM images_by_user WHERE user_id = ?`
+	imageQuery := `SELECT image_id, uploaded_at, user_profile_picture_url, image_url, title, description, alt_text, edited_at, blurhash, dominant_color, item_count, visibility, deleted_at FROM images_by_user WHERE user_id = ?`
 	iter := db.GetSession().Query(imageQuery, user.UserID).Iter()
+	access := newViewerAccess(viewerID)
 
 	for {
 		var image models.Image
-		if !iter.Scan(&image.ImageID, &image.UploadedAt, &image.UserProfilePictureURL, &image.ImageURL, &image.Title) {
+		if !iter.Scan(&image.ImageID, &image.UploadedAt, &image.UserProfilePictureURL, &image.ImageURL, &image.Title, &image.Description, &image.AltText, &image.EditedAt, &image.BlurHash, &image.DominantColor, &image.ItemCount, &image.Visibility, &image.DeletedAt) {
 			break
 		}
 		// Agregar datos del usuario a cada imagen
 		image.UserID = user.UserID
+		// Las imágenes no listadas, privadas, solo para seguidores o programadas no salen en el perfil público, ni las de la papelera
+		if !access.listed(image) {
+			continue
+		}
 		image.Username = user.Username
 		image.UserProfilePictureURL = user.ProfilePictureURL
 
@@ -248,8 +287,22 @@ func GetPublicProfile(c *gin.Context) {
 			"user_profile_picture_url": image.UserProfilePictureURL,
 			"image_url":                image.ImageURL,
 			"title":                    image.Title,
+			"description":              image.Description,
+			"alt_text":                 image.AltText,
+			"edited_at":                image.EditedAt,
+			"blurhash":                 image.BlurHash,
+			"dominant_color":           image.DominantColor,
 			"likes_count":              likesCount,
 		}
+		if image.UploadedAt.After(time.Now()) {
+			imageWithLikes["scheduled"] = true
+		}
+		if image.ItemCount > 1 {
+			imageWithLikes["item_count"] = image.ItemCount
+			if items, err := db.GetPostItems(image.ImageID); err == nil {
+				imageWithLikes["items"] = items
+			}
+		}
 
 		images = append(images, imageWithLikes)
 	}
@@ -262,6 +315,11 @@ func GetPublicProfile(c *gin.Context) {
 		return
 	}
 
+	followers, following, err := db.GetFollowCounts(user.UserID)
+	if err != nil {
+		log.Printf("Error loading follow counts of %v: %v", user.UserID, err)
+	}
+
 	// Crear respuesta con perfil e imágenes
 	response := gin.H{
 		"user": gin.H{
@@ -271,10 +329,12 @@ func GetPublicProfile(c *gin.Context) {
 			"bio":                 user.Bio,
 			"created_at":          user.CreatedAt,
 			"total_images":        len(images),
+			"followers_count":     followers,
+			"following_count":     following,
+			"followed_by_viewer":  viewerID != "" && isFollower(viewerID, user.UserID),
 		},
-		"images": images,
-		"share_url": fmt.Sprintf("%s/profile/%s",
-			c.Request.Header.Get("Origin"), username), // URL para compartir
+		"images":    images,
+		"share_url": shareProfileURL(publicBaseURL(), user.Username), // URL para compartir (con vista previa)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -318,13 +378,8 @@ func GetMyShareLink(c *gin.Context) {
 		return
 	}
 
-	// Construir URL de compartir
-	origin := c.Request.Header.Get("Origin")
-	if origin == "" {
-		origin = "http://localhost:5174" // Fallback para desarrollo
-	}
-
-	shareURL := fmt.Sprintf("%s/profile/%s", origin, username)
+	// Construir URL de compartir: la página /u/ tiene las etiquetas Open Graph
+	shareURL := shareProfileURL(publicBaseURL(), username)
 
 	c.JSON(http.StatusOK, gin.H{
 		"share_url": shareURL,
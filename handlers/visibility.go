@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"log"
+	"osohub/db"
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// normalizeVisibility validates a visibility level. An empty value means
+// public, which is also how images uploaded before visibility levels
+// existed are treated.
+func normalizeVisibility(visibility string) (string, bool) {
+	switch visibility {
+	case "":
+		return models.VisibilityPublic, true
+	case models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityFollowers, models.VisibilityPrivate:
+		return visibility, true
+	default:
+		return "", false
+	}
+}
+
+// canViewImage reports whether viewerID (empty for anonymous requests) may
+// open an image directly, e.g. through its link. Scheduled images stay
+// hidden from everyone but the owner until their publish time; images in
+// the trash are hidden from everyone (the owner sees them in the trash).
+// A block in either direction hides the owner's images from the viewer.
+// Handlers checking many images use one viewerAccess instead.
+func canViewImage(viewerID string, img models.Image) bool {
+	return newViewerAccess(viewerID).canView(img)
+}
+
+// viewerAccess answers canViewImage and listedForViewer for many images of
+// one request: the viewer's blocks are loaded once and each follow is
+// checked once per owner. If the blocks cannot be loaded every other
+// user's images are hidden.
+type viewerAccess struct {
+	viewerID string
+	viewer   gocql.UUID
+	signedIn bool
+	blocked  map[gocql.UUID]bool
+	loaded   bool
+	failed   bool
+	follows  map[gocql.UUID]bool
+}
+
+func newViewerAccess(viewerID string) *viewerAccess {
+	a := &viewerAccess{viewerID: viewerID, follows: map[gocql.UUID]bool{}}
+	if viewer, err := gocql.ParseUUID(viewerID); err == nil {
+		a.viewer, a.signedIn = viewer, true
+	}
+	return a
+}
+
+func (a *viewerAccess) canView(img models.Image) bool {
+	if img.DeletedAt != nil {
+		return false
+	}
+	if a.signedIn && a.viewer == img.UserID {
+		return true
+	}
+	if img.UploadedAt.After(time.Now()) {
+		return false
+	}
+	if a.blockedWith(img.UserID) {
+		return false
+	}
+	switch img.Visibility {
+	case "", models.VisibilityPublic, models.VisibilityUnlisted:
+		return true
+	case models.VisibilityFollowers:
+		return a.following(img.UserID)
+	default:
+		return false
+	}
+}
+
+// listed is listedForViewer for this viewer.
+func (a *viewerAccess) listed(img models.Image) bool {
+	if img.Visibility == models.VisibilityUnlisted {
+		return a.signedIn && a.viewer == img.UserID
+	}
+	return a.canView(img)
+}
+
+// blockedWith reports whether the viewer and userID blocked each other.
+func (a *viewerAccess) blockedWith(userID gocql.UUID) bool {
+	if !a.signedIn {
+		return false
+	}
+	if !a.loaded {
+		blocked, err := db.GetBlockedIDs(a.viewer)
+		if err != nil {
+			log.Printf("Error loading blocks of %v: %v", a.viewer, err)
+			a.failed = true
+		}
+		a.blocked, a.loaded = blocked, true
+	}
+	// sin la lista de bloqueos no se puede saber: se oculta
+	return a.failed || a.blocked[userID]
+}
+
+func (a *viewerAccess) following(ownerID gocql.UUID) bool {
+	following, ok := a.follows[ownerID]
+	if !ok {
+		following = isFollower(a.viewerID, ownerID)
+		a.follows[ownerID] = following
+	}
+	return following
+}
+
+// blockedBetween reports whether viewerID and userID blocked each other
+// (either of them). Anonymous viewers are never blocked. If the block
+// cannot be checked it reports true, so nothing is shown by mistake.
+func blockedBetween(viewerID string, userID gocql.UUID) bool {
+	viewer, err := gocql.ParseUUID(viewerID)
+	if err != nil {
+		return false
+	}
+	blocked, err := db.IsBlockedBetween(viewer, userID)
+	if err != nil {
+		log.Printf("Error checking block %v <-> %v: %v", viewer, userID, err)
+		return true
+	}
+	return blocked
+}
+
+// hiddenAuthors returns the users whose content viewerID should not see:
+// blocked in either direction and, with muted set, also muted ones. It
+// fails if they cannot be loaded, rather than showing them.
+func hiddenAuthors(viewerID string, muted bool) (map[gocql.UUID]bool, error) {
+	viewer, err := gocql.ParseUUID(viewerID)
+	if err != nil {
+		return nil, nil
+	}
+	hidden, err := db.GetBlockedIDs(viewer)
+	if err != nil {
+		log.Printf("Error loading blocks of %v: %v", viewer, err)
+		return nil, err
+	}
+	if muted {
+		mutedIDs, err := db.GetMutedIDs(viewer)
+		if err != nil {
+			log.Printf("Error loading mutes of %v: %v", viewer, err)
+			return nil, err
+		}
+		for id := range mutedIDs {
+			hidden[id] = true
+		}
+	}
+	return hidden, nil
+}
+
+// isFollower reports whether viewerID follows ownerID. Anonymous viewers
+// follow no one.
+func isFollower(viewerID string, ownerID gocql.UUID) bool {
+	viewer, err := gocql.ParseUUID(viewerID)
+	if err != nil {
+		return false
+	}
+	following, err := db.IsFollowing(viewer, ownerID)
+	if err != nil {
+		log.Printf("Error checking follow %v -> %v: %v", viewer, ownerID, err)
+	}
+	return following
+}
+
+// listedForViewer reports whether an image appears in listings such as the
+// profile. Unlisted images are reachable only through their link.
+func listedForViewer(viewerID string, img models.Image) bool {
+	return newViewerAccess(viewerID).listed(img)
+}
@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"osohub/db"
+	"osohub/models"
+	"osohub/webhooks"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxWebhooks is how many webhooks a user (or the admins together) can have.
+const maxWebhooks = 10
+
+// CreateWebhookRequest is the body of POST /webhooks.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Scope       string   `json:"scope,omitempty" enums:"user,admin"` // por defecto 'user'
+	Description string   `json:"description,omitempty"`
+}
+
+// UpdateWebhookRequest is the body of PATCH /webhooks/{webhook_id}.
+type UpdateWebhookRequest struct {
+	URL          *string   `json:"url,omitempty"`
+	Events       *[]string `json:"events,omitempty"`
+	Description  *string   `json:"description,omitempty"`
+	Active       *bool     `json:"active,omitempty"`
+	RotateSecret bool      `json:"rotate_secret,omitempty"`
+}
+
+// webhookEvents validates and normalizes the events of a webhook.
+func webhookEvents(c *gin.Context, scope string, events []string) ([]string, bool) {
+	seen := map[string]bool{}
+	valid := map[string]bool{}
+	for _, e := range models.WebhookEvents {
+		valid[e] = true
+	}
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if !valid[e] || (scope == models.WebhookScopeUser && !models.WebhookUserEvents[e]) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid event " + e + ". User webhooks can receive image.uploaded, image.deleted and image.liked; admin webhooks also report.created and user.banned.",
+				"documentation": "https://docs.osohub.com/webhooks#events",
+			})
+			return nil, false
+		}
+		seen[e] = true
+	}
+	if len(seen) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "events must contain at least one event.",
+			"documentation": "https://docs.osohub.com/webhooks#events",
+		})
+		return nil, false
+	}
+	normalized := make([]string, 0, len(seen))
+	for e := range seen {
+		normalized = append(normalized, e)
+	}
+	sort.Strings(normalized)
+	return normalized, true
+}
+
+// validWebhookURL writes a 400 response if url cannot be a webhook URL.
+func validWebhookURL(c *gin.Context, url, scope string) bool {
+	if err := webhooks.ValidateURL(url, scope); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid url: " + err.Error() + ".",
+			"documentation": "https://docs.osohub.com/webhooks#url",
+		})
+		return false
+	}
+	return true
+}
+
+// loadWebhook loads the webhook in the path if the current user manages
+// it: its owner for user webhooks, any admin for admin webhooks. It writes
+// the error response and returns nil otherwise.
+func loadWebhook(c *gin.Context) *models.Webhook {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil
+	}
+	webhookID, err := gocql.ParseUUID(c.Param("webhook_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid webhook_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return nil
+	}
+	hook, err := db.GetWebhook(webhookID)
+	if err != nil && err != gocql.ErrNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return nil
+	}
+	allowed := hook != nil && ((hook.Scope == models.WebhookScopeAdmin && c.GetString("role") == models.RoleAdmin) ||
+		(hook.Scope == models.WebhookScopeUser && hook.OwnerID == userID))
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Webhook not found.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return nil
+	}
+	return hook
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Events are POSTed to url as JSON ({"id", "event", "created_at", "data"}) and signed: X-Osohub-Signature is "sha256=" plus the hex HMAC-SHA256 of "<X-Osohub-Timestamp>.<body>" with the secret. The secret is only returned here and when rotated. User webhooks receive events about the user's own images; admin webhooks (admins only) receive every event. Deliveries that fail are retried with exponential backoff.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body CreateWebhookRequest true "Webhook"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "url and events are required.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return
+	}
+	scope := req.Scope
+	if scope == "" {
+		scope = models.WebhookScopeUser
+	}
+	switch scope {
+	case models.WebhookScopeUser:
+	case models.WebhookScopeAdmin:
+		if c.GetString("role") != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":         "Only admins can create admin webhooks.",
+				"documentation": "https://docs.osohub.com/webhooks#scopes",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid scope. Use user or admin.",
+			"documentation": "https://docs.osohub.com/webhooks#scopes",
+		})
+		return
+	}
+	events, ok := webhookEvents(c, scope, req.Events)
+	if !ok || !validWebhookURL(c, req.URL, scope) {
+		return
+	}
+	if len(req.Description) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Description is too long. Maximum 200 characters.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return
+	}
+
+	existing, err := db.GetWebhooks(scope, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not create webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Too many webhooks. Delete one before creating another.",
+			"documentation": "https://docs.osohub.com/webhooks#limits",
+		})
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not create webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	hook := models.Webhook{
+		WebhookID:   gocql.TimeUUID(),
+		Scope:       scope,
+		OwnerID:     userID,
+		URL:         req.URL,
+		Events:      events,
+		Description: req.Description,
+		Active:      true,
+		Secret:      secret,
+		CreatedAt:   time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if err := db.CreateWebhook(hook); err != nil {
+		log.Printf("Error creating webhook for %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not create webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, hook)
+}
+
+// GetWebhooks godoc
+// @Summary List webhooks
+// @Description The current user's webhooks, or the admin webhooks with scope=admin (admins only). Secrets are not included.
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param scope query string false "user (default) or admin" Enums(user, admin)
+// @Success 200 {object} map[string]interface{} "webhooks"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks [get]
+func GetWebhooks(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	scope := c.DefaultQuery("scope", models.WebhookScopeUser)
+	if scope == models.WebhookScopeAdmin && c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "Only admins can list admin webhooks.",
+			"documentation": "https://docs.osohub.com/webhooks#scopes",
+		})
+		return
+	}
+	if scope != models.WebhookScopeAdmin {
+		scope = models.WebhookScopeUser
+	}
+	hooks, err := db.GetWebhooks(scope, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch webhooks. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook
+// @Description The secret is not included.
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id} [get]
+func GetWebhook(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	hook.Secret = ""
+	c.JSON(http.StatusOK, hook)
+}
+
+// UpdateWebhook godoc
+// @Summary Update a webhook
+// @Description Only the given fields change. With rotate_secret the webhook gets a new secret, returned in the response; deliveries are signed with it from then on.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Param webhook body UpdateWebhookRequest true "Fields to change"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id} [patch]
+func UpdateWebhook(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid body.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return
+	}
+	if req.URL != nil {
+		if !validWebhookURL(c, *req.URL, hook.Scope) {
+			return
+		}
+		hook.URL = *req.URL
+	}
+	if req.Events != nil {
+		events, ok := webhookEvents(c, hook.Scope, *req.Events)
+		if !ok {
+			return
+		}
+		hook.Events = events
+	}
+	if req.Description != nil {
+		if len(*req.Description) > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Description is too long. Maximum 200 characters.",
+				"documentation": "https://docs.osohub.com/webhooks",
+			})
+			return
+		}
+		hook.Description = *req.Description
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if req.RotateSecret {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Could not update webhook. Please try again later.",
+				"documentation": "https://docs.osohub.com/errors#internal",
+			})
+			return
+		}
+		hook.Secret = secret
+	}
+	if err := db.UpdateWebhook(*hook); err != nil {
+		log.Printf("Error updating webhook %v: %v", hook.WebhookID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not update webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !req.RotateSecret {
+		hook.Secret = ""
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Its delivery logs are deleted and its pending deliveries are dropped.
+// @Tags Webhooks
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	if err := db.DeleteWebhook(*hook); err != nil {
+		log.Printf("Error deleting webhook %v: %v", hook.WebhookID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not delete webhook. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary List the deliveries of a webhook (newest first)
+// @Description Deliveries from the last 30 days with their payload, status (pending, succeeded or failed), number of attempts and the result of the last one. Paginate with the next_cursor value of the previous page.
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} map[string]interface{} "deliveries and next_cursor"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id}/deliveries [get]
+func GetWebhookDeliveries(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	var cursor *gocql.UUID
+	if raw := c.Query("cursor"); raw != "" {
+		parsed, err := gocql.ParseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         "Invalid cursor. Use the next_cursor value of the previous page.",
+				"documentation": "https://docs.osohub.com/webhooks#deliveries",
+			})
+			return
+		}
+		cursor = &parsed
+	}
+	limit := queryLimit(c, 20, 100)
+	deliveries, err := db.GetWebhookDeliveries(hook.WebhookID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch deliveries. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	var nextCursor *gocql.UUID
+	if len(deliveries) == limit {
+		last := deliveries[len(deliveries)-1].DeliveryID
+		nextCursor = &last
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries":  deliveries,
+		"next_cursor": nextCursor,
+	})
+}
+
+// queueDelivery queues a delivery and answers 202 with it.
+func queueDelivery(c *gin.Context, hook *models.Webhook, send func() error) {
+	if err := send(); err != nil {
+		log.Printf("Error queuing delivery for webhook %v: %v", hook.WebhookID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not queue delivery. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
+
+// RedeliverWebhook godoc
+// @Summary Send a delivery again
+// @Description Queues a new delivery with the same payload (and event id) as the given one, whatever its status. It shows up in the deliveries list with redelivery_of set.
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver [post]
+func RedeliverWebhook(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	deliveryID, err := gocql.ParseUUID(c.Param("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid delivery_id. Must be a valid UUID.",
+			"documentation": "https://docs.osohub.com/webhooks#deliveries",
+		})
+		return
+	}
+	d, err := db.GetWebhookDelivery(hook.WebhookID, deliveryID)
+	if err == gocql.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":         "Delivery not found.",
+			"documentation": "https://docs.osohub.com/webhooks#deliveries",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":         "Could not fetch delivery. Please try again later.",
+			"documentation": "https://docs.osohub.com/errors#internal",
+		})
+		return
+	}
+	if !hook.Active {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "The webhook is inactive. Activate it before redelivering.",
+			"documentation": "https://docs.osohub.com/webhooks#deliveries",
+		})
+		return
+	}
+	queueDelivery(c, hook, func() error {
+		return webhooks.EnqueuePayload(hook.WebhookID, d.EventID, d.Event, d.Payload, &d.DeliveryID)
+	})
+}
+
+// PingWebhook godoc
+// @Summary Send a test event to a webhook
+// @Description Queues a "ping" event, whatever events the webhook is subscribed to, to check the receiver and its signature verification.
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param webhook_id path string true "Webhook ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/{webhook_id}/ping [post]
+func PingWebhook(c *gin.Context) {
+	hook := loadWebhook(c)
+	if hook == nil {
+		return
+	}
+	if !hook.Active {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "The webhook is inactive. Activate it before sending a ping.",
+			"documentation": "https://docs.osohub.com/webhooks",
+		})
+		return
+	}
+	queueDelivery(c, hook, func() error {
+		return webhooks.Enqueue(hook.WebhookID, webhooks.NewEnvelope(models.WebhookPing, gin.H{"webhook_id": hook.WebhookID}), nil)
+	})
+}
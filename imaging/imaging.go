@@ -0,0 +1,113 @@
+// Package imaging contiene utilidades para analizar imágenes subidas
+// (hash perceptual, placeholders) sin depender de servicios externos.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"  // registra el decoder GIF
+	_ "image/jpeg" // registra el decoder JPEG
+	_ "image/png"  // registra el decoder PNG
+	"io"
+
+	_ "golang.org/x/image/webp" // registra el decoder WebP
+)
+
+// MaxPixels caps the size of the images Decode accepts. A small file can
+// declare huge dimensions and make the decoder allocate gigabytes.
+const MaxPixels = 50_000_000
+
+// ErrTooLarge is returned by Decode for images over MaxPixels.
+var ErrTooLarge = errors.New("imaging: image dimensions too large")
+
+// Decode decodes JPG, PNG, GIF (first frame) and WebP images. It reads the
+// dimensions from the header first and refuses images over MaxPixels.
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Size reads the pixel dimensions of an image from its header, without
+// decoding the whole image.
+func Size(r io.Reader) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg.Width, cfg.Height, err
+}
+
+// rgb is an average color in 8-bit sRGB channels.
+type rgb struct{ R, G, B float64 }
+
+// colorGrid reduces img to a w x h grid of average colors. Large images are
+// subsampled so the cost stays bounded.
+func colorGrid(img image.Image, w, h int) []rgb {
+	b := img.Bounds()
+	grid := make([]rgb, w*h)
+	for gy := 0; gy < h; gy++ {
+		y0 := b.Min.Y + gy*b.Dy()/h
+		y1 := b.Min.Y + (gy+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for gx := 0; gx < w; gx++ {
+			x0 := b.Min.X + gx*b.Dx()/w
+			x1 := b.Min.X + (gx+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			stepX := max(1, (x1-x0)/8)
+			stepY := max(1, (y1-y0)/8)
+			var sum rgb
+			var n int
+			for y := y0; y < y1; y += stepY {
+				for x := x0; x < x1; x += stepX {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					sum.R += float64(r >> 8)
+					sum.G += float64(g >> 8)
+					sum.B += float64(bl >> 8)
+					n++
+				}
+			}
+			grid[gy*w+gx] = rgb{sum.R / float64(n), sum.G / float64(n), sum.B / float64(n)}
+		}
+	}
+	return grid
+}
+
+// grayscaleGrid reduces img to a w x h grid of average luminance values.
+func grayscaleGrid(img image.Image, w, h int) []float64 {
+	colors := colorGrid(img, w, h)
+	grid := make([]float64, len(colors))
+	for i, c := range colors {
+		grid[i] = 0.299*c.R + 0.587*c.G + 0.114*c.B
+	}
+	return grid
+}
+
+// Analysis holds everything computed from an uploaded image.
+type Analysis struct {
+	DHash         uint64
+	BlurHash      string
+	DominantColor string
+	Width         int // dimensiones en píxeles
+	Height        int
+}
+
+// Analyze computes the perceptual hash and loading placeholders of img.
+func Analyze(img image.Image) Analysis {
+	grid := colorGrid(img, placeholderGridSize, placeholderGridSize)
+	return Analysis{
+		DHash:         DHash(img),
+		BlurHash:      blurHash(grid, placeholderGridSize, placeholderGridSize, 4, 3),
+		DominantColor: dominantColor(grid),
+		Width:         img.Bounds().Dx(),
+		Height:        img.Bounds().Dy(),
+	}
+}
@@ -0,0 +1,43 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// HashChunks is the number of 16-bit chunks a hash is split into for
+// indexing. By the pigeonhole principle two hashes within HashChunks-1 bits
+// of each other share at least one identical chunk.
+const HashChunks = 4
+
+// DHash computes a 64-bit difference hash: the image is reduced to a 9x8
+// grayscale grid and each bit records whether a cell is brighter than its
+// right neighbour. Re-encoded, resized or lightly edited copies of the same
+// picture end up a few bits apart.
+func DHash(img image.Image) uint64 {
+	grid := grayscaleGrid(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if grid[y*9+x] > grid[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of differing bits between two hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Chunks splits a hash into HashChunks 16-bit values, most significant first.
+func Chunks(hash uint64) [HashChunks]uint16 {
+	var chunks [HashChunks]uint16
+	for i := 0; i < HashChunks; i++ {
+		chunks[i] = uint16(hash >> (48 - 16*i))
+	}
+	return chunks
+}
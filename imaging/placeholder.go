@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// placeholderGridSize is the resolution images are reduced to before
+// computing placeholders; BlurHash only keeps a few frequency components so
+// more detail would not change the result.
+const placeholderGridSize = 32
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func encodeBase83(value, length int) string {
+	var sb strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+	return sb.String()
+}
+
+func sRGBToLinear(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// blurHash encodes a w x h color grid as a BlurHash string
+// (https://blurha.sh) with cx x cy components.
+func blurHash(grid []rgb, w, h, cx, cy int) string {
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := grid[y*w+x]
+					f[0] += basis * sRGBToLinear(p.R)
+					f[1] += basis * sRGBToLinear(p.G)
+					f[2] += basis * sRGBToLinear(p.B)
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(encodeBase83((cx-1)+(cy-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		sb.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encodeBase83(0, 1))
+	}
+
+	sb.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		sb.WriteString(encodeBase83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return sb.String()
+}
+
+// dominantColor returns the most common color of the grid as "#rrggbb".
+// Colors are grouped into 4-bit-per-channel buckets and the winning bucket
+// is averaged, so near-identical shades count together.
+func dominantColor(grid []rgb) string {
+	type bucket struct {
+		sum   rgb
+		count int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for _, p := range grid {
+		key := int(p.R)>>4<<8 | int(p.G)>>4<<4 | int(p.B)>>4
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{}
+			buckets[key] = b
+		}
+		b.sum.R += p.R
+		b.sum.G += p.G
+		b.sum.B += p.B
+		b.count++
+		if best == nil || b.count > best.count {
+			best = b
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	n := float64(best.count)
+	return fmt.Sprintf("#%02x%02x%02x", int(best.sum.R/n+0.5), int(best.sum.G/n+0.5), int(best.sum.B/n+0.5))
+}
@@ -0,0 +1,73 @@
+// Package jobs runs the periodic background tasks of the API. Every task
+// takes a lease in Cassandra before running, so it is safe to start the jobs
+// on several API replicas (or in the separate cmd/worker process): only the
+// lease holder does the work.
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"osohub/config"
+	"osohub/db"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// holderID identifies this process as a lease holder.
+var holderID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), gocql.TimeUUID())
+}()
+
+// interval reads a Go duration from the environment.
+func interval(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(config.GetEnv(key, fallback.String()))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// runEvery calls fn every period while this process holds the named lease.
+func runEvery(name string, period time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if db.GetSession() == nil {
+				continue
+			}
+			ok, err := db.AcquireLease(name, holderID, 2*period)
+			if err != nil {
+				log.Printf("[jobs] %s: could not acquire lease: %v", name, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := fn(); err != nil {
+				log.Printf("[jobs] %s: %v", name, err)
+			}
+		}
+	}()
+}
+
+// Start launches the background jobs unless BACKGROUND_JOBS is "false"
+// (e.g. on API replicas when cmd/worker runs them instead).
+func Start() {
+	if config.GetEnv("BACKGROUND_JOBS", "true") == "false" {
+		log.Println("[jobs] Background jobs disabled")
+		return
+	}
+	runEvery("scheduled-publishing", interval("SCHEDULER_INTERVAL", 30*time.Second), PublishDueImages)
+	runEvery("trash-purge", interval("TRASH_PURGE_INTERVAL", time.Hour), PurgeTrash)
+	runEvery("webhook-delivery", interval("WEBHOOK_INTERVAL", 5*time.Second), DeliverWebhooks)
+
+	// las clasificaciones caducan solas si el ranker deja de correr
+	trendingEvery := interval("TRENDING_INTERVAL", 10*time.Minute)
+	runEvery("trending-ranker", trendingEvery, func() error {
+		return RankTrending(max(24*time.Hour, 3*trendingEvery))
+	})
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"encoding/json"
+	"log"
+	"osohub/db"
+	"osohub/realtime"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// relayLookback re-reads a few seconds of events on every poll, for the
+// ones written by processes with a slightly late clock.
+const relayLookback = 10 * time.Second
+
+// AnnounceEvents makes realtime.Publish write events to realtime_events
+// instead of the process hub. cmd/worker calls it too: it publishes events
+// (scheduled images) but has no streams.
+func AnnounceEvents() {
+	realtime.SetRelay(func(topic string, ev realtime.Event) error {
+		if db.GetSession() == nil {
+			return gocql.ErrNoConnections
+		}
+		payload, err := json.Marshal(ev.Data)
+		if err != nil {
+			return err
+		}
+		return db.AnnounceRealtimeEvent(topic, ev.Type, payload)
+	})
+}
+
+// StartRelay announces the events published by this process and forwards
+// the ones of realtime_events to its open streams. The realtime hub lives
+// in memory, so an event published by another replica or by cmd/worker
+// only reaches the clients of this process this way. Unlike the jobs, it
+// runs on every API process.
+func StartRelay() {
+	AnnounceEvents()
+	period := interval("REALTIME_RELAY_INTERVAL", 2*time.Second)
+	go func() {
+		since := time.Now().UTC()
+		seen := map[gocql.UUID]time.Time{}
+		for range time.Tick(period) {
+			if db.GetSession() == nil || !realtime.HasLocalSubscribers() {
+				since = time.Now().UTC()
+				continue
+			}
+			now := time.Now().UTC()
+			events, err := db.GetRealtimeEvents(since.Add(-relayLookback), now)
+			if err != nil {
+				log.Printf("[relay] Error reading realtime events: %v", err)
+				continue
+			}
+			for _, e := range events {
+				if _, ok := seen[e.EventID]; ok {
+					continue
+				}
+				seen[e.EventID] = e.EventID.Time()
+				realtime.Deliver(e.Topic, realtime.DecodeEvent(e.Type, e.Payload))
+			}
+			for id, t := range seen {
+				if t.Before(now.Add(-2 * relayLookback)) {
+					delete(seen, id)
+				}
+			}
+			since = now
+		}
+	}()
+}
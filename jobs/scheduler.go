@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"log"
+	"osohub/db"
+	"osohub/realtime"
+	"time"
+)
+
+// PublishDueImages publishes scheduled images whose publish_at has passed.
+// Publishing is idempotent, so an image processed twice (e.g. after a lease
+// changes hands mid-run) is harmless.
+func PublishDueImages() error {
+	due, err := db.GetDueScheduledImages(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, s := range due {
+		ref, err := db.PublishScheduledImage(s)
+		if err != nil {
+			log.Printf("[jobs] Error publishing scheduled image %v: %v", s.ImageID, err)
+			continue
+		}
+		if ref != nil {
+			realtime.PublishFeedItem(ref.ImageID, ref.UserID, ref.UploadedAt)
+		}
+		log.Printf("[jobs] Published scheduled image %v", s.ImageID)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"log"
+	"osohub/config"
+	"osohub/db"
+	"osohub/webhooks"
+	"strconv"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// retentionDays reads a number of days from the environment.
+func retentionDays(key string, fallback int) time.Duration {
+	days, err := strconv.Atoi(config.GetEnv(key, strconv.Itoa(fallback)))
+	if err != nil || days < 0 {
+		days = fallback
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeTrash permanently deletes the images that have been in the trash for
+// longer than TRASH_RETENTION_DAYS. Reported images are kept as evidence for
+// moderators until TRASH_REPORTED_RETENTION_DAYS.
+func PurgeTrash() error {
+	now := time.Now().UTC()
+	retention := retentionDays("TRASH_RETENTION_DAYS", 30)
+	reportedRetention := retentionDays("TRASH_REPORTED_RETENTION_DAYS", 180)
+
+	ids, err := db.GetTrashedBefore(now.Add(-retention))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		ref, err := db.GetImageRef(id)
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Printf("[jobs] Error loading trashed image %v: %v", id, err)
+			continue
+		}
+		if ref.DeletedAt == nil {
+			continue // restaurada mientras tanto
+		}
+		if reports, _ := db.GetImageReportCount(id.String()); reports > 0 && ref.DeletedAt.After(now.Add(-reportedRetention)) {
+			continue // se conserva como evidencia para moderación
+		}
+		if err := db.PurgeImage(*ref); err != nil {
+			log.Printf("[jobs] Error purging image %v: %v", id, err)
+			continue
+		}
+		log.Printf("[jobs] Purged image %v", id)
+		webhooks.ImageDeleted(*ref, true)
+	}
+	return nil
+}
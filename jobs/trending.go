@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"log"
+	"math"
+	"osohub/db"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pesos del ranking de tendencias
+const (
+	// trendingCommentWeight is what a comment is worth compared to a like.
+	trendingCommentWeight = 2
+	// trendingViewWeight is what a view is worth compared to a like.
+	trendingViewWeight = 0.1
+	// trendingSize is how many images each ranking keeps.
+	trendingSize = 500
+	// trendingWorkers is how many images are scored at the same time.
+	trendingWorkers = 16
+)
+
+// trendingHalfLife is how long it takes for a like to count half as much
+// in each period's ranking.
+var trendingHalfLife = map[string]time.Duration{
+	"24h": 6 * time.Hour,
+	"7d":  48 * time.Hour,
+}
+
+// decay halves a signal every halfLife.
+func decay(age, halfLife time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// trendingScore ranks an image: every like counts by how recent it is, and
+// views and comments by how recent their hour is.
+func trendingScore(likeTimes []time.Time, hourly []db.HourlyStats, since, now time.Time, halfLife time.Duration) float64 {
+	score := 0.0
+	for _, t := range likeTimes {
+		if t.After(since) {
+			score += decay(now.Sub(t), halfLife)
+		}
+	}
+	for _, h := range hourly {
+		weight := trendingViewWeight*float64(h.Views) + trendingCommentWeight*float64(h.Comments)
+		score += weight * decay(now.Sub(h.Hour), halfLife)
+	}
+	return score
+}
+
+// scoreImage loads the activity of an image since the start of the period
+// and scores it. Images whose likes cannot be loaded score 0.
+func scoreImage(img db.FeedImage, since, now time.Time, halfLife time.Duration) float64 {
+	likeTimes, err := db.GetLikeTimes(img.ImageID)
+	if err != nil {
+		log.Printf("[jobs] Error loading likes of %v: %v", img.ImageID, err)
+		return 0
+	}
+	hourly, err := db.GetHourlyStats(img.ImageID, since)
+	if err != nil {
+		log.Printf("[jobs] Error loading views and comments of %v: %v", img.ImageID, err)
+	}
+	return trendingScore(likeTimes, hourly, since, now, halfLife)
+}
+
+// RankTrending recomputes the trending ranking of every period from the
+// images uploaded within it.
+func RankTrending(ttl time.Duration) error {
+	now := time.Now().UTC()
+	for period, length := range db.TrendingPeriods {
+		since := now.Add(-length)
+		images, err := db.GetFeedImagesSince(since, now)
+		if err != nil {
+			return err
+		}
+		scores := make([]float64, len(images))
+		next := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < min(trendingWorkers, len(images)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					scores[i] = scoreImage(images[i], since, now, trendingHalfLife[period])
+				}
+			}()
+		}
+		for i := range images {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+
+		entries := make([]db.TrendingEntry, 0, len(images))
+		for i, img := range images {
+			if scores[i] > 0 {
+				entries = append(entries, db.TrendingEntry{ImageID: img.ImageID, Score: scores[i]})
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Score > entries[j].Score })
+		if len(entries) > trendingSize {
+			entries = entries[:trendingSize]
+		}
+		if err := db.SaveTrending(period, now, entries, ttl); err != nil {
+			return err
+		}
+		log.Printf("[jobs] Ranked %d trending images for %s", len(entries), period)
+	}
+	return nil
+}
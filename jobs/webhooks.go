@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"osohub/config"
+	"osohub/db"
+	"osohub/models"
+	"osohub/webhooks"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// webhookBatch is how many due deliveries a run sends at most.
+const webhookBatch = 200
+
+// webhookWorkers is how many deliveries are sent at the same time.
+const webhookWorkers = 8
+
+// webhookBaseBackoff is the wait before the first retry; it doubles with
+// every failed attempt up to webhookMaxBackoff.
+const (
+	webhookBaseBackoff = time.Minute
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// webhookMaxAttempts reads how many times a delivery is attempted before
+// it is marked as failed.
+func webhookMaxAttempts() int {
+	n, err := strconv.Atoi(config.GetEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || n < 1 {
+		return 8
+	}
+	return n
+}
+
+// webhookBackoff is the wait after the given failed attempt, with up to
+// 20% of jitter so retries of many deliveries do not arrive together.
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempt && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, webhookMaxBackoff)
+	return d + time.Duration(rand.Int63n(int64(d/5)+1))
+}
+
+// DeliverWebhooks sends the queued webhook deliveries that are due.
+func DeliverWebhooks() error {
+	due, err := db.GetDueWebhookDeliveries(time.Now().UTC(), webhookBatch)
+	if err != nil {
+		return err
+	}
+	sem := make(chan struct{}, webhookWorkers)
+	var wg sync.WaitGroup
+	for _, q := range due {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(q db.QueuedWebhookDelivery) {
+			defer func() { <-sem; wg.Done() }()
+			if err := deliverWebhook(q); err != nil {
+				log.Printf("[jobs] Error delivering %v to webhook %v: %v", q.DeliveryID, q.WebhookID, err)
+			}
+		}(q)
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliverWebhook makes one attempt of a queued delivery and schedules the
+// next one if it failed.
+func deliverWebhook(q db.QueuedWebhookDelivery) error {
+	// otra réplica puede haber leído la misma entrada (p. ej. si el lote
+	// tardó más que la lease): solo la envía quien la reserva
+	claimed, err := db.ClaimWebhookDelivery(q, holderID)
+	if err != nil || !claimed {
+		return err
+	}
+	hook, err := db.GetWebhook(q.WebhookID)
+	if err == gocql.ErrNotFound {
+		return db.DequeueWebhookDelivery(q) // webhook borrado
+	}
+	if err != nil {
+		return err
+	}
+	d, err := db.GetWebhookDelivery(q.WebhookID, q.DeliveryID)
+	if err == gocql.ErrNotFound {
+		return db.DequeueWebhookDelivery(q)
+	}
+	if err != nil {
+		return err
+	}
+	if d.Status != models.DeliveryPending {
+		return db.DequeueWebhookDelivery(q)
+	}
+
+	now := time.Now().UTC()
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.NextAttemptAt = nil
+	if !hook.Active {
+		// no se reintenta: se puede reenviar a mano al reactivarlo
+		d.Status = models.DeliveryFailed
+		d.Error = "Webhook is inactive"
+		d.ResponseStatus, d.ResponseBody, d.DurationMS = 0, "", 0
+		return db.RecordWebhookAttempt(q, *d)
+	}
+
+	result := webhooks.Send(context.Background(), *hook, *d)
+	d.ResponseStatus = result.StatusCode
+	d.ResponseBody = result.Body
+	d.DurationMS = int(result.Duration.Milliseconds())
+	d.Error = ""
+	switch {
+	case result.OK():
+		d.Status = models.DeliverySucceeded
+	case d.Attempts >= webhookMaxAttempts():
+		d.Status = models.DeliveryFailed
+		d.Error = result.Err.Error()
+	default:
+		next := now.Add(webhookBackoff(d.Attempts))
+		d.NextAttemptAt = &next
+		d.Error = result.Err.Error()
+	}
+	return db.RecordWebhookAttempt(q, *d)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"os"
+	"osohub/db"
 	"osohub/models"
 	"strings"
 
@@ -51,6 +52,34 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		c.Set("user_id", claims["user_id"].(string))
+		if role, ok := claims["role"].(string); ok {
+			c.Set("role", role)
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuth pone user_id y role en el contexto si la petición trae un JWT
+// válido, pero deja pasar las peticiones anónimas. Se usa en endpoints
+// públicos cuya respuesta depende de quién mira (visibilidad, bloqueos).
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			token, err := jwt.Parse(strings.TrimPrefix(header, "Bearer "), func(token *jwt.Token) (interface{}, error) {
+				return jwtSecret, nil
+			})
+			if err == nil && token.Valid {
+				if claims, ok := token.Claims.(jwt.MapClaims); ok {
+					if userID, ok := claims["user_id"].(string); ok {
+						c.Set("user_id", userID)
+					}
+					if role, ok := claims["role"].(string); ok {
+						c.Set("role", role)
+					}
+				}
+			}
+		}
 		c.Next()
 	}
 }
@@ -83,3 +112,47 @@ func AdminOnly() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// StreamTicket acepta un ticket de /stream/ticket en el parámetro ticket
+// cuando no hay cabecera Authorization. Solo para endpoints que el navegador
+// abre sin poder poner cabeceras (EventSource); va antes de AuthMiddleware.
+// Los tickets son de un solo uso y caducan enseguida, así que no importa
+// que la URL quede en los logs (el JWT sí importaría).
+func StreamTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if c.GetHeader("Authorization") != "" || ticket == "" {
+			c.Next()
+			return
+		}
+		userID, role, ok, err := db.ConsumeStreamTicket(ticket)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check stream ticket. Please try again later.", "documentation": "https://docs.osohub.com/errors#internal"})
+			c.Abort()
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket", "documentation": "https://docs.osohub.com/stream"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", userID)
+		if role != "" {
+			c.Set("role", role)
+		}
+		c.Next()
+	}
+}
+
+// RequireUser deja pasar las peticiones que ya traen user_id (por ejemplo,
+// de StreamTicket) y valida el JWT en las demás.
+func RequireUser() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		if _, ok := GetUserIDFromContext(c); ok {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Album kinds
+const (
+	AlbumKindAlbum      = "album"      // solo imágenes propias
+	AlbumKindCollection = "collection" // imágenes de cualquiera (guardadas)
+)
+
+// Album is an ordered, user-owned set of images. Albums hold the owner's
+// own images; collections can hold any image the owner can see.
+type Album struct {
+	AlbumID      gocql.UUID  `json:"album_id"`
+	UserID       gocql.UUID  `json:"user_id"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description,omitempty"`
+	Kind         string      `json:"kind"`
+	CoverImageID *gocql.UUID `json:"cover_image_id,omitempty"`
+	CoverURL     string      `json:"cover_url,omitempty"`
+	ImageCount   int         `json:"image_count"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Images       []Image     `json:"images,omitempty"` // solo en GET /albums/:album_id
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Comment is a comment on an image. Top-level comments can have replies
+// (one level: replies cannot be replied to).
+type Comment struct {
+	CommentID             gocql.UUID  `json:"comment_id"`
+	ImageID               gocql.UUID  `json:"image_id"`
+	ParentID              *gocql.UUID `json:"parent_id,omitempty"` // solo en respuestas
+	UserID                gocql.UUID  `json:"user_id"`
+	Username              string      `json:"username"`
+	UserProfilePictureURL string      `json:"user_profile_picture_url"`
+	Body                  string      `json:"body"`
+	CreatedAt             time.Time   `json:"created_at"`
+	EditedAt              *time.Time  `json:"edited_at,omitempty"`
+	ReplyCount            int64       `json:"reply_count,omitempty"` // solo en comentarios de primer nivel
+}
@@ -6,6 +6,14 @@ import (
 	"github.com/gocql/gocql"
 )
 
+// Visibility levels for images
+const (
+	VisibilityPublic    = "public"    // feed global y perfil
+	VisibilityUnlisted  = "unlisted"  // solo con el enlace directo
+	VisibilityFollowers = "followers" // solo seguidores
+	VisibilityPrivate   = "private"   // solo el dueño
+)
+
 type Image struct {
 	ImageID               gocql.UUID `json:"image_id"`
 	DayBucket             string     `json:"day_bucket,omitempty"`
@@ -15,4 +23,15 @@ type Image struct {
 	UserProfilePictureURL string     `json:"user_profile_picture_url"`
 	ImageURL              string     `json:"image_url"`
 	Title                 string     `json:"title"`
+	Description           string     `json:"description,omitempty"`
+	AltText               string     `json:"alt_text,omitempty"`
+	EditedAt              *time.Time `json:"edited_at,omitempty"`
+	Visibility            string     `json:"visibility,omitempty"`
+	Tags                  []string   `json:"tags,omitempty"`           // hashtags del título y etiquetas explícitas
+	Scheduled             bool       `json:"scheduled,omitempty"`      // publicación programada (uploaded_at en el futuro)
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`     // en la papelera
+	BlurHash              string     `json:"blurhash,omitempty"`       // placeholder mientras carga la imagen
+	DominantColor         string     `json:"dominant_color,omitempty"` // color dominante en formato #rrggbb
+	ItemCount             int        `json:"item_count,omitempty"`     // número de imágenes del post (galerías)
+	Items                 []PostItem `json:"items,omitempty"`          // solo en galerías (item_count > 1)
 }
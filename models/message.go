@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Message is a direct message of a 1:1 conversation.
+type Message struct {
+	MessageID      gocql.UUID  `json:"message_id"`
+	ConversationID gocql.UUID  `json:"conversation_id"`
+	SenderID       gocql.UUID  `json:"sender_id"`
+	Body           string      `json:"body,omitempty"`
+	ImageID        *gocql.UUID `json:"image_id,omitempty"` // imagen compartida
+	Image          *Image      `json:"image,omitempty"`    // solo si quien lee puede verla
+	CreatedAt      time.Time   `json:"created_at"`
+	Read           bool        `json:"read"` // el destinatario ya lo leyó
+}
+
+// Conversation is a 1:1 conversation as seen by one of its participants.
+type Conversation struct {
+	ConversationID         gocql.UUID `json:"conversation_id"`
+	OtherUserID            gocql.UUID `json:"other_user_id"`
+	OtherUsername          string     `json:"other_username,omitempty"`
+	OtherProfilePictureURL string     `json:"other_profile_picture_url,omitempty"`
+	LastMessage            *Message   `json:"last_message,omitempty"`
+	Unread                 bool       `json:"unread"` // hay mensajes del otro sin leer
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"` // último mensaje (o creación)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Notification types. Each one can be turned off in the user's
+// notification preferences.
+const (
+	NotificationLike       = "like"
+	NotificationFollow     = "follow"
+	NotificationComment    = "comment"
+	NotificationReply      = "reply"
+	NotificationModeration = "moderation"
+)
+
+// NotificationTypes lists every notification type.
+var NotificationTypes = []string{
+	NotificationLike,
+	NotificationFollow,
+	NotificationComment,
+	NotificationReply,
+	NotificationModeration,
+}
+
+// Notification is an event shown in a user's notification center.
+type Notification struct {
+	NotificationID         gocql.UUID  `json:"notification_id"`
+	Type                   string      `json:"type"`
+	ActorID                *gocql.UUID `json:"actor_id,omitempty"`
+	ActorUsername          string      `json:"actor_username,omitempty"`
+	ActorProfilePictureURL string      `json:"actor_profile_picture_url,omitempty"`
+	ImageID                *gocql.UUID `json:"image_id,omitempty"`
+	CommentID              *gocql.UUID `json:"comment_id,omitempty"`
+	Message                string      `json:"message,omitempty"` // solo en moderación
+	CreatedAt              time.Time   `json:"created_at"`
+	Read                   bool        `json:"read"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// PostItem is one image of a multi-image post (gallery). The post itself is
+// an Image whose ImageURL, BlurHash and DominantColor are those of the
+// first item (the cover).
+type PostItem struct {
+	Position      int    `json:"position"`
+	ImageURL      string `json:"image_url"`
+	Caption       string `json:"caption,omitempty"`
+	AltText       string `json:"alt_text,omitempty"`
+	BlurHash      string `json:"blurhash,omitempty"`
+	DominantColor string `json:"dominant_color,omitempty"`
+	PHash         uint64 `json:"-"` // hash perceptual, para detectar duplicados
+	Hashed        bool   `json:"-"` // false si no se pudo decodificar
+}
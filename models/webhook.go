@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Webhook scopes. Admin webhooks receive the events of the whole platform;
+// user webhooks only the events about their owner's images.
+const (
+	WebhookScopeUser  = "user"
+	WebhookScopeAdmin = "admin"
+)
+
+// Webhook events.
+const (
+	WebhookImageUploaded = "image.uploaded"
+	WebhookImageDeleted  = "image.deleted"
+	WebhookImageLiked    = "image.liked"
+	WebhookReportCreated = "report.created"
+	WebhookUserBanned    = "user.banned"
+	WebhookPing          = "ping" // solo con POST /webhooks/{id}/ping
+)
+
+// WebhookEvents lists the events a webhook can subscribe to.
+var WebhookEvents = []string{
+	WebhookImageUploaded,
+	WebhookImageDeleted,
+	WebhookImageLiked,
+	WebhookReportCreated,
+	WebhookUserBanned,
+}
+
+// WebhookUserEvents are the events available to user webhooks; the rest
+// are only for admins.
+var WebhookUserEvents = map[string]bool{
+	WebhookImageUploaded: true,
+	WebhookImageDeleted:  true,
+	WebhookImageLiked:    true,
+}
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending" // en cola o esperando un reintento
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // sin más reintentos
+)
+
+// Webhook is a subscription that receives events as signed HTTP POSTs.
+type Webhook struct {
+	WebhookID   gocql.UUID `json:"webhook_id"`
+	Scope       string     `json:"scope"`
+	OwnerID     gocql.UUID `json:"owner_id"`
+	URL         string     `json:"url"`
+	Events      []string   `json:"events"`
+	Description string     `json:"description,omitempty"`
+	Active      bool       `json:"active"`
+	Secret      string     `json:"secret,omitempty"` // solo al crearlo o rotarlo
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives event.
+func (w Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event sent (or to be sent) to a webhook, with the
+// result of its last attempt.
+type WebhookDelivery struct {
+	DeliveryID     gocql.UUID      `json:"delivery_id"`
+	WebhookID      gocql.UUID      `json:"webhook_id"`
+	EventID        gocql.UUID      `json:"event_id"` // el mismo en los reenvíos
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"` // truncado
+	Error          string          `json:"error,omitempty"`
+	DurationMS     int             `json:"duration_ms,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	RedeliveryOf   *gocql.UUID     `json:"redelivery_of,omitempty"`
+}
@@ -0,0 +1,68 @@
+package realtime
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// FeedItem is the payload of the "image" event: a new image in the global
+// feed. Clients fetch the full image by ID.
+type FeedItem struct {
+	ImageID    gocql.UUID `json:"image_id"`
+	UserID     gocql.UUID `json:"user_id"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+}
+
+// LikeCount is the payload of the "likes" event.
+type LikeCount struct {
+	ImageID gocql.UUID `json:"image_id"`
+	Likes   int64      `json:"likes"`
+}
+
+// PublishFeedItem announces a new image in the global feed.
+func PublishFeedItem(imageID, userID gocql.UUID, uploadedAt time.Time) {
+	Publish(TopicFeed, Event{Type: "image", Data: FeedItem{ImageID: imageID, UserID: userID, UploadedAt: uploadedAt}})
+}
+
+// PublishLikeCount announces the new like count of an image.
+func PublishLikeCount(imageID gocql.UUID, likes int64) {
+	Publish(ImageTopic(imageID), Event{Type: "likes", Data: LikeCount{ImageID: imageID, Likes: likes}})
+}
+
+// PublishNotification delivers a notification to a user's open streams.
+func PublishNotification(userID gocql.UUID, notification interface{}) {
+	Publish(UserTopic(userID), Event{Type: "notification", Data: notification})
+}
+
+// MessagesRead is the payload of the "read" event: a participant read a
+// conversation up to a message.
+type MessagesRead struct {
+	ConversationID gocql.UUID `json:"conversation_id"`
+	UserID         gocql.UUID `json:"user_id"`
+	MessageID      gocql.UUID `json:"message_id"`
+}
+
+// PublishMessage delivers a direct message to a user's open streams.
+func PublishMessage(userID gocql.UUID, message interface{}) {
+	Publish(UserTopic(userID), Event{Type: "message", Data: message})
+}
+
+// PublishMessagesRead tells a user that the other participant of a
+// conversation read it.
+func PublishMessagesRead(userID gocql.UUID, read MessagesRead) {
+	Publish(UserTopic(userID), Event{Type: "read", Data: read})
+}
+
+// DecodeEvent rebuilds an event read back from the relay. Feed items are
+// decoded so streams can leave out their authors; the rest keep their JSON.
+func DecodeEvent(eventType string, payload []byte) Event {
+	if eventType == "image" {
+		var item FeedItem
+		if err := json.Unmarshal(payload, &item); err == nil {
+			return Event{Type: eventType, Data: item}
+		}
+	}
+	return Event{Type: eventType, Data: json.RawMessage(payload)}
+}
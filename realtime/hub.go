@@ -0,0 +1,202 @@
+// Package realtime fans out events (new feed items, like counts,
+// notifications, messages) to the clients connected to the streaming
+// endpoint.
+//
+// The hub lives in the API process. With a relay set (jobs.StartRelay),
+// published events go through Cassandra and every process delivers them to
+// its own clients, so they reach users connected to any replica.
+package realtime
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// subscriberBuffer is how many events a client may fall behind before it is
+// disconnected (it reconnects and refetches what it missed).
+const subscriberBuffer = 64
+
+// TopicFeed receives the images published to the global feed.
+const TopicFeed = "feed"
+
+// UserTopic receives the events addressed to one user.
+func UserTopic(userID gocql.UUID) string {
+	return "user:" + userID.String()
+}
+
+// ImageTopic receives the like count changes of one image.
+func ImageTopic(imageID gocql.UUID) string {
+	return "image:" + imageID.String()
+}
+
+// Event is a message pushed to clients. Type is the SSE event name.
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// Subscriber is one connected client.
+type Subscriber struct {
+	events  chan Event
+	dropped chan struct{}
+	once    sync.Once
+	topics  []string
+}
+
+// Events delivers the events of the subscribed topics.
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped is closed when the subscriber fell too far behind and must
+// disconnect.
+func (s *Subscriber) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+func (s *Subscriber) drop() {
+	s.once.Do(func() { close(s.dropped) })
+}
+
+// Hub routes published events to the subscribers of each topic.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscriber]struct{}
+}
+
+// NewHub returns an empty hub.
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*Subscriber]struct{})}
+}
+
+// Subscribe registers a subscriber to the given topics. Call Unsubscribe
+// when the client disconnects.
+func (h *Hub) Subscribe(topics ...string) *Subscriber {
+	s := &Subscriber{
+		events:  make(chan Event, subscriberBuffer),
+		dropped: make(chan struct{}),
+		topics:  topics,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range topics {
+		subs, ok := h.topics[t]
+		if !ok {
+			subs = make(map[*Subscriber]struct{})
+			h.topics[t] = subs
+		}
+		subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Unsubscribe removes a subscriber from all its topics.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range s.topics {
+		delete(h.topics[t], s)
+		if len(h.topics[t]) == 0 {
+			delete(h.topics, t)
+		}
+	}
+}
+
+// Publish sends an event to every subscriber of a topic without blocking:
+// a subscriber whose buffer is full is dropped instead of slowing down the
+// publisher and the other subscribers.
+func (h *Hub) Publish(topic string, ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.topics[topic] {
+		select {
+		case s.events <- ev:
+		default:
+			s.drop()
+		}
+	}
+}
+
+// HasSubscribers reports whether any client listens to a topic, so
+// publishers can skip building events nobody will receive.
+func (h *Hub) HasSubscribers(topic string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic]) > 0
+}
+
+// HasAnySubscribers reports whether any client is connected.
+func (h *Hub) HasAnySubscribers() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics) > 0
+}
+
+var defaultHub = NewHub()
+
+// Relay carries a published event to every process, which hands it to its
+// hub with Deliver.
+type Relay func(topic string, ev Event) error
+
+var (
+	relayMu sync.RWMutex
+	relay   Relay
+)
+
+// SetRelay makes Publish go through r instead of the process hub.
+func SetRelay(r Relay) {
+	relayMu.Lock()
+	defer relayMu.Unlock()
+	relay = r
+}
+
+func currentRelay() Relay {
+	relayMu.RLock()
+	defer relayMu.RUnlock()
+	return relay
+}
+
+// Subscribe registers a subscriber on the process hub.
+func Subscribe(topics ...string) *Subscriber {
+	return defaultHub.Subscribe(topics...)
+}
+
+// Unsubscribe removes a subscriber from the process hub.
+func Unsubscribe(s *Subscriber) {
+	defaultHub.Unsubscribe(s)
+}
+
+// Publish sends an event through the relay, or on the process hub if there
+// is none. If the relay fails the event still reaches this process.
+func Publish(topic string, ev Event) {
+	if r := currentRelay(); r != nil {
+		err := r(topic, ev)
+		if err == nil {
+			return
+		}
+		log.Printf("[realtime] Error relaying %s event to %s: %v", ev.Type, topic, err)
+	}
+	defaultHub.Publish(topic, ev)
+}
+
+// Deliver sends an event read back from the relay to the process hub.
+func Deliver(topic string, ev Event) {
+	defaultHub.Publish(topic, ev)
+}
+
+// HasSubscribers reports whether any client may listen to a topic. With a
+// relay the clients can be on another process, so it is always true.
+func HasSubscribers(topic string) bool {
+	if currentRelay() != nil {
+		return true
+	}
+	return defaultHub.HasSubscribers(topic)
+}
+
+// HasLocalSubscribers reports whether any client is connected to this
+// process.
+func HasLocalSubscribers() bool {
+	return defaultHub.HasAnySubscribers()
+}
@@ -0,0 +1,269 @@
+// Package search is the embedded full-text index behind GET /search. Each
+// API process keeps its own in-memory inverted index, updated by the
+// handlers on upload, edit and delete and rebuilt from Cassandra at start
+// and every SEARCH_REINDEX_INTERVAL, which also picks up the changes made by
+// other replicas. No external search cluster is needed.
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Field is a piece of text of a document with its weight in the ranking.
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// Index is an inverted index from terms to documents. Its vocabulary is
+// also indexed by trigram, so prefix and typo matches only look at the
+// terms that share enough trigrams with the query instead of all of them.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]float64 // término -> documento -> peso
+	grams    map[string]map[string]struct{} // trigrama -> términos
+	docTerms map[string][]string
+	docTime  map[string]time.Time
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[string]float64{},
+		grams:    map[string]map[string]struct{}{},
+		docTerms: map[string][]string{},
+		docTime:  map[string]time.Time{},
+	}
+}
+
+// Marcas de inicio y fin de término para los trigramas
+const (
+	gramStart = '\x02'
+	gramEnd   = '\x03'
+)
+
+// trigrams returns the distinct trigrams of a term padded with two start
+// and two end marks (up to n+2 for n characters). Without the end marks it
+// returns the ones every longer term starting with it shares.
+func trigrams(term string, withEnd bool) []string {
+	runes := append([]rune{gramStart, gramStart}, []rune(term)...)
+	if withEnd {
+		runes = append(runes, gramEnd, gramEnd)
+	}
+	seen := map[string]bool{}
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		g := string(runes[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+func (ix *Index) addTerm(term string) {
+	for _, g := range trigrams(term, true) {
+		terms := ix.grams[g]
+		if terms == nil {
+			terms = map[string]struct{}{}
+			ix.grams[g] = terms
+		}
+		terms[term] = struct{}{}
+	}
+}
+
+func (ix *Index) removeTerm(term string) {
+	for _, g := range trigrams(term, true) {
+		delete(ix.grams[g], term)
+		if len(ix.grams[g]) == 0 {
+			delete(ix.grams, g)
+		}
+	}
+}
+
+// candidates returns the indexed terms that may match query: the ones
+// sharing at least as many trigrams as a prefix or a term within the
+// allowed edits must share (each edit changes at most three trigrams).
+func (ix *Index) candidates(query string) []string {
+	grams := trigrams(query, true)
+	need := len(grams) // coincidencia exacta
+	if edits := allowedEdits(query); edits > 0 {
+		need = min(need, len(grams)-3*edits)
+	}
+	if utf8.RuneCountInString(query) >= 3 {
+		need = min(need, len(trigrams(query, false))) // prefijo: comparte los trigramas sin marcas de fin
+	}
+	need = max(need, 1)
+	shared := map[string]int{}
+	for _, g := range grams {
+		for term := range ix.grams[g] {
+			shared[term]++
+		}
+	}
+	terms := make([]string, 0, len(shared))
+	for term, count := range shared {
+		if count >= need {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// tokenize lowercases text, strips accents and splits it into terms of
+// letters and digits.
+func tokenize(text string) []string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue // acentos y diéresis
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// Put adds or replaces a document. t breaks ties between equally relevant
+// documents (newest first).
+func (ix *Index) Put(id string, t time.Time, fields ...Field) {
+	weights := map[string]float64{}
+	for _, f := range fields {
+		for _, term := range tokenize(f.Text) {
+			if f.Weight > weights[term] {
+				weights[term] = f.Weight
+			}
+		}
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+	terms := make([]string, 0, len(weights))
+	for term, w := range weights {
+		docs := ix.postings[term]
+		if docs == nil {
+			docs = map[string]float64{}
+			ix.postings[term] = docs
+			ix.addTerm(term)
+		}
+		docs[id] = w
+		terms = append(terms, term)
+	}
+	ix.docTerms[id] = terms
+	ix.docTime[id] = t
+}
+
+// Delete removes a document.
+func (ix *Index) Delete(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+}
+
+func (ix *Index) delete(id string) {
+	for _, term := range ix.docTerms[id] {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+			ix.removeTerm(term)
+		}
+	}
+	delete(ix.docTerms, id)
+	delete(ix.docTime, id)
+}
+
+// Len returns the number of documents.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docTerms)
+}
+
+// matchScore rates how well an indexed term matches a query term: exact
+// matches first, then prefixes (search as you type), then typos.
+func matchScore(query, term string) float64 {
+	if term == query {
+		return 1
+	}
+	if len(query) >= 3 && strings.HasPrefix(term, query) {
+		return 0.7
+	}
+	maxEdits := allowedEdits(query)
+	if maxEdits == 0 {
+		return 0
+	}
+	if d := levenshtein(query, term, maxEdits); d <= maxEdits {
+		return 0.6 - 0.2*float64(d-1)
+	}
+	return 0
+}
+
+// Search returns the ids of the documents matching every term of the query,
+// best first, starting at offset, and the total number of matches.
+func (ix *Index) Search(query string, offset, limit int) ([]string, int) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, 0
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var scores map[string]float64
+	for _, q := range terms {
+		// Mejor coincidencia de este término de la búsqueda en cada documento
+		best := map[string]float64{}
+		for _, term := range ix.candidates(q) {
+			s := matchScore(q, term)
+			if s == 0 {
+				continue
+			}
+			for id, w := range ix.postings[term] {
+				if s*w > best[id] {
+					best[id] = s * w
+				}
+			}
+		}
+		if scores == nil {
+			scores = best
+			continue
+		}
+		// Todos los términos tienen que aparecer
+		for id := range scores {
+			if s, ok := best[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ix.docTime[ids[i]].After(ix.docTime[ids[j]])
+	})
+	total := len(ids)
+	if offset >= total {
+		return nil, total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return ids[offset:end], total
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"log"
+	"osohub/config"
+	"osohub/db"
+	"osohub/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Pesos de los campos en el ranking
+const (
+	titleWeight       = 3
+	tagsWeight        = 2.5
+	descriptionWeight = 1
+	usernameWeight    = 3
+	bioWeight         = 1
+)
+
+var (
+	mu     sync.RWMutex
+	images = NewIndex()
+	users  = NewIndex()
+	// cambios recibidos mientras Rebuild lee Cassandra; se reaplican a los
+	// índices nuevos antes de cambiarlos, para no perderlos
+	replay *[]func(images, users *Index)
+)
+
+func imageIndex() *Index {
+	mu.RLock()
+	defer mu.RUnlock()
+	return images
+}
+
+func userIndex() *Index {
+	mu.RLock()
+	defer mu.RUnlock()
+	return users
+}
+
+// apply runs a change on the current indexes and, during a rebuild, keeps
+// it to run it again on the new ones.
+func apply(change func(images, users *Index)) {
+	mu.Lock()
+	currentImages, currentUsers := images, users
+	if replay != nil {
+		*replay = append(*replay, change)
+	}
+	mu.Unlock()
+	change(currentImages, currentUsers)
+}
+
+// searchable reports whether an image may appear in search results: the
+// same images as the global feed.
+func searchable(img models.Image) bool {
+	public := img.Visibility == "" || img.Visibility == models.VisibilityPublic
+	return public && img.DeletedAt == nil && !img.UploadedAt.After(time.Now())
+}
+
+func imageFields(img models.Image) []Field {
+	return []Field{
+		{Text: img.Title, Weight: titleWeight},
+		{Text: strings.Join(img.Tags, " "), Weight: tagsWeight},
+		{Text: img.Description, Weight: descriptionWeight},
+	}
+}
+
+func userFields(username, bio string) []Field {
+	return []Field{
+		{Text: username, Weight: usernameWeight},
+		{Text: bio, Weight: bioWeight},
+	}
+}
+
+// SyncImage indexes an image, or removes it from the index if it is no
+// longer public, published and out of the trash.
+func SyncImage(img models.Image) {
+	if !searchable(img) {
+		RemoveImage(img.ImageID)
+		return
+	}
+	apply(func(images, _ *Index) { images.Put(img.ImageID.String(), img.UploadedAt, imageFields(img)...) })
+}
+
+// RemoveImage removes an image from the index.
+func RemoveImage(imageID gocql.UUID) {
+	apply(func(images, _ *Index) { images.Delete(imageID.String()) })
+}
+
+// SyncUser indexes a user by username and bio; banned users are removed.
+func SyncUser(userID gocql.UUID, username, bio, role string, createdAt time.Time) {
+	if role == models.RoleBanned {
+		RemoveUser(userID)
+		return
+	}
+	apply(func(_, users *Index) { users.Put(userID.String(), createdAt, userFields(username, bio)...) })
+}
+
+// RemoveUser removes a user from the index.
+func RemoveUser(userID gocql.UUID) {
+	apply(func(_, users *Index) { users.Delete(userID.String()) })
+}
+
+// SyncUserByID reloads a user from users_by_id and indexes it.
+func SyncUserByID(userID gocql.UUID) {
+	var username, bio, role string
+	var createdAt time.Time
+	if err := db.GetSession().Query(`SELECT username, bio, role, created_at FROM users_by_id WHERE user_id = ?`, userID).Scan(&username, &bio, &role, &createdAt); err != nil {
+		log.Printf("[search] Could not reindex user %v: %v", userID, err)
+		return
+	}
+	SyncUser(userID, username, bio, role, createdAt)
+}
+
+// SearchImages returns the ids of the images matching query.
+func SearchImages(query string, offset, limit int) ([]gocql.UUID, int) {
+	return parseIDs(imageIndex().Search(query, offset, limit))
+}
+
+// SearchUsers returns the ids of the users matching query.
+func SearchUsers(query string, offset, limit int) ([]gocql.UUID, int) {
+	return parseIDs(userIndex().Search(query, offset, limit))
+}
+
+func parseIDs(ids []string, total int) ([]gocql.UUID, int) {
+	uuids := make([]gocql.UUID, 0, len(ids))
+	for _, id := range ids {
+		if u, err := gocql.ParseUUID(id); err == nil {
+			uuids = append(uuids, u)
+		}
+	}
+	return uuids, total
+}
+
+// Rebuild reads every image and user from Cassandra into fresh indexes and
+// swaps them in. Changes synced while it runs are replayed on the fresh
+// indexes first.
+func Rebuild() error {
+	mu.Lock()
+	replay = &[]func(images, users *Index){}
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		replay = nil
+		mu.Unlock()
+	}()
+
+	newImages := NewIndex()
+	iter := db.GetSession().Query(`
+		SELECT image_id, uploaded_at, title, description, tags, visibility, deleted_at FROM images_by_id`,
+	).PageSize(1000).Iter()
+	var img models.Image
+	for iter.Scan(&img.ImageID, &img.UploadedAt, &img.Title, &img.Description, &img.Tags, &img.Visibility, &img.DeletedAt) {
+		if searchable(img) {
+			newImages.Put(img.ImageID.String(), img.UploadedAt, imageFields(img)...)
+		}
+		img = models.Image{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	newUsers := NewIndex()
+	iter = db.GetSession().Query(`SELECT user_id, username, bio, role, created_at FROM users_by_id`).PageSize(1000).Iter()
+	var userID gocql.UUID
+	var username, bio, role string
+	var createdAt time.Time
+	for iter.Scan(&userID, &username, &bio, &role, &createdAt) {
+		if role != models.RoleBanned {
+			newUsers.Put(userID.String(), createdAt, userFields(username, bio)...)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	for _, change := range *replay {
+		change(newImages, newUsers)
+	}
+	images, users = newImages, newUsers
+	replay = nil
+	mu.Unlock()
+	log.Printf("[search] Index rebuilt: %d images, %d users", newImages.Len(), newUsers.Len())
+	return nil
+}
+
+// Start builds the index in the background and rebuilds it every
+// SEARCH_REINDEX_INTERVAL (default 10m). Unlike the jobs package this runs
+// on every replica, since each one has its own index.
+func Start() {
+	period, err := time.ParseDuration(config.GetEnv("SEARCH_REINDEX_INTERVAL", "10m"))
+	if err != nil || period <= 0 {
+		period = 10 * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if db.GetSession() == nil {
+				continue
+			}
+			if err := Rebuild(); err != nil {
+				log.Printf("[search] Error rebuilding index: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,170 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"osohub/config"
+	"osohub/models"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers of a delivery. The signature is the HMAC-SHA256 of
+// "<timestamp>.<body>" with the webhook secret, as "sha256=<hex>";
+// receivers should also reject old timestamps to prevent replays.
+const (
+	HeaderEvent     = "X-Osohub-Event"
+	HeaderDelivery  = "X-Osohub-Delivery"
+	HeaderTimestamp = "X-Osohub-Timestamp"
+	HeaderSignature = "X-Osohub-Signature"
+)
+
+// deliveryTimeout is how long a receiver has to answer.
+const deliveryTimeout = 10 * time.Second
+
+// maxResponseBody is how much of the receiver's answer is logged.
+const maxResponseBody = 1024
+
+// ErrPrivateAddress is returned for user webhooks that point to the
+// internal network.
+var ErrPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// NewSecret generates the signing secret of a webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value of a delivery body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// allowPrivate reports whether user webhooks may point to loopback and
+// private addresses (WEBHOOK_ALLOW_PRIVATE_URLS, e.g. for a local receiver).
+// Admin webhooks always may.
+func allowPrivate(scope string) bool {
+	return scope == models.WebhookScopeAdmin || config.GetEnv("WEBHOOK_ALLOW_PRIVATE_URLS", "false") == "true"
+}
+
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// ValidateURL checks the URL of a webhook: absolute http(s) and, for user
+// webhooks, not an obviously internal host. Hosts that resolve to private
+// addresses are also refused when delivering.
+func ValidateURL(raw, scope string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	if allowPrivate(scope) {
+		return nil
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && privateIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// newClient builds an HTTP client for deliveries. Redirects are not
+// followed: a 3xx answer counts as a failed delivery.
+func newClient(private bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !private {
+		// se comprueba la IP ya resuelta para evitar DNS rebinding
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   deliveryTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// clients are the delivery clients with and without access to private
+// addresses.
+var clients = map[bool]*http.Client{true: newClient(true), false: newClient(false)}
+
+// Result is the outcome of a delivery attempt.
+type Result struct {
+	StatusCode int
+	Body       string // truncado
+	Duration   time.Duration
+	Err        error
+}
+
+// OK reports whether the receiver accepted the delivery (2xx).
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send POSTs a delivery to its webhook, signed with the webhook secret.
+func Send(ctx context.Context, w models.Webhook, d models.WebhookDelivery) Result {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OSOHUB-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.DeliveryID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, d.Payload))
+
+	start := time.Now()
+	resp, err := clients[allowPrivate(w.Scope)].Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result := Result{StatusCode: resp.StatusCode, Body: string(body), Duration: time.Since(start)}
+	if !result.OK() {
+		result.Err = fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return result
+}
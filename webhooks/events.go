@@ -0,0 +1,139 @@
+// Package webhooks sends platform events to the URLs of webhook
+// subscriptions. Emitting an event only queues one delivery per matching
+// webhook in Cassandra; the delivery job (jobs.DeliverWebhooks) sends them
+// and retries the failed ones.
+package webhooks
+
+import (
+	"encoding/json"
+	"log"
+	"osohub/db"
+	"osohub/models"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Envelope is the body POSTed to webhooks.
+type Envelope struct {
+	ID        gocql.UUID  `json:"id"` // el mismo en los reintentos y reenvíos
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// ImageData is the payload of image.uploaded and image.deleted.
+type ImageData struct {
+	ImageID    gocql.UUID `json:"image_id"`
+	UserID     gocql.UUID `json:"user_id"`
+	Username   string     `json:"username,omitempty"`
+	Title      string     `json:"title,omitempty"`
+	ImageURL   string     `json:"image_url,omitempty"`
+	Visibility string     `json:"visibility,omitempty"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+	Scheduled  bool       `json:"scheduled,omitempty"` // publicación programada para uploaded_at
+	Permanent  bool       `json:"permanent,omitempty"` // image.deleted: purgada (no solo en la papelera)
+}
+
+// LikeData is the payload of image.liked.
+type LikeData struct {
+	ImageID gocql.UUID `json:"image_id"`
+	OwnerID gocql.UUID `json:"owner_id"`
+	UserID  gocql.UUID `json:"user_id"` // quien dio el like
+}
+
+// ReportData is the payload of report.created.
+type ReportData struct {
+	ImageID    gocql.UUID  `json:"image_id"`
+	CommentID  *gocql.UUID `json:"comment_id,omitempty"` // reportes de comentarios
+	ReporterID gocql.UUID  `json:"reporter_id"`
+	Category   string      `json:"category"`
+	Reason     string      `json:"reason,omitempty"`
+}
+
+// BanData is the payload of user.banned.
+type BanData struct {
+	UserID gocql.UUID `json:"user_id"`
+	Banned bool       `json:"banned"` // false cuando se levanta el baneo
+}
+
+// NewEnvelope builds the body of a new event.
+func NewEnvelope(event string, data interface{}) Envelope {
+	return Envelope{ID: gocql.TimeUUID(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+}
+
+// Emit queues an event for every active webhook subscribed to it. ownerID
+// is the user the event is about, whose user webhooks also receive it; nil
+// for admin-only events.
+func Emit(event string, ownerID *gocql.UUID, data interface{}) {
+	webhooks, err := db.GetEventWebhooks(event, ownerID)
+	if err != nil {
+		log.Printf("[webhooks] Error loading webhooks for %s: %v", event, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	envelope := NewEnvelope(event, data)
+	for _, w := range webhooks {
+		if err := Enqueue(w.WebhookID, envelope, nil); err != nil {
+			log.Printf("[webhooks] Error queuing %s for webhook %v: %v", event, w.WebhookID, err)
+		}
+	}
+}
+
+// Enqueue queues a delivery of envelope to a webhook. redeliveryOf is the
+// delivery it repeats, if any.
+func Enqueue(webhookID gocql.UUID, envelope Envelope, redeliveryOf *gocql.UUID) error {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return EnqueuePayload(webhookID, envelope.ID, envelope.Event, payload, redeliveryOf)
+}
+
+// EnqueuePayload queues a delivery of an already encoded event.
+func EnqueuePayload(webhookID, eventID gocql.UUID, event string, payload []byte, redeliveryOf *gocql.UUID) error {
+	deliveryID := gocql.TimeUUID()
+	return db.EnqueueWebhookDelivery(models.WebhookDelivery{
+		DeliveryID:   deliveryID,
+		WebhookID:    webhookID,
+		EventID:      eventID,
+		Event:        event,
+		Payload:      payload,
+		Status:       models.DeliveryPending,
+		CreatedAt:    deliveryID.Time().UTC(),
+		RedeliveryOf: redeliveryOf,
+	})
+}
+
+// ImageUploaded announces a new image to its owner's and the admin webhooks.
+func ImageUploaded(img models.Image) {
+	Emit(models.WebhookImageUploaded, &img.UserID, ImageData{
+		ImageID: img.ImageID, UserID: img.UserID, Username: img.Username, Title: img.Title, ImageURL: img.ImageURL,
+		Visibility: img.Visibility, UploadedAt: img.UploadedAt, Scheduled: img.Scheduled,
+	})
+}
+
+// ImageDeleted announces that an image was moved to the trash or, when
+// permanent, purged.
+func ImageDeleted(ref db.ImageRef, permanent bool) {
+	Emit(models.WebhookImageDeleted, &ref.UserID, ImageData{
+		ImageID: ref.ImageID, UserID: ref.UserID, Visibility: ref.Visibility, UploadedAt: ref.UploadedAt, Permanent: permanent,
+	})
+}
+
+// ImageLiked announces a new like to the image owner's and the admin webhooks.
+func ImageLiked(imageID, ownerID, likerID gocql.UUID) {
+	Emit(models.WebhookImageLiked, &ownerID, LikeData{ImageID: imageID, OwnerID: ownerID, UserID: likerID})
+}
+
+// ReportCreated announces a report of an image or comment to the admin webhooks.
+func ReportCreated(data ReportData) {
+	Emit(models.WebhookReportCreated, nil, data)
+}
+
+// UserBanned announces a ban (or unban) to the admin webhooks.
+func UserBanned(userID gocql.UUID, banned bool) {
+	Emit(models.WebhookUserBanned, nil, BanData{UserID: userID, Banned: banned})
+}